@@ -2,31 +2,125 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"log/slog"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"hetzner-ddns/internal/config"
 	"hetzner-ddns/internal/ddns"
 	"hetzner-ddns/internal/ip"
 	"hetzner-ddns/internal/logging"
+	"hetzner-ddns/internal/metrics"
+	"hetzner-ddns/internal/notify"
+	"hetzner-ddns/internal/state"
 
 	"github.com/hetznercloud/hcloud-go/v2/hcloud"
 )
 
+const configWatchInterval = 5 * time.Second
+
+const notifyShutdownTimeout = 10 * time.Second
+
+const (
+	configUsage   = "path to a YAML config file (default $CONFIG_FILE)"
+	planJSONUsage = "with --dry-run, also write the plan as JSON to this file (- prints JSON instead of the text plan)"
+)
+
+const (
+	exitOK         = 0
+	exitFailure    = 1
+	exitConfig     = 2
+	exitIPFetch    = 3
+	exitAPIFailure = 4
+)
+
 func main() {
-	cfg, err := config.Load()
+	os.Exit(run())
+}
+
+func run() int {
+	configPath := flag.String("config", "", configUsage)
+	once := flag.Bool("once", false, "run a single sync and exit (same as the sync subcommand)")
+	dryRun := flag.Bool("dry-run", false, "print the DNS changes a single sync would make without applying them (same as the plan subcommand)")
+	planJSON := flag.String("plan-json", "", planJSONUsage)
+	flag.Parse()
+
+	testNotify := false
+	command := flag.Arg(0)
+	switch command {
+	case "":
+	case "sync":
+		*once = true
+	case "plan":
+		*dryRun = true
+	case "notify-test":
+		testNotify = true
+	default:
+		fmt.Fprintf(os.Stderr, "CRITICAL: unknown command %q\n", command)
+		return exitConfig
+	}
+	if command != "" {
+		// flag.Parse stops at the command, so its own flags are parsed here.
+		sub := flag.NewFlagSet(command, flag.ExitOnError)
+		sub.StringVar(configPath, "config", *configPath, configUsage)
+		if command == "plan" {
+			sub.StringVar(planJSON, "plan-json", *planJSON, planJSONUsage)
+		}
+		sub.Parse(flag.Args()[1:])
+		if sub.NArg() > 0 {
+			fmt.Fprintf(os.Stderr, "CRITICAL: unexpected argument %q after %s\n", sub.Arg(0), command)
+			return exitConfig
+		}
+	}
+
+	cfg, err := config.Load(*configPath)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "CRITICAL: %v\n", err)
-		os.Exit(1)
+		return exitConfig
 	}
 
-	logger := logging.New(cfg.LogLevel, cfg.LogFormat)
+	// In dry-run mode stdout carries the plan, so logs move to stderr.
+	logOutput := os.Stdout
+	if *dryRun {
+		logOutput = os.Stderr
+	}
+	logger := logging.New(logOutput, cfg.LogLevel, cfg.LogFormat)
+
+	m := metrics.New()
+	notifier, err := notify.New(cfg, m, logger)
+	if err != nil {
+		logger.Error("Notifications unusable", "error", err)
+		return exitConfig
+	}
+	defer func() {
+		closeCtx, cancel := context.WithTimeout(context.Background(), notifyShutdownTimeout)
+		defer cancel()
+		notifier.Close(closeCtx)
+	}()
+	client := hcloud.NewClient(hcloud.WithToken(cfg.Token), hcloud.WithInstrumentation(m.Registry()))
 
-	client := hcloud.NewClient(hcloud.WithToken(cfg.Token))
-	ipFetcher := ip.NewFetcher(cfg.HTTPTimeout, cfg.UserAgent)
-	service := ddns.NewService(client, ipFetcher, logger, cfg)
+	var store *state.Store
+	if cfg.StateFile != "" {
+		store, err = state.Open(cfg.StateFile)
+		if err != nil {
+			logger.Error("State file unusable", "path", cfg.StateFile, "error", err)
+			return exitConfig
+		}
+	}
+	if cfg.PreserveRecords && !cfg.PruneStaleValues {
+		if cfg.StateFile == "" {
+			logger.Warn("Stale values are not pruned from preserved RRSets; set STATE_FILE to remember the values the updater adds")
+		} else {
+			logger.Info("Stale values are not pruned from preserved RRSets", "prune_stale_values", false)
+		}
+	}
+	service := ddns.NewService(client, ip.NewFactory, store, m, notifier, logger, cfg)
 
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
@@ -35,23 +129,171 @@ func main() {
 	for _, zone := range cfg.Zones {
 		zoneNames = append(zoneNames, zone.Name)
 	}
+	firewallNames := make([]string, 0, len(cfg.Firewalls))
+	for _, firewall := range cfg.Firewalls {
+		firewallNames = append(firewallNames, firewall.Name)
+	}
+
+	if testNotify {
+		if err := notifier.Test(ctx); err != nil {
+			logger.Error("Test notification failed", "error", err)
+			return exitFailure
+		}
+		logger.Info("Test notification sent", "webhooks", len(cfg.Webhooks), "chats", len(cfg.Chats))
+		return exitOK
+	}
+
+	if *dryRun {
+		logger.Info("DDNS dry run starting", "zones", zoneNames, "zone_count", len(cfg.Zones), "firewalls", firewallNames)
+		plan, err := service.DryRun(ctx)
+		if writeErr := writePlan(plan, *planJSON); writeErr != nil {
+			logger.Error("Writing plan failed", "error", writeErr)
+			return exitFailure
+		}
+		if err != nil {
+			logger.Error("DDNS dry run incomplete", "error", err)
+			return syncExitCode(err)
+		}
+		logger.Info("DDNS dry run finished", "changes", len(plan.Changes))
+		return exitOK
+	}
+
+	if *once {
+		logger.Info("DDNS one-shot sync starting", "zones", zoneNames, "zone_count", len(cfg.Zones), "firewalls", firewallNames, "state_file", cfg.StateFile)
+		err := service.RunOnce(ctx)
+		if err == nil {
+			logger.Info("DDNS one-shot sync finished")
+			return exitOK
+		}
+		logger.Error("DDNS one-shot sync failed", "error", err)
+		return syncExitCode(err)
+	}
+
+	reload := func(trigger string) {
+		next, err := config.Load(*configPath)
+		if err != nil {
+			logger.Error("Configuration reload rejected; keeping current config", "trigger", trigger, "error", err)
+			return
+		}
+		logger.Info("Configuration reload requested", "trigger", trigger)
+		service.Reload(next)
+	}
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hup:
+				reload("sighup")
+			}
+		}
+	}()
+	if cfg.WatchConfig && cfg.ConfigFile != "" {
+		go config.Watch(ctx, cfg.ConfigFile, configWatchInterval, func() { reload("config_file") })
+	}
+
+	if cfg.HTTPListenAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", m.Handler())
+		mux.Handle("/healthz", service.LivenessHandler())
+		mux.Handle("/readyz", service.ReadinessHandler())
+		go serveHTTP(ctx, cfg.HTTPListenAddr, mux, logger)
+	}
+	if cfg.DynDNSListenAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/nic/update", service.DynDNSHandler())
+		go serveHTTP(ctx, cfg.DynDNSListenAddr, mux, logger)
+	}
 
 	logger.Info("DDNS service starting",
 		"zones", zoneNames,
 		"zone_count", len(cfg.Zones),
+		"firewalls", firewallNames,
 		"interval", cfg.Interval.String(),
 		"preserve_records", cfg.PreserveRecords,
+		"txt_owner_id", cfg.TXTOwnerID,
+		"state_file", cfg.StateFile,
+		"reconcile_interval", cfg.ReconcileInterval.String(),
 		"retry_attempts", cfg.RetryAttempts,
 		"retry_base_delay", cfg.RetryBaseDelay.String(),
 		"retry_max_delay", cfg.RetryMaxDelay.String(),
+		"concurrency", cfg.Concurrency,
+		"breaker_threshold", cfg.BreakerThreshold,
+		"breaker_cooldown", cfg.BreakerCooldown.String(),
 		"http_timeout", cfg.HTTPTimeout.String(),
 		"request_timeout", cfg.RequestTimeout.String(),
 		"log_format", cfg.LogFormat,
+		"http_listen_addr", cfg.HTTPListenAddr,
+		"config_file", cfg.ConfigFile,
+		"watch_config", cfg.WatchConfig,
+		"pre_update_hook", cfg.PreUpdateHook != "",
+		"post_update_hook", cfg.PostUpdateHook != "",
+		"hook_failure_policy", cfg.HookFailure,
+		"reverse_dns_mode", cfg.ReverseMode,
+		"dyndns_listen_addr", cfg.DynDNSListenAddr,
+		"dyndns_clients", len(cfg.DynDNSClients),
+		"webhooks", len(cfg.Webhooks),
+		"chats", len(cfg.Chats),
 	)
 
 	if err := service.Run(ctx); err != nil {
 		logger.Error("DDNS service stopped with error", "error", err)
-		os.Exit(1)
+		return exitFailure
 	}
 	logger.Info("DDNS service stopped")
+	return exitOK
+}
+
+func syncExitCode(err error) int {
+	var syncErr *ddns.SyncError
+	if errors.As(err, &syncErr) {
+		if syncErr.HasAPIFailure() {
+			return exitAPIFailure
+		}
+		if syncErr.HasIPFailure() {
+			return exitIPFetch
+		}
+	}
+	return exitFailure
+}
+
+func writePlan(plan *ddns.Plan, jsonPath string) error {
+	if jsonPath == "-" {
+		return plan.WriteJSON(os.Stdout)
+	}
+	if err := plan.WriteText(os.Stdout); err != nil {
+		return err
+	}
+	if jsonPath == "" {
+		return nil
+	}
+	f, err := os.Create(jsonPath)
+	if err != nil {
+		return fmt.Errorf("create plan file: %w", err)
+	}
+	if err := plan.WriteJSON(f); err != nil {
+		f.Close()
+		return fmt.Errorf("write plan file: %w", err)
+	}
+	return f.Close()
+}
+
+func serveHTTP(ctx context.Context, addr string, handler http.Handler, logger *slog.Logger) {
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+	logger.Info("HTTP listener started", "addr", addr)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		logger.Error("HTTP listener failed", "addr", addr, "error", err)
+	}
 }
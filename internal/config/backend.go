@@ -0,0 +1,95 @@
+package config
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+)
+
+const defaultConsoleURL = "https://dns.hetzner.com/api/v1"
+
+// RFC2136Config is an authoritative server a zone is published on in addition
+// to its Hetzner backend. An empty Server means none; without a key name
+// updates are sent unsigned.
+type RFC2136Config struct {
+	Server  string
+	KeyName string
+	Secret  []byte
+}
+
+func (l *loader) parseBackend(envKey, fallback string) (string, error) {
+	backend := strings.ToLower(strings.TrimSpace(l.getEnv(envKey, fallback)))
+	if backend != BackendCloud && backend != BackendConsole {
+		return "", keyErrorf(envKey, "%s must be cloud or console; an RFC 2136 server is added with RFC2136_SERVER", envKey)
+	}
+	return backend, nil
+}
+
+// parseZoneBackend reads a zone's DNS_BACKEND and the RFC 2136 server it is
+// also published on; unset values fall back to the top-level ones.
+func (l *loader) parseZoneBackend(prefix, defaultBackend string, defaultRFC2136 RFC2136Config) (string, RFC2136Config, error) {
+	backend, err := l.parseBackend(prefix+"DNS_BACKEND", defaultBackend)
+	if err != nil {
+		return "", RFC2136Config{}, err
+	}
+	server, err := l.parseRFC2136(prefix, defaultRFC2136)
+	if err != nil {
+		return "", RFC2136Config{}, err
+	}
+	if server.Server == "" && server.KeyName != "" {
+		return "", RFC2136Config{}, keyErrorf(prefix+"RFC2136_TSIG_KEY", "%sRFC2136_TSIG_KEY is set but no RFC2136_SERVER", prefix)
+	}
+	return backend, server, nil
+}
+
+func (l *loader) parseRFC2136(prefix string, fallback RFC2136Config) (RFC2136Config, error) {
+	cfg := fallback
+	if server := strings.TrimSpace(l.getenv(prefix + "RFC2136_SERVER")); server != "" {
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			server = net.JoinHostPort(strings.Trim(server, "[]"), "53")
+		}
+		cfg.Server = server
+	}
+	keyName := strings.TrimSpace(l.getenv(prefix + "RFC2136_TSIG_KEY"))
+	secret := strings.TrimSpace(l.getenv(prefix + "RFC2136_TSIG_SECRET"))
+	if keyName == "" && secret == "" {
+		return cfg, nil
+	}
+	if keyName == "" || secret == "" {
+		return RFC2136Config{}, keyErrorf(prefix+"RFC2136_TSIG_KEY", "%sRFC2136_TSIG_KEY and %sRFC2136_TSIG_SECRET must be set together", prefix, prefix)
+	}
+	decoded, err := base64.StdEncoding.DecodeString(secret)
+	if err != nil {
+		return RFC2136Config{}, keyErrorf(prefix+"RFC2136_TSIG_SECRET", "%sRFC2136_TSIG_SECRET must be base64", prefix)
+	}
+	cfg.KeyName, cfg.Secret = keyName, decoded
+	return cfg, nil
+}
+
+// checkTokens requires the token of every API the configuration uses. The
+// Cloud token is also needed by firewalls and reverse DNS, which only exist in
+// the Cloud API.
+func checkTokens(token, consoleToken string, zones []ZoneConfig, firewalls []FirewallConfig) error {
+	usesCloud := len(firewalls) > 0
+	usesConsole := false
+	for _, zone := range zones {
+		switch zone.Backend {
+		case BackendConsole:
+			usesConsole = true
+		case BackendCloud:
+			usesCloud = true
+		}
+		if slices.ContainsFunc(zone.Records, func(record RecordConfig) bool { return record.Reverse }) {
+			usesCloud = true
+		}
+	}
+	if usesCloud && token == "" {
+		return fmt.Errorf("HETZNER_TOKEN is required")
+	}
+	if usesConsole && consoleToken == "" {
+		return fmt.Errorf("HETZNER_DNS_TOKEN is required for zones with DNS_BACKEND=console")
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRFC2136ServerIsExtraTarget(t *testing.T) {
+	setenv(t, map[string]string{
+		"HETZNER_TOKEN":              "token",
+		"ZONE_1_NAME":                "example.com",
+		"ZONE_2_NAME":                "example.org",
+		"ZONE_2_RFC2136_SERVER":      "10.0.0.53",
+		"ZONE_2_RFC2136_TSIG_KEY":    "ddns-key",
+		"ZONE_2_RFC2136_TSIG_SECRET": "c2VjcmV0",
+	})
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if zone := cfg.Zones[0]; zone.Backend != BackendCloud || zone.RFC2136.Server != "" {
+		t.Errorf("zone 1 = %s with %+v", zone.Backend, zone.RFC2136)
+	}
+	zone := cfg.Zones[1]
+	if zone.Backend != BackendCloud || zone.RFC2136.Server != "10.0.0.53:53" || zone.RFC2136.KeyName != "ddns-key" || string(zone.RFC2136.Secret) != "secret" {
+		t.Errorf("zone 2 = %s with %+v", zone.Backend, zone.RFC2136)
+	}
+}
+
+func TestRFC2136Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		want string
+	}{
+		{"not a backend", map[string]string{"DNS_BACKEND": "rfc2136"}, "DNS_BACKEND must be cloud or console"},
+		{"key without server", map[string]string{"RFC2136_TSIG_KEY": "ddns-key", "RFC2136_TSIG_SECRET": "c2VjcmV0"}, "RFC2136_TSIG_KEY is set but no RFC2136_SERVER"},
+		{"secret not base64", map[string]string{"RFC2136_SERVER": "10.0.0.53", "RFC2136_TSIG_KEY": "ddns-key", "RFC2136_TSIG_SECRET": "not base64!"}, "RFC2136_TSIG_SECRET must be base64"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setenv(t, map[string]string{"HETZNER_TOKEN": "token", "ZONE_NAME": "example.com"})
+			setenv(t, tt.env)
+			_, err := Load("")
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("got %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -3,181 +3,562 @@ package config
 import (
 	"fmt"
 	"log/slog"
+	"net"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 )
 
+const configFileEnv = "CONFIG_FILE"
+
 type Config struct {
-	Token          string
-	Zones          []ZoneConfig
-	Interval       time.Duration
-	HTTPTimeout    time.Duration
-	RequestTimeout time.Duration
-	RetryAttempts  int
-	RetryBaseDelay time.Duration
-	RetryMaxDelay  time.Duration
-	PreserveRecords bool
-	UserAgent      string
-	LogLevel       slog.Level
-	LogFormat      string
+	Token             string
+	DNSConsoleToken   string
+	DNSConsoleURL     string
+	Zones             []ZoneConfig
+	Firewalls         []FirewallConfig
+	Interval          time.Duration
+	HTTPTimeout       time.Duration
+	RequestTimeout    time.Duration
+	RetryAttempts     int
+	RetryBaseDelay    time.Duration
+	RetryMaxDelay     time.Duration
+	Concurrency       int
+	BreakerThreshold  int
+	BreakerCooldown   time.Duration
+	PreserveRecords   bool
+	PruneStaleValues  bool
+	TXTOwnerID        string
+	TXTPrefix         string
+	WithdrawGrace     time.Duration
+	StateFile         string
+	ReconcileInterval time.Duration
+	UserAgent         string
+	LogLevel          slog.Level
+	LogFormat         string
+	HTTPListenAddr    string
+	ReadyIntervals    int
+	ConfigFile        string
+	WatchConfig       bool
+	PreUpdateHook     string
+	PostUpdateHook    string
+	HookTimeout       time.Duration
+	HookFailure       string
+	ReverseMode       string
+	Webhooks          []WebhookConfig
+	Chats             []ChatConfig
+	NotifyAttempts    int
+	NotifyTimeout     time.Duration
+	DynDNSListenAddr  string
+	DynDNSClients     []DynDNSClient
 }
 
 type ZoneConfig struct {
-	Name          string
-	Records       []RecordConfig
-	RecordType    string
-	IPProviderURL string
-	TTL           *int
+	Name        string
+	Records     []RecordConfig
+	RecordTypes []string
+	IPv4Source  SourceConfig
+	IPv6Source  SourceConfig
+	TTL         *int
+	Backend     string
+	RFC2136     RFC2136Config
+}
+
+type SourceConfig struct {
+	Providers       []string
+	Quorum          int
+	Interface       string
+	InterfaceFilter InterfaceFilter
+}
+
+type InterfaceFilter struct {
+	GlobalOnly        bool
+	ExcludeTemporary  bool
+	ExcludeDeprecated bool
+	ExcludeULA        bool
 }
 
 type RecordConfig struct {
-	Name string
-	TTL  *int
+	Name     string
+	Types    []string
+	TTL      *int
+	Suffix   *AddressSuffix
+	Adopt    bool
+	Reverse  bool
+	Withdraw WithdrawPolicy
+}
+
+const (
+	HookIgnore = "ignore"
+	HookAbort  = "abort"
+)
+
+const (
+	BackendCloud   = "cloud"
+	BackendConsole = "console"
+)
+
+const (
+	ReverseUpdate = "update"
+	ReverseVerify = "verify"
+)
+
+const (
+	WithdrawKeep     = "keep"
+	WithdrawDelete   = "delete"
+	WithdrawFallback = "fallback"
+)
+
+// WithdrawPolicy decides what happens to a record once its IP source has
+// reported no address for longer than WITHDRAW_GRACE.
+type WithdrawPolicy struct {
+	Action   string
+	Fallback net.IP
+}
+
+type AddressSuffix struct {
+	Address   net.IP
+	PrefixLen int
 }
 
-func Load() (Config, error) {
-	token := strings.TrimSpace(os.Getenv("HETZNER_TOKEN"))
-	if token == "" {
-		return Config{}, fmt.Errorf("HETZNER_TOKEN is required")
+func Load(path string) (Config, error) {
+	if path == "" {
+		path = strings.TrimSpace(os.Getenv(configFileEnv))
+	}
+	l := &loader{}
+	if path != "" {
+		values, err := readFile(path)
+		if err != nil {
+			return Config{}, err
+		}
+		l.path = path
+		l.file = values
+	}
+	cfg, err := l.load()
+	if err != nil {
+		return Config{}, l.annotate(err)
+	}
+	cfg.ConfigFile = path
+	return cfg, nil
+}
+
+func (l *loader) load() (Config, error) {
+	token := strings.TrimSpace(l.getenv("HETZNER_TOKEN"))
+	consoleToken := strings.TrimSpace(l.getenv("HETZNER_DNS_TOKEN"))
+	consoleURL, err := l.parseURL("HETZNER_DNS_API_URL", defaultConsoleURL)
+	if err != nil {
+		return Config{}, err
+	}
+	defaultBackend, err := l.parseBackend("DNS_BACKEND", BackendCloud)
+	if err != nil {
+		return Config{}, err
+	}
+	defaultRFC2136, err := l.parseRFC2136("", RFC2136Config{})
+	if err != nil {
+		return Config{}, err
 	}
 
-	interval, err := parseInterval()
+	interval, err := l.parseInterval()
 	if err != nil {
 		return Config{}, err
 	}
 	if interval <= 0 {
-		return Config{}, fmt.Errorf("INTERVAL must be greater than zero")
+		return Config{}, keyErrorf("INTERVAL", "INTERVAL must be greater than zero")
 	}
 
-	httpTimeout, err := parseDuration("HTTP_TIMEOUT", "10s")
+	httpTimeout, err := l.parseDuration("HTTP_TIMEOUT", "10s")
 	if err != nil {
 		return Config{}, err
 	}
-	requestTimeout, err := parseDuration("REQUEST_TIMEOUT", "20s")
+	requestTimeout, err := l.parseDuration("REQUEST_TIMEOUT", "20s")
 	if err != nil {
 		return Config{}, err
 	}
 
-	defaultIPProvider := strings.TrimSpace(getEnv("IP_PROVIDER", "https://api.ipify.org"))
-	defaultRecordType, err := parseRecordType(getEnv("RECORD_TYPE", "A"))
+	interfaceFilter := InterfaceFilter{
+		GlobalOnly:        true,
+		ExcludeTemporary:  addrFlagsSupported,
+		ExcludeDeprecated: addrFlagsSupported,
+		ExcludeULA:        true,
+	}
+	defaultIPv4Source, defaultIPv6Source, err := l.parseFamilySources("",
+		SourceConfig{Providers: []string{"https://api.ipify.org"}, Quorum: 1, InterfaceFilter: interfaceFilter},
+		SourceConfig{Providers: []string{"https://api6.ipify.org"}, Quorum: 1, InterfaceFilter: interfaceFilter},
+	)
 	if err != nil {
 		return Config{}, err
 	}
+	defaultRecordTypes, err := parseRecordTypes(l.getEnv("RECORD_TYPE", "A"))
+	if err != nil {
+		return Config{}, &keyError{key: "RECORD_TYPE", err: err}
+	}
 
-	defaultTTL, err := parseTTL("TTL")
+	defaultTTL, err := l.parseTTL("TTL")
 	if err != nil {
 		return Config{}, err
 	}
 
-	retryAttempts, err := parseInt("RETRY_ATTEMPTS", 3, 1, 10)
+	retryAttempts, err := l.parseInt("RETRY_ATTEMPTS", 3, 1, 10)
 	if err != nil {
 		return Config{}, err
 	}
-	retryBaseDelay, err := parseDuration("RETRY_BASE_DELAY", "500ms")
+	retryBaseDelay, err := l.parseDuration("RETRY_BASE_DELAY", "500ms")
 	if err != nil {
 		return Config{}, err
 	}
-	retryMaxDelay, err := parseDuration("RETRY_MAX_DELAY", "5s")
+	retryMaxDelay, err := l.parseDuration("RETRY_MAX_DELAY", "5s")
 	if err != nil {
 		return Config{}, err
 	}
 	if retryMaxDelay < retryBaseDelay {
-		return Config{}, fmt.Errorf("RETRY_MAX_DELAY must be >= RETRY_BASE_DELAY")
+		return Config{}, keyErrorf("RETRY_MAX_DELAY", "RETRY_MAX_DELAY must be >= RETRY_BASE_DELAY")
+	}
+
+	concurrency, err := l.parseInt("CONCURRENCY", 4, 1, 64)
+	if err != nil {
+		return Config{}, err
+	}
+
+	breakerThreshold, err := l.parseInt("BREAKER_THRESHOLD", 5, 0, 1000)
+	if err != nil {
+		return Config{}, err
+	}
+	breakerCooldown, err := l.parseDuration("BREAKER_COOLDOWN", "5m")
+	if err != nil {
+		return Config{}, err
+	}
+
+	preserveRecords, err := l.parseBool("PRESERVE_EXISTING_RECORDS", "true")
+	if err != nil {
+		return Config{}, err
+	}
+
+	txtOwnerID := strings.TrimSpace(l.getenv("TXT_OWNER_ID"))
+	if strings.ContainsAny(txtOwnerID, ",\"= ") {
+		return Config{}, keyErrorf("TXT_OWNER_ID", "TXT_OWNER_ID must not contain spaces, commas, quotes or '='")
+	}
+	txtPrefix := strings.TrimSpace(l.getEnv("TXT_PREFIX", "_hetzner-ddns."))
+	if txtPrefix == "" || strings.TrimRight(txtPrefix, ".-") == "" {
+		return Config{}, keyErrorf("TXT_PREFIX", "TXT_PREFIX must not be empty")
+	}
+
+	defaultWithdraw, err := l.parseWithdrawPolicy("WITHDRAW_POLICY", WithdrawPolicy{Action: WithdrawKeep})
+	if err != nil {
+		return Config{}, err
+	}
+	withdrawGrace, err := l.parseDuration("WITHDRAW_GRACE", "10m")
+	if err != nil {
+		return Config{}, err
+	}
+
+	preUpdateHook := strings.TrimSpace(l.getenv("PRE_UPDATE_HOOK"))
+	postUpdateHook := strings.TrimSpace(l.getenv("POST_UPDATE_HOOK"))
+	hookTimeout, err := l.parseDuration("HOOK_TIMEOUT", "30s")
+	if err != nil {
+		return Config{}, err
+	}
+	hookFailure := strings.ToLower(strings.TrimSpace(l.getEnv("HOOK_FAILURE_POLICY", HookIgnore)))
+	if hookFailure != HookIgnore && hookFailure != HookAbort {
+		return Config{}, keyErrorf("HOOK_FAILURE_POLICY", "HOOK_FAILURE_POLICY must be ignore or abort")
+	}
+
+	reverseMode := strings.ToLower(strings.TrimSpace(l.getEnv("REVERSE_DNS_MODE", ReverseUpdate)))
+	if reverseMode != ReverseUpdate && reverseMode != ReverseVerify {
+		return Config{}, keyErrorf("REVERSE_DNS_MODE", "REVERSE_DNS_MODE must be update or verify")
 	}
 
-	preserveRecords, err := parseBool("PRESERVE_EXISTING_RECORDS", "true")
+	stateFile := strings.TrimSpace(l.getenv("STATE_FILE"))
+	// The values the updater added are only known from the state file.
+	pruneStaleValues, err := l.parseBool("PRUNE_STALE_VALUES", strconv.FormatBool(stateFile != ""))
+	if err != nil {
+		return Config{}, err
+	}
+	if pruneStaleValues && stateFile == "" {
+		return Config{}, keyErrorf("PRUNE_STALE_VALUES", "PRUNE_STALE_VALUES needs STATE_FILE to remember the values the updater added")
+	}
+	reconcileInterval, err := l.parseDuration("FORCE_RECONCILE_INTERVAL", "1h")
 	if err != nil {
 		return Config{}, err
 	}
 
-	userAgent := strings.TrimSpace(getEnv("USER_AGENT", "hetzner-ddns/1.0"))
+	watchConfig, err := l.parseBool("CONFIG_WATCH", "false")
+	if err != nil {
+		return Config{}, err
+	}
 
-	logLevel, err := parseLogLevel(getEnv("LOG_LEVEL", "info"))
+	httpListenAddr := strings.TrimSpace(l.getenv("HTTP_LISTEN_ADDR"))
+	readyIntervals, err := l.parseInt("READY_MAX_INTERVALS", 3, 1, 1000)
 	if err != nil {
 		return Config{}, err
 	}
-	logFormat := strings.ToLower(strings.TrimSpace(getEnv("LOG_FORMAT", "text")))
+
+	userAgent := strings.TrimSpace(l.getEnv("USER_AGENT", "hetzner-ddns/1.0"))
+
+	notifyAttempts, err := l.parseInt("NOTIFY_RETRY_ATTEMPTS", 3, 1, 10)
+	if err != nil {
+		return Config{}, err
+	}
+	notifyTimeout, err := l.parseDuration("NOTIFY_TIMEOUT", "10s")
+	if err != nil {
+		return Config{}, err
+	}
+
+	logLevel, err := parseLogLevel(l.getEnv("LOG_LEVEL", "info"))
+	if err != nil {
+		return Config{}, &keyError{key: "LOG_LEVEL", err: err}
+	}
+	logFormat := strings.ToLower(strings.TrimSpace(l.getEnv("LOG_FORMAT", "text")))
 	if logFormat != "text" && logFormat != "json" {
-		return Config{}, fmt.Errorf("LOG_FORMAT must be text or json")
+		return Config{}, keyErrorf("LOG_FORMAT", "LOG_FORMAT must be text or json")
+	}
+
+	zones, err := l.parseZones(defaultRecordTypes, defaultIPv4Source, defaultIPv6Source, defaultTTL, defaultWithdraw, defaultBackend, defaultRFC2136)
+	if err != nil {
+		return Config{}, err
+	}
+	firewalls, err := l.parseFirewalls(defaultRecordTypes, defaultIPv4Source, defaultIPv6Source)
+	if err != nil {
+		return Config{}, err
+	}
+	if len(zones) == 0 && len(firewalls) == 0 {
+		return Config{}, fmt.Errorf("no zones or firewalls configured; use ZONE_NAME, ZONE_<N>_NAME or FIREWALL_NAME")
+	}
+	if err := checkTokens(token, consoleToken, zones, firewalls); err != nil {
+		return Config{}, err
 	}
 
-	zones, err := parseZones(defaultRecordType, defaultIPProvider, defaultTTL)
+	webhooks, err := l.parseWebhooks(zones)
 	if err != nil {
 		return Config{}, err
 	}
-	if len(zones) == 0 {
-		return Config{}, fmt.Errorf("no zones configured; use ZONE_NAME or ZONE_<N>_NAME")
+	chats, err := l.parseChats(zones)
+	if err != nil {
+		return Config{}, err
+	}
+	dyndnsListenAddr, dyndnsClients, err := l.parseDynDNS(zones)
+	if err != nil {
+		return Config{}, err
 	}
 
 	return Config{
-		Token:           token,
-		Zones:           zones,
-		Interval:        interval,
-		HTTPTimeout:     httpTimeout,
-		RequestTimeout:  requestTimeout,
-		RetryAttempts:   retryAttempts,
-		RetryBaseDelay:  retryBaseDelay,
-		RetryMaxDelay:   retryMaxDelay,
-		PreserveRecords: preserveRecords,
-		UserAgent:       userAgent,
-		LogLevel:        logLevel,
-		LogFormat:       logFormat,
+		Token:             token,
+		DNSConsoleToken:   consoleToken,
+		DNSConsoleURL:     consoleURL,
+		Zones:             zones,
+		Firewalls:         firewalls,
+		Interval:          interval,
+		HTTPTimeout:       httpTimeout,
+		RequestTimeout:    requestTimeout,
+		RetryAttempts:     retryAttempts,
+		RetryBaseDelay:    retryBaseDelay,
+		RetryMaxDelay:     retryMaxDelay,
+		Concurrency:       concurrency,
+		BreakerThreshold:  breakerThreshold,
+		BreakerCooldown:   breakerCooldown,
+		PreserveRecords:   preserveRecords,
+		PruneStaleValues:  pruneStaleValues,
+		TXTOwnerID:        txtOwnerID,
+		TXTPrefix:         txtPrefix,
+		WithdrawGrace:     withdrawGrace,
+		StateFile:         stateFile,
+		ReconcileInterval: reconcileInterval,
+		UserAgent:         userAgent,
+		LogLevel:          logLevel,
+		LogFormat:         logFormat,
+		HTTPListenAddr:    httpListenAddr,
+		ReadyIntervals:    readyIntervals,
+		WatchConfig:       watchConfig,
+		PreUpdateHook:     preUpdateHook,
+		PostUpdateHook:    postUpdateHook,
+		HookTimeout:       hookTimeout,
+		HookFailure:       hookFailure,
+		ReverseMode:       reverseMode,
+		Webhooks:          webhooks,
+		Chats:             chats,
+		NotifyAttempts:    notifyAttempts,
+		NotifyTimeout:     notifyTimeout,
+		DynDNSListenAddr:  dyndnsListenAddr,
+		DynDNSClients:     dyndnsClients,
 	}, nil
 }
 
-func parseInterval() (time.Duration, error) {
-	intervalStr := strings.TrimSpace(os.Getenv("INTERVAL"))
+func (l *loader) parseInterval() (time.Duration, error) {
+	intervalStr := strings.TrimSpace(l.getenv("INTERVAL"))
 	if intervalStr != "" {
-		return time.ParseDuration(intervalStr)
+		interval, err := time.ParseDuration(intervalStr)
+		if err != nil {
+			return 0, keyErrorf("INTERVAL", "INTERVAL must be a valid duration: %w", err)
+		}
+		return interval, nil
 	}
 
-	intervalSeconds := strings.TrimSpace(os.Getenv("INTERVAL_SECONDS"))
+	intervalSeconds := strings.TrimSpace(l.getenv("INTERVAL_SECONDS"))
 	if intervalSeconds == "" {
 		return time.ParseDuration("5m")
 	}
 	seconds, err := strconv.Atoi(intervalSeconds)
 	if err != nil || seconds <= 0 {
-		return 0, fmt.Errorf("INTERVAL_SECONDS must be a positive integer")
+		return 0, keyErrorf("INTERVAL_SECONDS", "INTERVAL_SECONDS must be a positive integer")
 	}
 	return time.Duration(seconds) * time.Second, nil
 }
 
-func parseDuration(envKey, fallback string) (time.Duration, error) {
-	value := strings.TrimSpace(getEnv(envKey, fallback))
+func (l *loader) parseDuration(envKey, fallback string) (time.Duration, error) {
+	value := strings.TrimSpace(l.getEnv(envKey, fallback))
 	d, err := time.ParseDuration(value)
 	if err != nil {
-		return 0, fmt.Errorf("%s must be a valid duration: %w", envKey, err)
+		return 0, keyErrorf(envKey, "%s must be a valid duration: %w", envKey, err)
 	}
 	if d <= 0 {
-		return 0, fmt.Errorf("%s must be greater than zero", envKey)
+		return 0, keyErrorf(envKey, "%s must be greater than zero", envKey)
 	}
 	return d, nil
 }
 
-func parseInt(envKey string, fallback, min, max int) (int, error) {
-	raw := strings.TrimSpace(getEnv(envKey, strconv.Itoa(fallback)))
+func (l *loader) parseInt(envKey string, fallback, min, max int) (int, error) {
+	raw := strings.TrimSpace(l.getEnv(envKey, strconv.Itoa(fallback)))
 	value, err := strconv.Atoi(raw)
 	if err != nil {
-		return 0, fmt.Errorf("%s must be an integer", envKey)
+		return 0, keyErrorf(envKey, "%s must be an integer", envKey)
 	}
 	if value < min || value > max {
-		return 0, fmt.Errorf("%s must be between %d and %d", envKey, min, max)
+		return 0, keyErrorf(envKey, "%s must be between %d and %d", envKey, min, max)
 	}
 	return value, nil
 }
 
-func parseBool(envKey, fallback string) (bool, error) {
-	raw := strings.TrimSpace(getEnv(envKey, fallback))
+func (l *loader) parseBool(envKey, fallback string) (bool, error) {
+	raw := strings.TrimSpace(l.getEnv(envKey, fallback))
 	switch strings.ToLower(raw) {
 	case "true", "1", "yes", "y", "on":
 		return true, nil
 	case "false", "0", "no", "n", "off":
 		return false, nil
 	default:
-		return false, fmt.Errorf("%s must be a boolean", envKey)
+		return false, keyErrorf(envKey, "%s must be a boolean", envKey)
+	}
+}
+
+func parseProviders(value string) []string {
+	parts := strings.Split(value, ",")
+	seen := make(map[string]struct{}, len(parts))
+	out := make([]string, 0, len(parts))
+	for _, part := range parts {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		if _, exists := seen[part]; exists {
+			continue
+		}
+		seen[part] = struct{}{}
+		out = append(out, part)
+	}
+	return out
+}
+
+func (l *loader) parseQuorum(envKey string, fallback, providers int) (int, error) {
+	raw := strings.TrimSpace(l.getenv(envKey))
+	if raw == "" {
+		return fallback, nil
+	}
+	value, err := strconv.Atoi(raw)
+	if err != nil {
+		return 0, keyErrorf(envKey, "%s must be an integer", envKey)
+	}
+	// Anything below a majority lets two disagreeing addresses both reach
+	// the quorum.
+	if value < defaultQuorum(providers) || value > providers {
+		return 0, keyErrorf(envKey, "%s must be between %d and %d (a majority of the %d providers)", envKey, defaultQuorum(providers), providers, providers)
+	}
+	return value, nil
+}
+
+func defaultQuorum(providers int) int {
+	return providers/2 + 1
+}
+
+func (l *loader) parseFamilySources(prefix string, ipv4Fallback, ipv6Fallback SourceConfig) (SourceConfig, SourceConfig, error) {
+	ipv4, err := l.parseSource(prefix, "IP", ipv4Fallback)
+	if err != nil {
+		return SourceConfig{}, SourceConfig{}, err
+	}
+	ipv4, err = l.parseSource(prefix, "IPV4", ipv4)
+	if err != nil {
+		return SourceConfig{}, SourceConfig{}, err
+	}
+	ipv6, err := l.parseSource(prefix, "IP", ipv6Fallback)
+	if err != nil {
+		return SourceConfig{}, SourceConfig{}, err
 	}
+	ipv6, err = l.parseSource(prefix, "IPV6", ipv6)
+	if err != nil {
+		return SourceConfig{}, SourceConfig{}, err
+	}
+	return ipv4, ipv6, nil
+}
+
+func (l *loader) parseSource(prefix, kind string, fallback SourceConfig) (SourceConfig, error) {
+	key := prefix + kind + "_"
+	providers := parseProviders(l.getenv(key + "PROVIDER"))
+	iface := strings.TrimSpace(l.getenv(key + "INTERFACE"))
+	if len(providers) > 0 && iface != "" {
+		return SourceConfig{}, keyErrorf(key+"PROVIDER", "%sPROVIDER and %sINTERFACE are mutually exclusive", key, key)
+	}
+
+	src := fallback
+	switch {
+	case iface != "":
+		src = SourceConfig{Interface: iface, InterfaceFilter: fallback.InterfaceFilter}
+	case len(providers) > 0:
+		src = SourceConfig{Providers: providers, Quorum: defaultQuorum(len(providers)), InterfaceFilter: fallback.InterfaceFilter}
+	}
+
+	if src.Interface != "" {
+		filter, err := l.parseInterfaceFilter(key+"INTERFACE_FILTER", src.InterfaceFilter)
+		if err != nil {
+			return SourceConfig{}, err
+		}
+		src.InterfaceFilter = filter
+		return src, nil
+	}
+	quorum, err := l.parseQuorum(key+"QUORUM", src.Quorum, len(src.Providers))
+	if err != nil {
+		return SourceConfig{}, err
+	}
+	src.Quorum = quorum
+	return src, nil
+}
+
+func (l *loader) parseInterfaceFilter(envKey string, fallback InterfaceFilter) (InterfaceFilter, error) {
+	raw := strings.TrimSpace(l.getenv(envKey))
+	if raw == "" {
+		return fallback, nil
+	}
+	var filter InterfaceFilter
+	for _, part := range strings.Split(raw, ",") {
+		switch strings.ToLower(strings.TrimSpace(part)) {
+		case "":
+		case "none":
+			filter = InterfaceFilter{}
+		case "global":
+			filter.GlobalOnly = true
+		case "no-temporary":
+			filter.ExcludeTemporary = true
+		case "no-deprecated":
+			filter.ExcludeDeprecated = true
+		case "no-ula":
+			filter.ExcludeULA = true
+		default:
+			return InterfaceFilter{}, keyErrorf(envKey, "%s has unknown filter %q; use global, no-temporary, no-deprecated, no-ula or none", envKey, part)
+		}
+	}
+	if (filter.ExcludeTemporary || filter.ExcludeDeprecated) && !addrFlagsSupported {
+		return InterfaceFilter{}, keyErrorf(envKey, "%s filters no-temporary and no-deprecated are only supported on Linux", envKey)
+	}
+	return filter, nil
 }
 
 func parseRecordType(value string) (string, error) {
@@ -191,6 +572,27 @@ func parseRecordType(value string) (string, error) {
 	}
 }
 
+func parseRecordTypes(value string) ([]string, error) {
+	parts := strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == '+' })
+	out := make([]string, 0, len(parts))
+	for _, part := range parts {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		recordType, err := parseRecordType(part)
+		if err != nil {
+			return nil, err
+		}
+		if !slices.Contains(out, recordType) {
+			out = append(out, recordType)
+		}
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("RECORD_TYPE must be A, AAAA or A,AAAA")
+	}
+	return out, nil
+}
+
 func parseLogLevel(value string) (slog.Level, error) {
 	switch strings.ToLower(strings.TrimSpace(value)) {
 	case "debug":
@@ -206,7 +608,7 @@ func parseLogLevel(value string) (slog.Level, error) {
 	}
 }
 
-func parseRecords(value, fallback string) ([]RecordConfig, error) {
+func parseRecords(value, fallback string, defaultTypes []string) ([]RecordConfig, error) {
 	raw := strings.TrimSpace(value)
 	if raw == "" {
 		raw = fallback
@@ -234,6 +636,15 @@ func parseRecords(value, fallback string) ([]RecordConfig, error) {
 			}
 			ttl = &val
 		}
+		types := defaultTypes
+		if before, after, ok := strings.Cut(name, "/"); ok {
+			name = strings.TrimSpace(before)
+			parsed, err := parseRecordTypes(after)
+			if err != nil {
+				return nil, fmt.Errorf("record %q has invalid type: %w", part, err)
+			}
+			types = parsed
+		}
 		if name == "" {
 			continue
 		}
@@ -242,101 +653,294 @@ func parseRecords(value, fallback string) ([]RecordConfig, error) {
 		}
 		seen[name] = struct{}{}
 		out = append(out, RecordConfig{
-			Name: name,
-			TTL:  ttl,
+			Name:  name,
+			Types: types,
+			TTL:   ttl,
 		})
 	}
 	return out, nil
 }
 
-func parseZones(defaultRecordType string, defaultIPProvider string, defaultTTL *int) ([]ZoneConfig, error) {
-	indexes := zoneIndexesFromEnv()
+func (l *loader) applyRecordSuffixes(envKey string, records []RecordConfig) error {
+	raw := strings.TrimSpace(l.getenv(envKey))
+	if raw == "" {
+		return nil
+	}
+	for _, part := range strings.Split(raw, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(part, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return keyErrorf(envKey, "%s entry %q must be name=suffix/len", envKey, part)
+		}
+		suffix, err := parseSuffix(strings.TrimSpace(value))
+		if err != nil {
+			return keyErrorf(envKey, "%s entry %q: %w", envKey, part, err)
+		}
+		found := false
+		for i := range records {
+			if records[i].Name != name {
+				continue
+			}
+			if !slices.Contains(records[i].Types, "AAAA") {
+				return keyErrorf(envKey, "%s entry %q: record is not published as AAAA", envKey, part)
+			}
+			records[i].Suffix = suffix
+			found = true
+		}
+		if !found {
+			return keyErrorf(envKey, "%s references unknown record %q", envKey, name)
+		}
+	}
+	return nil
+}
+
+func (l *loader) applyRecordAdopt(envKey string, records []RecordConfig) error {
+	return l.applyRecordNames(envKey, records, func(record *RecordConfig) { record.Adopt = true })
+}
+
+func (l *loader) applyRecordReverse(envKey string, records []RecordConfig) error {
+	return l.applyRecordNames(envKey, records, func(record *RecordConfig) { record.Reverse = true })
+}
+
+// applyRecordNames calls apply for every record listed in the CSV at envKey.
+func (l *loader) applyRecordNames(envKey string, records []RecordConfig, apply func(*RecordConfig)) error {
+	for _, name := range strings.Split(l.getenv(envKey), ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		found := false
+		for i := range records {
+			if records[i].Name == name {
+				apply(&records[i])
+				found = true
+			}
+		}
+		if !found {
+			return keyErrorf(envKey, "%s references unknown record %q", envKey, name)
+		}
+	}
+	return nil
+}
+
+func (l *loader) parseWithdrawPolicy(envKey string, fallback WithdrawPolicy) (WithdrawPolicy, error) {
+	raw := strings.TrimSpace(l.getenv(envKey))
+	if raw == "" {
+		return fallback, nil
+	}
+	policy, err := parseWithdraw(raw)
+	if err != nil {
+		return WithdrawPolicy{}, keyErrorf(envKey, "%s %w", envKey, err)
+	}
+	return policy, nil
+}
+
+func parseWithdraw(value string) (WithdrawPolicy, error) {
+	switch strings.ToLower(value) {
+	case WithdrawKeep:
+		return WithdrawPolicy{Action: WithdrawKeep}, nil
+	case WithdrawDelete:
+		return WithdrawPolicy{Action: WithdrawDelete}, nil
+	}
+	addr := net.ParseIP(value)
+	if addr == nil {
+		return WithdrawPolicy{}, fmt.Errorf("must be keep, delete or a fallback IP address, got %q", value)
+	}
+	return WithdrawPolicy{Action: WithdrawFallback, Fallback: addr}, nil
+}
+
+func (l *loader) applyRecordWithdraw(envKey string, records []RecordConfig, fallback WithdrawPolicy) error {
+	for i := range records {
+		records[i].Withdraw = fallback
+	}
+	raw := strings.TrimSpace(l.getenv(envKey))
+	if raw == "" {
+		return nil
+	}
+	for _, part := range strings.Split(raw, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(part, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return keyErrorf(envKey, "%s entry %q must be name=keep|delete|<ip>", envKey, part)
+		}
+		policy, err := parseWithdraw(strings.TrimSpace(value))
+		if err != nil {
+			return keyErrorf(envKey, "%s entry %q %w", envKey, part, err)
+		}
+		found := false
+		for i := range records {
+			if records[i].Name != name {
+				continue
+			}
+			if policy.Action == WithdrawFallback && !slices.Contains(records[i].Types, fallbackType(policy.Fallback)) {
+				return keyErrorf(envKey, "%s entry %q: record is not published as %s", envKey, part, fallbackType(policy.Fallback))
+			}
+			records[i].Withdraw = policy
+			found = true
+		}
+		if !found {
+			return keyErrorf(envKey, "%s references unknown record %q", envKey, name)
+		}
+	}
+	return nil
+}
+
+func fallbackType(addr net.IP) string {
+	if addr.To4() != nil {
+		return "A"
+	}
+	return "AAAA"
+}
+
+func parseSuffix(value string) (*AddressSuffix, error) {
+	addrStr, lenStr, ok := strings.Cut(value, "/")
+	if !ok {
+		return nil, fmt.Errorf("suffix must include a prefix length, e.g. ::1/64")
+	}
+	addr := net.ParseIP(strings.TrimSpace(addrStr))
+	if addr == nil || addr.To4() != nil {
+		return nil, fmt.Errorf("suffix %q is not an IPv6 address", addrStr)
+	}
+	prefixLen, err := strconv.Atoi(strings.TrimSpace(lenStr))
+	if err != nil || prefixLen <= 0 || prefixLen >= 128 {
+		return nil, fmt.Errorf("prefix length %q must be between 1 and 127", lenStr)
+	}
+	return &AddressSuffix{Address: addr, PrefixLen: prefixLen}, nil
+}
+
+func (l *loader) parseZones(defaultRecordTypes []string, defaultIPv4Source, defaultIPv6Source SourceConfig, defaultTTL *int, defaultWithdraw WithdrawPolicy, defaultBackend string, defaultRFC2136 RFC2136Config) ([]ZoneConfig, error) {
+	indexes := l.indexesFromEnv("ZONE_", "_NAME")
 	if len(indexes) == 0 {
-		zoneName := strings.TrimSpace(os.Getenv("ZONE_NAME"))
+		zoneName := strings.TrimSpace(l.getenv("ZONE_NAME"))
 		if zoneName == "" {
 			return nil, nil
 		}
-		records, err := parseRecords(os.Getenv("RECORDS"), "@")
+		records, err := parseRecords(l.getenv("RECORDS"), "@", defaultRecordTypes)
 		if err != nil {
-			return nil, err
+			return nil, keyErrorf("RECORDS", "RECORDS invalid: %w", err)
 		}
 		if len(records) == 0 {
-			return nil, fmt.Errorf("RECORDS resolved to empty list")
+			return nil, keyErrorf("RECORDS", "RECORDS resolved to empty list")
+		}
+		if err := l.applyRecordSuffixes("RECORD_SUFFIXES", records); err != nil {
+			return nil, err
+		}
+		if err := l.applyRecordAdopt("ADOPT_RECORDS", records); err != nil {
+			return nil, err
+		}
+		if err := l.applyRecordReverse("REVERSE_RECORDS", records); err != nil {
+			return nil, err
+		}
+		if err := l.applyRecordWithdraw("RECORD_WITHDRAW", records, defaultWithdraw); err != nil {
+			return nil, err
+		}
+		backend, server, err := l.parseZoneBackend("", defaultBackend, defaultRFC2136)
+		if err != nil {
+			return nil, err
 		}
 		return []ZoneConfig{
 			{
-				Name:          zoneName,
-				Records:       records,
-				RecordType:    defaultRecordType,
-				IPProviderURL: defaultIPProvider,
-				TTL:           defaultTTL,
+				Name:        zoneName,
+				Records:     records,
+				RecordTypes: defaultRecordTypes,
+				IPv4Source:  defaultIPv4Source,
+				IPv6Source:  defaultIPv6Source,
+				TTL:         defaultTTL,
+				Backend:     backend,
+				RFC2136:     server,
 			},
 		}, nil
 	}
 
-	if strings.TrimSpace(os.Getenv("ZONE_NAME")) != "" {
+	if strings.TrimSpace(l.getenv("ZONE_NAME")) != "" {
 		return nil, fmt.Errorf("cannot mix ZONE_NAME with ZONE_<N>_NAME")
 	}
 
 	zones := make([]ZoneConfig, 0, len(indexes))
 	for _, index := range indexes {
 		prefix := fmt.Sprintf("ZONE_%d_", index)
-		zoneName := strings.TrimSpace(os.Getenv(prefix + "NAME"))
+		zoneName := strings.TrimSpace(l.getenv(prefix + "NAME"))
 		if zoneName == "" {
-			return nil, fmt.Errorf("%sNAME is required", prefix)
+			return nil, keyErrorf(prefix+"NAME", "%sNAME is required", prefix)
 		}
-		records, err := parseRecords(os.Getenv(prefix+"RECORDS"), "@")
+		recordTypes := defaultRecordTypes
+		if recordTypeValue := l.getEnv(prefix+"RECORD_TYPE", ""); strings.TrimSpace(recordTypeValue) != "" {
+			parsed, err := parseRecordTypes(recordTypeValue)
+			if err != nil {
+				return nil, keyErrorf(prefix+"RECORD_TYPE", "%sRECORD_TYPE invalid: %w", prefix, err)
+			}
+			recordTypes = parsed
+		}
+		records, err := parseRecords(l.getenv(prefix+"RECORDS"), "@", recordTypes)
 		if err != nil {
-			return nil, fmt.Errorf("%sRECORDS invalid: %w", prefix, err)
+			return nil, keyErrorf(prefix+"RECORDS", "%sRECORDS invalid: %w", prefix, err)
 		}
 		if len(records) == 0 {
-			return nil, fmt.Errorf("%sRECORDS resolved to empty list", prefix)
+			return nil, keyErrorf(prefix+"RECORDS", "%sRECORDS resolved to empty list", prefix)
 		}
-		recordTypeValue := getEnv(prefix+"RECORD_TYPE", "")
-		recordType := defaultRecordType
-		if strings.TrimSpace(recordTypeValue) != "" {
-			parsed, err := parseRecordType(recordTypeValue)
-			if err != nil {
-				return nil, fmt.Errorf("%sRECORD_TYPE invalid: %w", prefix, err)
-			}
-			recordType = parsed
+		if err := l.applyRecordSuffixes(prefix+"RECORD_SUFFIXES", records); err != nil {
+			return nil, err
+		}
+		if err := l.applyRecordAdopt(prefix+"ADOPT_RECORDS", records); err != nil {
+			return nil, err
 		}
-		ttl, err := parseTTL(prefix + "TTL")
+		if err := l.applyRecordReverse(prefix+"REVERSE_RECORDS", records); err != nil {
+			return nil, err
+		}
+		zoneWithdraw, err := l.parseWithdrawPolicy(prefix+"WITHDRAW_POLICY", defaultWithdraw)
+		if err != nil {
+			return nil, err
+		}
+		if err := l.applyRecordWithdraw(prefix+"RECORD_WITHDRAW", records, zoneWithdraw); err != nil {
+			return nil, err
+		}
+		ttl, err := l.parseTTL(prefix + "TTL")
 		if err != nil {
 			return nil, err
 		}
 		if ttl == nil {
 			ttl = defaultTTL
 		}
-		ipProvider := strings.TrimSpace(getEnv(prefix+"IP_PROVIDER", ""))
-		if ipProvider == "" {
-			ipProvider = defaultIPProvider
+		ipv4Source, ipv6Source, err := l.parseFamilySources(prefix, defaultIPv4Source, defaultIPv6Source)
+		if err != nil {
+			return nil, err
+		}
+		backend, server, err := l.parseZoneBackend(prefix, defaultBackend, defaultRFC2136)
+		if err != nil {
+			return nil, err
 		}
 		zones = append(zones, ZoneConfig{
-			Name:          zoneName,
-			Records:       records,
-			RecordType:    recordType,
-			IPProviderURL: ipProvider,
-			TTL:           ttl,
+			Name:        zoneName,
+			Records:     records,
+			RecordTypes: recordTypes,
+			IPv4Source:  ipv4Source,
+			IPv6Source:  ipv6Source,
+			TTL:         ttl,
+			Backend:     backend,
+			RFC2136:     server,
 		})
 	}
 
 	return zones, nil
 }
 
-func zoneIndexesFromEnv() []int {
+// indexesFromEnv returns the sorted N of all prefix<N>suffix keys.
+func (l *loader) indexesFromEnv(prefix, suffix string) []int {
 	var indexes []int
 	seen := make(map[int]struct{})
-	for _, env := range os.Environ() {
-		parts := strings.SplitN(env, "=", 2)
-		if len(parts) == 0 {
+	for _, key := range l.keys() {
+		if !strings.HasPrefix(key, prefix) || !strings.HasSuffix(key, suffix) {
 			continue
 		}
-		key := parts[0]
-		if !strings.HasPrefix(key, "ZONE_") || !strings.HasSuffix(key, "_NAME") {
-			continue
-		}
-		indexStr := strings.TrimSuffix(strings.TrimPrefix(key, "ZONE_"), "_NAME")
+		indexStr := strings.TrimSuffix(strings.TrimPrefix(key, prefix), suffix)
 		index, err := strconv.Atoi(indexStr)
 		if err != nil || index <= 0 {
 			continue
@@ -360,24 +964,29 @@ func zoneIndexesFromEnv() []int {
 	return indexes
 }
 
-func getEnv(key, fallback string) string {
-	if value, ok := os.LookupEnv(key); ok {
+func (l *loader) getEnv(key, fallback string) string {
+	if value, ok := l.lookup(key); ok {
 		return value
 	}
 	return fallback
 }
 
-func parseTTL(envKey string) (*int, error) {
-	raw := strings.TrimSpace(os.Getenv(envKey))
+func (l *loader) getenv(key string) string {
+	value, _ := l.lookup(key)
+	return value
+}
+
+func (l *loader) parseTTL(envKey string) (*int, error) {
+	raw := strings.TrimSpace(l.getenv(envKey))
 	if raw == "" {
 		return nil, nil
 	}
 	value, err := strconv.Atoi(raw)
 	if err != nil {
-		return nil, fmt.Errorf("%s must be an integer (seconds)", envKey)
+		return nil, keyErrorf(envKey, "%s must be an integer (seconds)", envKey)
 	}
 	if value <= 0 {
-		return nil, fmt.Errorf("%s must be greater than zero", envKey)
+		return nil, keyErrorf(envKey, "%s must be greater than zero", envKey)
 	}
 	return &value, nil
 }
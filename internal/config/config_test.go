@@ -0,0 +1,64 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func setenv(t *testing.T, values map[string]string) {
+	t.Helper()
+	for key, value := range values {
+		t.Setenv(key, value)
+	}
+}
+
+func TestQuorumMustBeMajority(t *testing.T) {
+	setenv(t, map[string]string{
+		"HETZNER_TOKEN": "token",
+		"ZONE_NAME":     "example.com",
+		"IP_PROVIDER":   "https://a.example,https://b.example,https://c.example,https://d.example",
+		"IP_QUORUM":     "2",
+	})
+	_, err := Load("")
+	if err == nil || !strings.Contains(err.Error(), "IP_QUORUM must be between 3 and 4") {
+		t.Fatalf("got %v, want majority error", err)
+	}
+
+	t.Setenv("IP_QUORUM", "3")
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if got := cfg.Zones[0].IPv4Source.Quorum; got != 3 {
+		t.Fatalf("quorum = %d, want 3", got)
+	}
+}
+
+func TestPruneStaleValuesNeedsStateFile(t *testing.T) {
+	setenv(t, map[string]string{
+		"HETZNER_TOKEN": "token",
+		"ZONE_NAME":     "example.com",
+	})
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.PruneStaleValues {
+		t.Fatal("pruning enabled without STATE_FILE")
+	}
+
+	t.Setenv("STATE_FILE", "/tmp/ddns-state.json")
+	cfg, err = Load("")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if !cfg.PruneStaleValues {
+		t.Fatal("pruning disabled with STATE_FILE")
+	}
+
+	t.Setenv("STATE_FILE", "")
+	t.Setenv("PRUNE_STALE_VALUES", "true")
+	if _, err := Load(""); err == nil || !strings.Contains(err.Error(), "PRUNE_STALE_VALUES needs STATE_FILE") {
+		t.Fatalf("got %v, want STATE_FILE error", err)
+	}
+}
@@ -0,0 +1,100 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// DynDNSClient is a router that pushes its address for some of the configured
+// records through the DynDNS2 update server, authenticating with basic auth.
+type DynDNSClient struct {
+	Username  string
+	Password  string
+	Hostnames []string
+}
+
+// parseDynDNS reads DYNDNS_LISTEN_ADDR and the clients, given as DYNDNS_* or
+// DYNDNS_<N>_* like firewalls. Every hostname must be a configured record.
+func (l *loader) parseDynDNS(zones []ZoneConfig) (string, []DynDNSClient, error) {
+	listenAddr := strings.TrimSpace(l.getenv("DYNDNS_LISTEN_ADDR"))
+	var clients []DynDNSClient
+	indexes := l.indexesFromEnv("DYNDNS_", "_USERNAME")
+	if len(indexes) == 0 {
+		if strings.TrimSpace(l.getenv("DYNDNS_USERNAME")) != "" {
+			client, err := l.parseDynDNSClient("DYNDNS_", zones)
+			if err != nil {
+				return "", nil, err
+			}
+			clients = append(clients, client)
+		}
+	} else {
+		if strings.TrimSpace(l.getenv("DYNDNS_USERNAME")) != "" {
+			return "", nil, fmt.Errorf("cannot mix DYNDNS_USERNAME with DYNDNS_<N>_USERNAME")
+		}
+		for _, index := range indexes {
+			client, err := l.parseDynDNSClient(fmt.Sprintf("DYNDNS_%d_", index), zones)
+			if err != nil {
+				return "", nil, err
+			}
+			if slices.ContainsFunc(clients, func(other DynDNSClient) bool { return other.Username == client.Username }) {
+				return "", nil, fmt.Errorf("DynDNS client %s is configured more than once", client.Username)
+			}
+			clients = append(clients, client)
+		}
+	}
+	if listenAddr == "" && len(clients) > 0 {
+		return "", nil, keyErrorf("DYNDNS_LISTEN_ADDR", "DYNDNS_LISTEN_ADDR is required when DynDNS clients are configured")
+	}
+	if listenAddr != "" && len(clients) == 0 {
+		return "", nil, keyErrorf("DYNDNS_LISTEN_ADDR", "DYNDNS_LISTEN_ADDR is set but no DynDNS clients are configured; use DYNDNS_USERNAME or DYNDNS_<N>_USERNAME")
+	}
+	return listenAddr, clients, nil
+}
+
+func (l *loader) parseDynDNSClient(prefix string, zones []ZoneConfig) (DynDNSClient, error) {
+	username := strings.TrimSpace(l.getenv(prefix + "USERNAME"))
+	if username == "" {
+		return DynDNSClient{}, keyErrorf(prefix+"USERNAME", "%sUSERNAME is required", prefix)
+	}
+	if strings.Contains(username, ":") {
+		return DynDNSClient{}, keyErrorf(prefix+"USERNAME", "%sUSERNAME must not contain ':'", prefix)
+	}
+	password := l.getenv(prefix + "PASSWORD")
+	if password == "" {
+		return DynDNSClient{}, keyErrorf(prefix+"PASSWORD", "%sPASSWORD is required", prefix)
+	}
+	var hostnames []string
+	for _, hostname := range strings.Split(l.getenv(prefix+"HOSTNAMES"), ",") {
+		hostname = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(hostname), "."))
+		if hostname == "" || slices.Contains(hostnames, hostname) {
+			continue
+		}
+		if !hasRecord(zones, hostname) {
+			return DynDNSClient{}, keyErrorf(prefix+"HOSTNAMES", "%sHOSTNAMES: %s is not a configured record", prefix, hostname)
+		}
+		hostnames = append(hostnames, hostname)
+	}
+	if len(hostnames) == 0 {
+		return DynDNSClient{}, keyErrorf(prefix+"HOSTNAMES", "%sHOSTNAMES is required; list the record names the client may update", prefix)
+	}
+	return DynDNSClient{Username: username, Password: password, Hostnames: hostnames}, nil
+}
+
+func hasRecord(zones []ZoneConfig, hostname string) bool {
+	for _, zone := range zones {
+		for _, record := range zone.Records {
+			if strings.EqualFold(recordHostname(zone.Name, record.Name), hostname) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func recordHostname(zoneName, recordName string) string {
+	if recordName == "@" {
+		return zoneName
+	}
+	return recordName + "." + zoneName
+}
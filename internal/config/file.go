@@ -0,0 +1,377 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// The config file is flattened onto the same keys as the environment, so
+// `zones[0].records` becomes ZONE_1_RECORDS and every value goes through the
+// same validation. Environment variables win over file values.
+
+type fileValue struct {
+	value string
+	line  int
+	field string
+}
+
+type loader struct {
+	path string
+	file map[string]fileValue
+}
+
+func (l *loader) lookup(key string) (string, bool) {
+	if value, ok := os.LookupEnv(key); ok {
+		return value, true
+	}
+	if value, ok := l.file[key]; ok {
+		return value.value, true
+	}
+	return "", false
+}
+
+func (l *loader) keys() []string {
+	keys := make([]string, 0, len(l.file))
+	for key := range l.file {
+		keys = append(keys, key)
+	}
+	for _, env := range os.Environ() {
+		key, _, _ := strings.Cut(env, "=")
+		if _, inFile := l.file[key]; !inFile {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// keyError ties a validation error to the setting it is about, so Load can
+// point at the line of the config file the value came from.
+type keyError struct {
+	key string
+	err error
+}
+
+func (e *keyError) Error() string {
+	return e.err.Error()
+}
+
+func (e *keyError) Unwrap() error {
+	return e.err
+}
+
+func keyErrorf(key, format string, args ...any) error {
+	return &keyError{key: key, err: fmt.Errorf(format, args...)}
+}
+
+func (l *loader) annotate(err error) error {
+	var keyErr *keyError
+	if !errors.As(err, &keyErr) {
+		return err
+	}
+	if _, fromEnv := os.LookupEnv(keyErr.key); fromEnv {
+		return err
+	}
+	value, ok := l.file[keyErr.key]
+	if !ok {
+		return err
+	}
+	return fmt.Errorf("%s:%d (%s): %w", l.path, value.line, value.field, err)
+}
+
+type flattener struct {
+	path   string
+	values map[string]fileValue
+}
+
+func readFile(path string) (map[string]fileValue, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read config file: %w", err)
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(raw, &doc); err != nil {
+		return nil, fmt.Errorf("parse config file %s: %w", path, err)
+	}
+	f := &flattener{path: path, values: make(map[string]fileValue)}
+	if len(doc.Content) == 0 {
+		return f.values, nil
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, f.errorf(root, "top level must be a mapping")
+	}
+	if err := f.mapping(root, "", ""); err != nil {
+		return nil, err
+	}
+	return f.values, nil
+}
+
+func (f *flattener) errorf(node *yaml.Node, format string, args ...any) error {
+	return fmt.Errorf("%s:%d: %s", f.path, node.Line, fmt.Sprintf(format, args...))
+}
+
+func (f *flattener) set(key, value string, node *yaml.Node, field string) error {
+	if existing, ok := f.values[key]; ok {
+		if existing.field == field {
+			return f.errorf(node, "duplicate key %s (first set on line %d)", field, existing.line)
+		}
+		return f.errorf(node, "%s conflicts with %s on line %d", field, existing.field, existing.line)
+	}
+	f.values[key] = fileValue{value: value, line: node.Line, field: field}
+	return nil
+}
+
+func (f *flattener) mapping(node *yaml.Node, keyPrefix, fieldPrefix string) error {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		keyNode, valueNode := node.Content[i], resolveAlias(node.Content[i+1])
+		name := strings.TrimSpace(keyNode.Value)
+		if name == "" {
+			return f.errorf(keyNode, "empty key")
+		}
+		field := name
+		if fieldPrefix != "" {
+			field = fieldPrefix + "." + name
+		}
+		key := keyPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+
+		switch {
+		case name == "zones" && keyPrefix == "":
+			if err := f.list(valueNode, "zones", "ZONE_"); err != nil {
+				return err
+			}
+		case name == "webhooks" && keyPrefix == "":
+			if err := f.list(valueNode, "webhooks", "WEBHOOK_"); err != nil {
+				return err
+			}
+		case name == "firewalls" && keyPrefix == "":
+			if err := f.list(valueNode, "firewalls", "FIREWALL_"); err != nil {
+				return err
+			}
+		case name == "clients" && keyPrefix == "DYNDNS_":
+			if err := f.list(valueNode, field, "DYNDNS_"); err != nil {
+				return err
+			}
+		case name == "headers" && valueNode.Kind == yaml.MappingNode:
+			if err := f.headers(valueNode, key, field); err != nil {
+				return err
+			}
+		case name == "records":
+			if err := f.records(valueNode, keyPrefix, field); err != nil {
+				return err
+			}
+		case valueNode.Kind == yaml.ScalarNode:
+			if valueNode.Tag == "!!null" {
+				continue
+			}
+			if err := f.set(key, valueNode.Value, valueNode, field); err != nil {
+				return err
+			}
+		case valueNode.Kind == yaml.SequenceNode:
+			items, err := f.scalars(valueNode, field)
+			if err != nil {
+				return err
+			}
+			if err := f.set(key, strings.Join(items, ","), valueNode, field); err != nil {
+				return err
+			}
+		case valueNode.Kind == yaml.MappingNode:
+			if err := f.mapping(valueNode, key+"_", field); err != nil {
+				return err
+			}
+		default:
+			return f.errorf(valueNode, "%s has unsupported value", field)
+		}
+	}
+	return nil
+}
+
+func (f *flattener) scalars(node *yaml.Node, field string) ([]string, error) {
+	items := make([]string, 0, len(node.Content))
+	for i, item := range node.Content {
+		item = resolveAlias(item)
+		if item.Kind != yaml.ScalarNode {
+			return nil, f.errorf(item, "%s[%d] must be a scalar", field, i)
+		}
+		items = append(items, item.Value)
+	}
+	return items, nil
+}
+
+// list flattens a list of mappings onto numbered keys, so zones[0].name
+// becomes ZONE_1_NAME.
+func (f *flattener) list(node *yaml.Node, field, keyPrefix string) error {
+	if node.Kind != yaml.SequenceNode {
+		return f.errorf(node, "%s must be a list", field)
+	}
+	for i, item := range node.Content {
+		item = resolveAlias(item)
+		if item.Kind != yaml.MappingNode {
+			return f.errorf(item, "%s[%d] must be a mapping", field, i)
+		}
+		if err := f.mapping(item, fmt.Sprintf("%s%d_", keyPrefix, i+1), fmt.Sprintf("%s[%d]", field, i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *flattener) headers(node *yaml.Node, key, field string) error {
+	entries := make([]string, 0, len(node.Content)/2)
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		name, value := node.Content[i], resolveAlias(node.Content[i+1])
+		if value.Kind != yaml.ScalarNode {
+			return f.errorf(value, "%s.%s must be a scalar", field, name.Value)
+		}
+		if strings.Contains(value.Value, ",") {
+			return f.errorf(value, "%s.%s must not contain commas", field, name.Value)
+		}
+		entries = append(entries, name.Value+"="+value.Value)
+	}
+	return f.set(key, strings.Join(entries, ","), node, field)
+}
+
+func (f *flattener) records(node *yaml.Node, keyPrefix, field string) error {
+	if node.Kind == yaml.ScalarNode {
+		return f.set(keyPrefix+"RECORDS", node.Value, node, field)
+	}
+	if node.Kind != yaml.SequenceNode {
+		return f.errorf(node, "%s must be a list", field)
+	}
+	entries := make([]string, 0, len(node.Content))
+	var suffixes, adopted, reversed, withdrawals []string
+	var suffixNode, adoptNode, reverseNode, withdrawNode *yaml.Node
+	for i, item := range node.Content {
+		item = resolveAlias(item)
+		itemField := fmt.Sprintf("%s[%d]", field, i)
+		if item.Kind == yaml.ScalarNode {
+			if strings.ContainsAny(item.Value, ",") {
+				return f.errorf(item, "%s must be a single record name", itemField)
+			}
+			entries = append(entries, item.Value)
+			continue
+		}
+		if item.Kind != yaml.MappingNode {
+			return f.errorf(item, "%s must be a name or a mapping", itemField)
+		}
+
+		var name, types, ttl, suffix, withdraw string
+		var adopt, reverse bool
+		for j := 0; j+1 < len(item.Content); j += 2 {
+			k, v := item.Content[j], resolveAlias(item.Content[j+1])
+			var value string
+			if v.Kind == yaml.SequenceNode {
+				values, err := f.scalars(v, itemField+"."+k.Value)
+				if err != nil {
+					return err
+				}
+				value = strings.Join(values, "+")
+			} else if v.Kind == yaml.ScalarNode {
+				value = strings.TrimSpace(v.Value)
+			} else {
+				return f.errorf(v, "%s.%s has unsupported value", itemField, k.Value)
+			}
+			switch k.Value {
+			case "name":
+				name = value
+			case "type", "types":
+				types = value
+			case "ttl":
+				parsed, err := strconv.Atoi(value)
+				if err != nil || parsed <= 0 {
+					return f.errorf(v, "%s.ttl must be a positive integer (seconds)", itemField)
+				}
+				ttl = value
+			case "suffix":
+				suffix = value
+				if suffixNode == nil {
+					suffixNode = v
+				}
+			case "adopt":
+				parsed, err := strconv.ParseBool(value)
+				if err != nil {
+					return f.errorf(v, "%s.adopt must be true or false", itemField)
+				}
+				adopt = parsed
+				if adoptNode == nil {
+					adoptNode = v
+				}
+			case "reverse":
+				parsed, err := strconv.ParseBool(value)
+				if err != nil {
+					return f.errorf(v, "%s.reverse must be true or false", itemField)
+				}
+				reverse = parsed
+				if reverseNode == nil {
+					reverseNode = v
+				}
+			case "withdraw":
+				withdraw = value
+				if withdrawNode == nil {
+					withdrawNode = v
+				}
+			default:
+				return f.errorf(k, "%s has unknown field %q", itemField, k.Value)
+			}
+		}
+		if name == "" {
+			return f.errorf(item, "%s.name is required", itemField)
+		}
+		if strings.ContainsAny(name, ",:/=") {
+			return f.errorf(item, "%s.name %q contains invalid characters", itemField, name)
+		}
+		entry := name
+		if types != "" {
+			entry += "/" + types
+		}
+		if ttl != "" {
+			entry += ":" + ttl
+		}
+		entries = append(entries, entry)
+		if suffix != "" {
+			suffixes = append(suffixes, name+"="+suffix)
+		}
+		if adopt {
+			adopted = append(adopted, name)
+		}
+		if reverse {
+			reversed = append(reversed, name)
+		}
+		if withdraw != "" {
+			withdrawals = append(withdrawals, name+"="+withdraw)
+		}
+	}
+	if err := f.set(keyPrefix+"RECORDS", strings.Join(entries, ","), node, field); err != nil {
+		return err
+	}
+	if len(suffixes) > 0 {
+		if err := f.set(keyPrefix+"RECORD_SUFFIXES", strings.Join(suffixes, ","), suffixNode, field+"[].suffix"); err != nil {
+			return err
+		}
+	}
+	if len(adopted) > 0 {
+		if err := f.set(keyPrefix+"ADOPT_RECORDS", strings.Join(adopted, ","), adoptNode, field+"[].adopt"); err != nil {
+			return err
+		}
+	}
+	if len(reversed) > 0 {
+		if err := f.set(keyPrefix+"REVERSE_RECORDS", strings.Join(reversed, ","), reverseNode, field+"[].reverse"); err != nil {
+			return err
+		}
+	}
+	if len(withdrawals) > 0 {
+		return f.set(keyPrefix+"RECORD_WITHDRAW", strings.Join(withdrawals, ","), withdrawNode, field+"[].withdraw")
+	}
+	return nil
+}
+
+func resolveAlias(node *yaml.Node) *yaml.Node {
+	for node.Kind == yaml.AliasNode && node.Alias != nil {
+		node = node.Alias
+	}
+	return node
+}
@@ -0,0 +1,53 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadAnnotatesFileLine(t *testing.T) {
+	path := writeConfig(t, `hetzner_token: token
+retry_base_delay: 2s
+retry_max_delay: 1s
+zones:
+  - name: example.com
+    ttl: -5
+`)
+	_, err := Load(path)
+	if err == nil || !strings.HasPrefix(err.Error(), path+":3 (retry_max_delay): ") {
+		t.Fatalf("got %v, want error at line 3", err)
+	}
+
+	path = writeConfig(t, `hetzner_token: token
+zones:
+  - name: example.com
+    ttl: -5
+`)
+	_, err = Load(path)
+	if err == nil || !strings.HasPrefix(err.Error(), path+":4 (zones[0].ttl): ") {
+		t.Fatalf("got %v, want error at line 4", err)
+	}
+}
+
+func TestLoadRejectsDuplicateKeys(t *testing.T) {
+	path := writeConfig(t, `hetzner_token: token
+zone_name: example.com
+interval: 5m
+interval: 10m
+`)
+	_, err := Load(path)
+	if err == nil || !strings.Contains(err.Error(), "duplicate key interval (first set on line 3)") {
+		t.Fatalf("got %v, want duplicate key error", err)
+	}
+}
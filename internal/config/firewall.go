@@ -0,0 +1,85 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// FirewallConfig is a Hetzner Cloud Firewall whose rules, picked by their
+// description, get the observed address as source (incoming rules) or
+// destination (outgoing rules).
+type FirewallConfig struct {
+	Name        string
+	Rules       []string
+	RecordTypes []string
+	IPv4Source  SourceConfig
+	IPv6Source  SourceConfig
+}
+
+// parseFirewalls reads FIREWALL_NAME or FIREWALL_<N>_NAME, following the same
+// single/numbered scheme as zones.
+func (l *loader) parseFirewalls(defaultRecordTypes []string, defaultIPv4Source, defaultIPv6Source SourceConfig) ([]FirewallConfig, error) {
+	indexes := l.indexesFromEnv("FIREWALL_", "_NAME")
+	if len(indexes) == 0 {
+		if strings.TrimSpace(l.getenv("FIREWALL_NAME")) == "" {
+			return nil, nil
+		}
+		firewall, err := l.parseFirewall("FIREWALL_", defaultRecordTypes, defaultIPv4Source, defaultIPv6Source)
+		if err != nil {
+			return nil, err
+		}
+		return []FirewallConfig{firewall}, nil
+	}
+	if strings.TrimSpace(l.getenv("FIREWALL_NAME")) != "" {
+		return nil, fmt.Errorf("cannot mix FIREWALL_NAME with FIREWALL_<N>_NAME")
+	}
+	firewalls := make([]FirewallConfig, 0, len(indexes))
+	for _, index := range indexes {
+		firewall, err := l.parseFirewall(fmt.Sprintf("FIREWALL_%d_", index), defaultRecordTypes, defaultIPv4Source, defaultIPv6Source)
+		if err != nil {
+			return nil, err
+		}
+		if slices.ContainsFunc(firewalls, func(other FirewallConfig) bool { return other.Name == firewall.Name }) {
+			return nil, fmt.Errorf("firewall %s is configured more than once", firewall.Name)
+		}
+		firewalls = append(firewalls, firewall)
+	}
+	return firewalls, nil
+}
+
+func (l *loader) parseFirewall(prefix string, defaultRecordTypes []string, defaultIPv4Source, defaultIPv6Source SourceConfig) (FirewallConfig, error) {
+	name := strings.TrimSpace(l.getenv(prefix + "NAME"))
+	if name == "" {
+		return FirewallConfig{}, keyErrorf(prefix+"NAME", "%sNAME is required", prefix)
+	}
+	var rules []string
+	for _, rule := range strings.Split(l.getenv(prefix+"RULES"), ",") {
+		rule = strings.TrimSpace(rule)
+		if rule != "" && !slices.Contains(rules, rule) {
+			rules = append(rules, rule)
+		}
+	}
+	if len(rules) == 0 {
+		return FirewallConfig{}, keyErrorf(prefix+"RULES", "%sRULES is required; list the descriptions of the rules to update", prefix)
+	}
+	recordTypes := defaultRecordTypes
+	if value := l.getenv(prefix + "RECORD_TYPE"); strings.TrimSpace(value) != "" {
+		parsed, err := parseRecordTypes(value)
+		if err != nil {
+			return FirewallConfig{}, keyErrorf(prefix+"RECORD_TYPE", "%sRECORD_TYPE invalid: %w", prefix, err)
+		}
+		recordTypes = parsed
+	}
+	ipv4Source, ipv6Source, err := l.parseFamilySources(prefix, defaultIPv4Source, defaultIPv6Source)
+	if err != nil {
+		return FirewallConfig{}, err
+	}
+	return FirewallConfig{
+		Name:        name,
+		Rules:       rules,
+		RecordTypes: recordTypes,
+		IPv4Source:  ipv4Source,
+		IPv6Source:  ipv6Source,
+	}, nil
+}
@@ -0,0 +1,5 @@
+package config
+
+// addrFlagsSupported reports whether the temporary and deprecated flags of
+// IPv6 addresses can be read on this platform.
+const addrFlagsSupported = true
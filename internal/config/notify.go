@@ -0,0 +1,228 @@
+package config
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"text/template"
+)
+
+// Event names emitted by the updater, see internal/notify.
+var notifyEvents = []string{"ip_changed", "record_created", "record_updated", "record_failed", "sync_recovered"}
+
+const (
+	ChatNtfy       = "ntfy"
+	ChatGotify     = "gotify"
+	ChatSlack      = "slack"
+	ChatMattermost = "mattermost"
+	ChatTelegram   = "telegram"
+	ChatDiscord    = "discord"
+)
+
+var chatServices = []string{ChatNtfy, ChatGotify, ChatSlack, ChatMattermost, ChatTelegram, ChatDiscord}
+
+type WebhookConfig struct {
+	URL     string
+	Secret  string
+	Headers http.Header
+	Filter  NotifyFilter
+}
+
+// ChatConfig is one chat or push service. Which fields are used depends on
+// the service: URL is the server or API base URL for ntfy, Gotify and
+// Telegram and the incoming webhook for the others; Channel is the ntfy topic
+// or the Telegram chat ID.
+type ChatConfig struct {
+	Service  string
+	URL      string
+	Token    string
+	Channel  string
+	Template string
+	Filter   NotifyFilter
+}
+
+// NotifyFilter limits a notification target to some events and zones; empty
+// lists mean all.
+type NotifyFilter struct {
+	Events []string
+	Zones  []string
+}
+
+// parseWebhooks reads WEBHOOK_URL or WEBHOOK_<N>_URL, following the same
+// single/numbered scheme as zones.
+func (l *loader) parseWebhooks(zones []ZoneConfig) ([]WebhookConfig, error) {
+	indexes := l.indexesFromEnv("WEBHOOK_", "_URL")
+	if len(indexes) == 0 {
+		if strings.TrimSpace(l.getenv("WEBHOOK_URL")) == "" {
+			return nil, nil
+		}
+		webhook, err := l.parseWebhook("WEBHOOK_", zones)
+		if err != nil {
+			return nil, err
+		}
+		return []WebhookConfig{webhook}, nil
+	}
+	if strings.TrimSpace(l.getenv("WEBHOOK_URL")) != "" {
+		return nil, fmt.Errorf("cannot mix WEBHOOK_URL with WEBHOOK_<N>_URL")
+	}
+	webhooks := make([]WebhookConfig, 0, len(indexes))
+	for _, index := range indexes {
+		webhook, err := l.parseWebhook(fmt.Sprintf("WEBHOOK_%d_", index), zones)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, webhook)
+	}
+	return webhooks, nil
+}
+
+func (l *loader) parseWebhook(prefix string, zones []ZoneConfig) (WebhookConfig, error) {
+	webhookURL, err := l.parseURL(prefix+"URL", "")
+	if err != nil {
+		return WebhookConfig{}, err
+	}
+	headers, err := l.parseHeaders(prefix + "HEADERS")
+	if err != nil {
+		return WebhookConfig{}, err
+	}
+	filter, err := l.parseNotifyFilter(prefix, zones)
+	if err != nil {
+		return WebhookConfig{}, err
+	}
+	return WebhookConfig{
+		URL:     webhookURL,
+		Secret:  strings.TrimSpace(l.getenv(prefix + "SECRET")),
+		Headers: headers,
+		Filter:  filter,
+	}, nil
+}
+
+func (l *loader) parseChats(zones []ZoneConfig) ([]ChatConfig, error) {
+	var chats []ChatConfig
+	for _, service := range chatServices {
+		chat, ok, err := l.parseChat(service, zones)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			chats = append(chats, chat)
+		}
+	}
+	return chats, nil
+}
+
+// parseChat reads the <SERVICE>_* settings; the service is enabled by its
+// topic, token or webhook URL.
+func (l *loader) parseChat(service string, zones []ZoneConfig) (ChatConfig, bool, error) {
+	prefix := strings.ToUpper(service) + "_"
+	chat := ChatConfig{Service: service}
+	var err error
+	switch service {
+	case ChatNtfy:
+		chat.Channel = strings.TrimSpace(l.getenv(prefix + "TOPIC"))
+		if chat.Channel == "" {
+			return ChatConfig{}, false, nil
+		}
+		if strings.Contains(chat.Channel, "/") {
+			return ChatConfig{}, false, keyErrorf(prefix+"TOPIC", "%sTOPIC must not contain '/'", prefix)
+		}
+		chat.Token = strings.TrimSpace(l.getenv(prefix + "TOKEN"))
+		chat.URL, err = l.parseURL(prefix+"URL", "https://ntfy.sh")
+	case ChatGotify:
+		chat.Token = strings.TrimSpace(l.getenv(prefix + "TOKEN"))
+		if chat.Token == "" && strings.TrimSpace(l.getenv(prefix+"URL")) == "" {
+			return ChatConfig{}, false, nil
+		}
+		if chat.Token == "" {
+			return ChatConfig{}, false, keyErrorf(prefix+"TOKEN", "%sTOKEN is required with %sURL", prefix, prefix)
+		}
+		chat.URL, err = l.parseURL(prefix+"URL", "")
+	case ChatTelegram:
+		chat.Token = strings.TrimSpace(l.getenv(prefix + "BOT_TOKEN"))
+		chat.Channel = strings.TrimSpace(l.getenv(prefix + "CHAT_ID"))
+		if chat.Token == "" && chat.Channel == "" {
+			return ChatConfig{}, false, nil
+		}
+		if chat.Token == "" || chat.Channel == "" {
+			return ChatConfig{}, false, keyErrorf(prefix+"BOT_TOKEN", "%sBOT_TOKEN and %sCHAT_ID must both be set", prefix, prefix)
+		}
+		chat.URL, err = l.parseURL(prefix+"API_URL", "https://api.telegram.org")
+	default:
+		if strings.TrimSpace(l.getenv(prefix+"WEBHOOK_URL")) == "" {
+			return ChatConfig{}, false, nil
+		}
+		chat.URL, err = l.parseURL(prefix+"WEBHOOK_URL", "")
+	}
+	if err != nil {
+		return ChatConfig{}, false, err
+	}
+
+	chat.Template = l.getenv(prefix + "TEMPLATE")
+	if strings.TrimSpace(chat.Template) != "" {
+		if _, err := template.New(service).Parse(chat.Template); err != nil {
+			return ChatConfig{}, false, keyErrorf(prefix+"TEMPLATE", "%sTEMPLATE invalid: %w", prefix, err)
+		}
+	}
+	chat.Filter, err = l.parseNotifyFilter(prefix, zones)
+	if err != nil {
+		return ChatConfig{}, false, err
+	}
+	return chat, true, nil
+}
+
+func (l *loader) parseURL(envKey, fallback string) (string, error) {
+	raw := strings.TrimRight(strings.TrimSpace(l.getEnv(envKey, fallback)), "/")
+	parsed, err := url.Parse(raw)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return "", keyErrorf(envKey, "%s must be an http(s) URL", envKey)
+	}
+	return raw, nil
+}
+
+func (l *loader) parseHeaders(envKey string) (http.Header, error) {
+	headers := make(http.Header)
+	for _, part := range strings.Split(l.getenv(envKey), ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(part, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" || strings.ContainsAny(name, " :") {
+			return nil, keyErrorf(envKey, "%s entry %q must be Name=value", envKey, part)
+		}
+		headers.Add(name, strings.TrimSpace(value))
+	}
+	return headers, nil
+}
+
+func (l *loader) parseNotifyFilter(prefix string, zones []ZoneConfig) (NotifyFilter, error) {
+	var filter NotifyFilter
+	for _, event := range strings.Split(l.getenv(prefix+"EVENTS"), ",") {
+		event = strings.ToLower(strings.TrimSpace(event))
+		if event == "" {
+			continue
+		}
+		if !slices.Contains(notifyEvents, event) {
+			return NotifyFilter{}, keyErrorf(prefix+"EVENTS", "%sEVENTS contains unknown event %q (valid: %s)", prefix, event, strings.Join(notifyEvents, ", "))
+		}
+		if !slices.Contains(filter.Events, event) {
+			filter.Events = append(filter.Events, event)
+		}
+	}
+	for _, zone := range strings.Split(l.getenv(prefix+"ZONES"), ",") {
+		zone = strings.TrimSpace(zone)
+		if zone == "" {
+			continue
+		}
+		if !slices.ContainsFunc(zones, func(z ZoneConfig) bool { return z.Name == zone }) {
+			return NotifyFilter{}, keyErrorf(prefix+"ZONES", "%sZONES references unknown zone %q", prefix, zone)
+		}
+		if !slices.Contains(filter.Zones, zone) {
+			filter.Zones = append(filter.Zones, zone)
+		}
+	}
+	return filter, nil
+}
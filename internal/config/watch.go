@@ -0,0 +1,29 @@
+package config
+
+import (
+	"context"
+	"os"
+	"time"
+)
+
+func Watch(ctx context.Context, path string, interval time.Duration, onChange func()) {
+	last, _ := os.Stat(path)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			current, err := os.Stat(path)
+			if err != nil {
+				continue
+			}
+			if last != nil && current.ModTime().Equal(last.ModTime()) && current.Size() == last.Size() {
+				continue
+			}
+			last = current
+			onChange()
+		}
+	}
+}
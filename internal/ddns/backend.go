@@ -0,0 +1,407 @@
+package ddns
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"hetzner-ddns/internal/config"
+	"hetzner-ddns/internal/dnsconsole"
+	"hetzner-ddns/internal/rfc2136"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+)
+
+// dnsBackend is the record API behind a zone. Records are exchanged as hcloud
+// RRSets, the Cloud API's own model; other backends convert to and from it.
+// GetZone and GetRRSet return nil without an error when nothing exists.
+type dnsBackend interface {
+	GetZone(ctx context.Context, name string) (*hcloud.Zone, error)
+	GetRRSet(ctx context.Context, zone *hcloud.Zone, name string, rrType hcloud.ZoneRRSetType) (*hcloud.ZoneRRSet, error)
+	CreateRRSet(ctx context.Context, zone *hcloud.Zone, opts hcloud.ZoneRRSetCreateOpts) (*hcloud.ZoneRRSet, error)
+	AddRecords(ctx context.Context, rrset *hcloud.ZoneRRSet, opts hcloud.ZoneRRSetAddRecordsOpts) error
+	RemoveRecords(ctx context.Context, rrset *hcloud.ZoneRRSet, opts hcloud.ZoneRRSetRemoveRecordsOpts) error
+	SetRecords(ctx context.Context, rrset *hcloud.ZoneRRSet, opts hcloud.ZoneRRSetSetRecordsOpts) error
+	ChangeTTL(ctx context.Context, rrset *hcloud.ZoneRRSet, opts hcloud.ZoneRRSetChangeTTLOpts) error
+	DeleteRRSet(ctx context.Context, rrset *hcloud.ZoneRRSet) error
+}
+
+// zoneTarget is one backend a zone is published on. key names the zone there
+// in state keys, metric labels and the plan: the zone name on its Hetzner
+// backend and "rfc2136:" plus the name on an RFC 2136 server, the way
+// firewalls are told apart from zones.
+type zoneTarget struct {
+	key     string
+	backend dnsBackend
+	// extra marks the RFC 2136 server, which leaves reverse DNS to the
+	// Hetzner backend.
+	extra bool
+	// breaker guards the Hetzner API. It is nil on an RFC 2136 server, whose
+	// outages say nothing about the API and must not hold back its updates.
+	breaker *breaker
+}
+
+// targetZone is a zone as resolved on one of its targets.
+type targetZone struct {
+	*hcloud.Zone
+	zoneTarget
+}
+
+func rfc2136Target(name string) string {
+	return "rfc2136:" + name
+}
+
+// zoneTargets returns the zone's Hetzner backend followed by its RFC 2136
+// server, if one is configured.
+func (s *Service) zoneTargets(zoneCfg config.ZoneConfig) []zoneTarget {
+	primary := zoneTarget{key: zoneCfg.Name, backend: s.cloud, breaker: s.breaker}
+	if zoneCfg.Backend == config.BackendConsole {
+		primary.backend = s.console
+	}
+	targets := []zoneTarget{primary}
+	if zoneCfg.RFC2136.Server != "" {
+		targets = append(targets, zoneTarget{key: rfc2136Target(zoneCfg.Name), backend: newRFC2136Backend(zoneCfg.RFC2136), extra: true})
+	}
+	return targets
+}
+
+// cloudBackend manages zones in Hetzner Cloud DNS.
+type cloudBackend struct {
+	client *hcloud.Client
+}
+
+func (b *cloudBackend) GetZone(ctx context.Context, name string) (*hcloud.Zone, error) {
+	zone, _, err := b.client.Zone.GetByName(ctx, name)
+	return zone, err
+}
+
+func (b *cloudBackend) GetRRSet(ctx context.Context, zone *hcloud.Zone, name string, rrType hcloud.ZoneRRSetType) (*hcloud.ZoneRRSet, error) {
+	rrset, _, err := b.client.Zone.GetRRSetByNameAndType(ctx, zone, name, rrType)
+	return rrset, err
+}
+
+func (b *cloudBackend) CreateRRSet(ctx context.Context, zone *hcloud.Zone, opts hcloud.ZoneRRSetCreateOpts) (*hcloud.ZoneRRSet, error) {
+	created, _, err := b.client.Zone.CreateRRSet(ctx, zone, opts)
+	return created.RRSet, err
+}
+
+func (b *cloudBackend) AddRecords(ctx context.Context, rrset *hcloud.ZoneRRSet, opts hcloud.ZoneRRSetAddRecordsOpts) error {
+	_, _, err := b.client.Zone.AddRRSetRecords(ctx, rrset, opts)
+	return err
+}
+
+func (b *cloudBackend) RemoveRecords(ctx context.Context, rrset *hcloud.ZoneRRSet, opts hcloud.ZoneRRSetRemoveRecordsOpts) error {
+	_, _, err := b.client.Zone.RemoveRRSetRecords(ctx, rrset, opts)
+	return err
+}
+
+func (b *cloudBackend) SetRecords(ctx context.Context, rrset *hcloud.ZoneRRSet, opts hcloud.ZoneRRSetSetRecordsOpts) error {
+	_, _, err := b.client.Zone.SetRRSetRecords(ctx, rrset, opts)
+	return err
+}
+
+func (b *cloudBackend) ChangeTTL(ctx context.Context, rrset *hcloud.ZoneRRSet, opts hcloud.ZoneRRSetChangeTTLOpts) error {
+	_, _, err := b.client.Zone.ChangeRRSetTTL(ctx, rrset, opts)
+	return err
+}
+
+func (b *cloudBackend) DeleteRRSet(ctx context.Context, rrset *hcloud.ZoneRRSet) error {
+	_, _, err := b.client.Zone.DeleteRRSet(ctx, rrset)
+	return err
+}
+
+// consoleBackend manages zones in the legacy DNS Console. The console stores
+// single records, so every RRSet operation lists the zone's records and
+// changes the ones with the RRSet's name and type. Zone IDs are strings there
+// and are kept here by zone name.
+type consoleBackend struct {
+	client *dnsconsole.Client
+
+	mu    sync.Mutex
+	zones map[string]string
+}
+
+func newConsoleBackend(client *dnsconsole.Client) *consoleBackend {
+	return &consoleBackend{client: client, zones: make(map[string]string)}
+}
+
+func (b *consoleBackend) GetZone(ctx context.Context, name string) (*hcloud.Zone, error) {
+	zone, err := b.client.ZoneByName(ctx, name)
+	if err != nil || zone == nil {
+		return nil, err
+	}
+	b.mu.Lock()
+	b.zones[name] = zone.ID
+	b.mu.Unlock()
+	return &hcloud.Zone{Name: zone.Name, TTL: zone.TTL}, nil
+}
+
+func (b *consoleBackend) zoneID(ctx context.Context, zone *hcloud.Zone) (string, error) {
+	b.mu.Lock()
+	id, ok := b.zones[zone.Name]
+	b.mu.Unlock()
+	if ok {
+		return id, nil
+	}
+	found, err := b.GetZone(ctx, zone.Name)
+	if err != nil {
+		return "", err
+	}
+	if found == nil {
+		return "", permanent(fmt.Errorf("zone not found: %s", zone.Name))
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.zones[zone.Name], nil
+}
+
+// records returns the zone's records of one name and type.
+func (b *consoleBackend) records(ctx context.Context, zone *hcloud.Zone, name string, rrType hcloud.ZoneRRSetType) (string, []dnsconsole.Record, error) {
+	zoneID, err := b.zoneID(ctx, zone)
+	if err != nil {
+		return "", nil, err
+	}
+	all, err := b.client.Records(ctx, zoneID)
+	if err != nil {
+		return "", nil, err
+	}
+	var matching []dnsconsole.Record
+	for _, record := range all {
+		if record.Name == name && strings.EqualFold(record.Type, string(rrType)) {
+			matching = append(matching, record)
+		}
+	}
+	return zoneID, matching, nil
+}
+
+func (b *consoleBackend) GetRRSet(ctx context.Context, zone *hcloud.Zone, name string, rrType hcloud.ZoneRRSetType) (*hcloud.ZoneRRSet, error) {
+	_, records, err := b.records(ctx, zone, name, rrType)
+	if err != nil || len(records) == 0 {
+		return nil, err
+	}
+	rrset := &hcloud.ZoneRRSet{Zone: zone, ID: name + "/" + string(rrType), Name: name, Type: rrType, TTL: records[0].TTL}
+	for _, record := range records {
+		rrset.Records = append(rrset.Records, hcloud.ZoneRRSetRecord{Value: record.Value})
+	}
+	return rrset, nil
+}
+
+func (b *consoleBackend) CreateRRSet(ctx context.Context, zone *hcloud.Zone, opts hcloud.ZoneRRSetCreateOpts) (*hcloud.ZoneRRSet, error) {
+	rrset := &hcloud.ZoneRRSet{Zone: zone, ID: opts.Name + "/" + string(opts.Type), Name: opts.Name, Type: opts.Type, TTL: opts.TTL, Records: opts.Records}
+	// Adding skips values that exist already, so a retried create does not
+	// duplicate records.
+	if err := b.AddRecords(ctx, rrset, hcloud.ZoneRRSetAddRecordsOpts{Records: opts.Records, TTL: opts.TTL}); err != nil {
+		return nil, err
+	}
+	return rrset, nil
+}
+
+func (b *consoleBackend) AddRecords(ctx context.Context, rrset *hcloud.ZoneRRSet, opts hcloud.ZoneRRSetAddRecordsOpts) error {
+	zoneID, existing, err := b.records(ctx, rrset.Zone, rrset.Name, rrset.Type)
+	if err != nil {
+		return err
+	}
+	ttl := opts.TTL
+	if ttl == nil {
+		ttl = rrset.TTL
+	}
+	for _, record := range opts.Records {
+		if slices.ContainsFunc(existing, func(r dnsconsole.Record) bool { return r.Value == record.Value }) {
+			continue
+		}
+		if _, err := b.client.CreateRecord(ctx, dnsconsole.Record{ZoneID: zoneID, Type: string(rrset.Type), Name: rrset.Name, Value: record.Value, TTL: ttl}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *consoleBackend) RemoveRecords(ctx context.Context, rrset *hcloud.ZoneRRSet, opts hcloud.ZoneRRSetRemoveRecordsOpts) error {
+	_, existing, err := b.records(ctx, rrset.Zone, rrset.Name, rrset.Type)
+	if err != nil {
+		return err
+	}
+	for _, record := range existing {
+		if !slices.ContainsFunc(opts.Records, func(r hcloud.ZoneRRSetRecord) bool { return r.Value == record.Value }) {
+			continue
+		}
+		if err := b.client.DeleteRecord(ctx, record.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetRecords keeps records that already hold a wanted value, rewrites the
+// others in place and creates or deletes records for the difference, so a
+// name never has no records in between.
+func (b *consoleBackend) SetRecords(ctx context.Context, rrset *hcloud.ZoneRRSet, opts hcloud.ZoneRRSetSetRecordsOpts) error {
+	zoneID, existing, err := b.records(ctx, rrset.Zone, rrset.Name, rrset.Type)
+	if err != nil {
+		return err
+	}
+	var missing []string
+	for _, record := range opts.Records {
+		if !slices.ContainsFunc(existing, func(r dnsconsole.Record) bool { return r.Value == record.Value }) {
+			missing = append(missing, record.Value)
+		}
+	}
+	var stale []dnsconsole.Record
+	for _, record := range existing {
+		if !slices.ContainsFunc(opts.Records, func(r hcloud.ZoneRRSetRecord) bool { return r.Value == record.Value }) {
+			stale = append(stale, record)
+		}
+	}
+	for len(missing) > 0 && len(stale) > 0 {
+		record := stale[0]
+		record.Value = missing[0]
+		if _, err := b.client.UpdateRecord(ctx, record); err != nil {
+			return err
+		}
+		missing, stale = missing[1:], stale[1:]
+	}
+	for _, value := range missing {
+		if _, err := b.client.CreateRecord(ctx, dnsconsole.Record{ZoneID: zoneID, Type: string(rrset.Type), Name: rrset.Name, Value: value, TTL: rrset.TTL}); err != nil {
+			return err
+		}
+	}
+	for _, record := range stale {
+		if err := b.client.DeleteRecord(ctx, record.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *consoleBackend) ChangeTTL(ctx context.Context, rrset *hcloud.ZoneRRSet, opts hcloud.ZoneRRSetChangeTTLOpts) error {
+	_, existing, err := b.records(ctx, rrset.Zone, rrset.Name, rrset.Type)
+	if err != nil {
+		return err
+	}
+	for _, record := range existing {
+		if ttlEqual(record.TTL, opts.TTL) {
+			continue
+		}
+		record.TTL = opts.TTL
+		if _, err := b.client.UpdateRecord(ctx, record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *consoleBackend) DeleteRRSet(ctx context.Context, rrset *hcloud.ZoneRRSet) error {
+	_, existing, err := b.records(ctx, rrset.Zone, rrset.Name, rrset.Type)
+	if err != nil {
+		return err
+	}
+	for _, record := range existing {
+		if err := b.client.DeleteRecord(ctx, record.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rfc2136Backend publishes zones on an authoritative server through DNS UPDATE.
+// Every RRSet operation is a single UPDATE message, so the server applies it
+// all or nothing. The backend is built from the zone's settings on every run
+// and holds no state.
+type rfc2136Backend struct {
+	client *rfc2136.Client
+}
+
+// rfc2136DefaultTTL is used for new records without a configured TTL, where
+// the Cloud API would take the zone's default.
+const rfc2136DefaultTTL = 3600
+
+func newRFC2136Backend(cfg config.RFC2136Config) *rfc2136Backend {
+	var key *rfc2136.Key
+	if cfg.KeyName != "" {
+		key = &rfc2136.Key{Name: cfg.KeyName, Secret: cfg.Secret}
+	}
+	return &rfc2136Backend{client: rfc2136.New(cfg.Server, key)}
+}
+
+func (b *rfc2136Backend) GetZone(ctx context.Context, name string) (*hcloud.Zone, error) {
+	found, err := b.client.HasZone(ctx, name)
+	if err != nil || !found {
+		return nil, err
+	}
+	return &hcloud.Zone{Name: name}, nil
+}
+
+func (b *rfc2136Backend) GetRRSet(ctx context.Context, zone *hcloud.Zone, name string, rrType hcloud.ZoneRRSetType) (*hcloud.ZoneRRSet, error) {
+	records, err := b.client.Lookup(ctx, recordFQDN(zone.Name, name), string(rrType))
+	if err != nil || len(records) == 0 {
+		return nil, err
+	}
+	ttl := records[0].TTL
+	rrset := &hcloud.ZoneRRSet{Zone: zone, ID: name + "/" + string(rrType), Name: name, Type: rrType, TTL: &ttl}
+	for _, record := range records {
+		rrset.Records = append(rrset.Records, hcloud.ZoneRRSetRecord{Value: record.Value})
+	}
+	return rrset, nil
+}
+
+func (b *rfc2136Backend) CreateRRSet(ctx context.Context, zone *hcloud.Zone, opts hcloud.ZoneRRSetCreateOpts) (*hcloud.ZoneRRSet, error) {
+	rrset := &hcloud.ZoneRRSet{Zone: zone, ID: opts.Name + "/" + string(opts.Type), Name: opts.Name, Type: opts.Type, TTL: opts.TTL, Records: opts.Records}
+	if err := b.AddRecords(ctx, rrset, hcloud.ZoneRRSetAddRecordsOpts{Records: opts.Records, TTL: opts.TTL}); err != nil {
+		return nil, err
+	}
+	return rrset, nil
+}
+
+func (b *rfc2136Backend) AddRecords(ctx context.Context, rrset *hcloud.ZoneRRSet, opts hcloud.ZoneRRSetAddRecordsOpts) error {
+	ttl := opts.TTL
+	if ttl == nil {
+		ttl = rrset.TTL
+	}
+	update := rfc2136.NewUpdate(rrset.Zone.Name)
+	for _, record := range opts.Records {
+		update.Add(b.rr(rrset, record.Value, ttl))
+	}
+	return b.client.Send(ctx, update)
+}
+
+func (b *rfc2136Backend) RemoveRecords(ctx context.Context, rrset *hcloud.ZoneRRSet, opts hcloud.ZoneRRSetRemoveRecordsOpts) error {
+	update := rfc2136.NewUpdate(rrset.Zone.Name)
+	for _, record := range opts.Records {
+		update.Delete(b.rr(rrset, record.Value, nil))
+	}
+	return b.client.Send(ctx, update)
+}
+
+func (b *rfc2136Backend) SetRecords(ctx context.Context, rrset *hcloud.ZoneRRSet, opts hcloud.ZoneRRSetSetRecordsOpts) error {
+	return b.replace(ctx, rrset, opts.Records, rrset.TTL)
+}
+
+func (b *rfc2136Backend) ChangeTTL(ctx context.Context, rrset *hcloud.ZoneRRSet, opts hcloud.ZoneRRSetChangeTTLOpts) error {
+	return b.replace(ctx, rrset, rrset.Records, opts.TTL)
+}
+
+func (b *rfc2136Backend) DeleteRRSet(ctx context.Context, rrset *hcloud.ZoneRRSet) error {
+	update := rfc2136.NewUpdate(rrset.Zone.Name)
+	update.DeleteRRSet(recordFQDN(rrset.Zone.Name, rrset.Name), string(rrset.Type))
+	return b.client.Send(ctx, update)
+}
+
+// replace deletes the RRSet and adds records in its place in one message.
+func (b *rfc2136Backend) replace(ctx context.Context, rrset *hcloud.ZoneRRSet, records []hcloud.ZoneRRSetRecord, ttl *int) error {
+	update := rfc2136.NewUpdate(rrset.Zone.Name)
+	update.DeleteRRSet(recordFQDN(rrset.Zone.Name, rrset.Name), string(rrset.Type))
+	for _, record := range records {
+		update.Add(b.rr(rrset, record.Value, ttl))
+	}
+	return b.client.Send(ctx, update)
+}
+
+func (b *rfc2136Backend) rr(rrset *hcloud.ZoneRRSet, value string, ttl *int) rfc2136.RR {
+	rr := rfc2136.RR{Name: recordFQDN(rrset.Zone.Name, rrset.Name), Type: string(rrset.Type), TTL: rfc2136DefaultTTL, Value: value}
+	if ttl != nil {
+		rr.TTL = *ttl
+	}
+	return rr
+}
@@ -0,0 +1,286 @@
+package ddns
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"hetzner-ddns/internal/config"
+	"hetzner-ddns/internal/dnsconsole"
+	"hetzner-ddns/internal/state"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+)
+
+// consoleServer is a DNS Console holding the records of one zone, example.com,
+// that logs every mutating request as "METHOD id".
+type consoleServer struct {
+	mu       sync.Mutex
+	records  []dnsconsole.Record
+	nextID   int
+	requests []string
+}
+
+func (c *consoleServer) add(name, rrType string, values ...string) {
+	for _, value := range values {
+		c.nextID++
+		c.records = append(c.records, dnsconsole.Record{ID: strconv.Itoa(c.nextID), ZoneID: "z1", Type: rrType, Name: name, Value: value})
+	}
+}
+
+func (c *consoleServer) values(name, rrType string) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var values []string
+	for _, record := range c.records {
+		if record.Name == name && record.Type == rrType {
+			values = append(values, record.Value)
+		}
+	}
+	return values
+}
+
+func (c *consoleServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /zones", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("name") != "example.com" {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"zones": []dnsconsole.Zone{{ID: "z1", Name: "example.com", TTL: 86400}}})
+	})
+	mux.HandleFunc("GET /records", func(w http.ResponseWriter, r *http.Request) {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		json.NewEncoder(w).Encode(map[string]any{"records": c.records, "meta": map[string]any{"pagination": map[string]any{"last_page": 1}}})
+	})
+	mux.HandleFunc("POST /records", func(w http.ResponseWriter, r *http.Request) {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		var record dnsconsole.Record
+		json.NewDecoder(r.Body).Decode(&record)
+		c.nextID++
+		record.ID = strconv.Itoa(c.nextID)
+		c.records = append(c.records, record)
+		c.requests = append(c.requests, "POST "+record.Value)
+		json.NewEncoder(w).Encode(map[string]any{"record": record})
+	})
+	mux.HandleFunc("PUT /records/{id}", func(w http.ResponseWriter, r *http.Request) {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		var record dnsconsole.Record
+		json.NewDecoder(r.Body).Decode(&record)
+		record.ID = r.PathValue("id")
+		for i := range c.records {
+			if c.records[i].ID == record.ID {
+				c.records[i] = record
+			}
+		}
+		c.requests = append(c.requests, "PUT "+record.ID+" "+record.Value)
+		json.NewEncoder(w).Encode(map[string]any{"record": record})
+	})
+	mux.HandleFunc("DELETE /records/{id}", func(w http.ResponseWriter, r *http.Request) {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.records = slices.DeleteFunc(c.records, func(record dnsconsole.Record) bool { return record.ID == r.PathValue("id") })
+		c.requests = append(c.requests, "DELETE "+r.PathValue("id"))
+	})
+	return mux
+}
+
+func newTestConsole(t *testing.T, server *consoleServer) *consoleBackend {
+	t.Helper()
+	srv := httptest.NewServer(server.handler())
+	t.Cleanup(srv.Close)
+	return newConsoleBackend(dnsconsole.New(srv.URL, "token", ""))
+}
+
+func TestConsoleBackendRRSets(t *testing.T) {
+	server := &consoleServer{}
+	server.add("www", "A", "203.0.113.1", "203.0.113.2")
+	server.add("www", "AAAA", "2001:db8::1")
+	backend := newTestConsole(t, server)
+	ctx := context.Background()
+
+	zone, err := backend.GetZone(ctx, "example.com")
+	if err != nil || zone == nil || zone.TTL != 86400 {
+		t.Fatalf("zone = %+v, %v", zone, err)
+	}
+	if missing, err := backend.GetZone(ctx, "example.org"); err != nil || missing != nil {
+		t.Fatalf("unknown zone = %+v, %v; want nil, nil", missing, err)
+	}
+
+	rrset, err := backend.GetRRSet(ctx, zone, "www", "A")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := rrsetValues(rrset); !slices.Equal(got, []string{"203.0.113.1", "203.0.113.2"}) {
+		t.Fatalf("rrset values = %v", got)
+	}
+	if none, err := backend.GetRRSet(ctx, zone, "mail", "A"); err != nil || none != nil {
+		t.Fatalf("absent rrset = %+v, %v; want nil, nil", none, err)
+	}
+
+	created, err := backend.CreateRRSet(ctx, zone, hcloud.ZoneRRSetCreateOpts{Name: "vpn", Type: "A", Records: []hcloud.ZoneRRSetRecord{{Value: "198.51.100.1"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := backend.AddRecords(ctx, created, hcloud.ZoneRRSetAddRecordsOpts{Records: []hcloud.ZoneRRSetRecord{{Value: "198.51.100.1"}, {Value: "198.51.100.2"}}}); err != nil {
+		t.Fatal(err)
+	}
+	if got := server.values("vpn", "A"); !slices.Equal(got, []string{"198.51.100.1", "198.51.100.2"}) {
+		t.Fatalf("vpn after add = %v", got)
+	}
+	if err := backend.RemoveRecords(ctx, created, hcloud.ZoneRRSetRemoveRecordsOpts{Records: []hcloud.ZoneRRSetRecord{{Value: "198.51.100.1"}}}); err != nil {
+		t.Fatal(err)
+	}
+	if got := server.values("vpn", "A"); !slices.Equal(got, []string{"198.51.100.2"}) {
+		t.Fatalf("vpn after remove = %v", got)
+	}
+	if err := backend.DeleteRRSet(ctx, rrset); err != nil {
+		t.Fatal(err)
+	}
+	if got := server.values("www", "A"); got != nil {
+		t.Fatalf("www/A after delete = %v", got)
+	}
+	if got := server.values("www", "AAAA"); len(got) != 1 {
+		t.Fatalf("delete touched www/AAAA: %v", got)
+	}
+}
+
+func TestConsoleBackendSetRecordsRewritesInPlace(t *testing.T) {
+	server := &consoleServer{}
+	server.add("www", "A", "203.0.113.1", "203.0.113.2")
+	backend := newTestConsole(t, server)
+	ctx := context.Background()
+	zone, _ := backend.GetZone(ctx, "example.com")
+	rrset, _ := backend.GetRRSet(ctx, zone, "www", "A")
+
+	err := backend.SetRecords(ctx, rrset, hcloud.ZoneRRSetSetRecordsOpts{Records: []hcloud.ZoneRRSetRecord{{Value: "203.0.113.2"}, {Value: "203.0.113.3"}, {Value: "203.0.113.4"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The kept value is left alone, the stale one is rewritten rather than
+	// deleted, and only the remainder is created.
+	want := []string{"PUT 1 203.0.113.3", "POST 203.0.113.4"}
+	if !slices.Equal(server.requests, want) {
+		t.Errorf("requests = %v, want %v", server.requests, want)
+	}
+	if got := server.values("www", "A"); !slices.Equal(got, []string{"203.0.113.3", "203.0.113.2", "203.0.113.4"}) {
+		t.Errorf("values = %v", got)
+	}
+
+	server.requests = nil
+	rrset, _ = backend.GetRRSet(ctx, zone, "www", "A")
+	if err := backend.SetRecords(ctx, rrset, hcloud.ZoneRRSetSetRecordsOpts{Records: []hcloud.ZoneRRSetRecord{{Value: "203.0.113.9"}}}); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"PUT 1 203.0.113.9", "DELETE 2", "DELETE 3"}; !slices.Equal(server.requests, want) {
+		t.Errorf("requests = %v, want %v", server.requests, want)
+	}
+}
+
+func TestConsoleRateLimitWaitsRetryAfter(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "3")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	backend := newConsoleBackend(dnsconsole.New(srv.URL, "token", ""))
+	_, err := backend.GetZone(context.Background(), "example.com")
+	var consoleErr *dnsconsole.Error
+	if !errors.As(err, &consoleErr) {
+		t.Fatalf("err = %v, want *dnsconsole.Error", err)
+	}
+	decision := classifyError(err, time.Now())
+	if decision.class != classRateLimited || !decision.retry || decision.wait != 3*time.Second {
+		t.Errorf("decision = %+v", decision)
+	}
+}
+
+func TestPrepareZoneAddsRFC2136Target(t *testing.T) {
+	zoneCfg := config.ZoneConfig{
+		Name:       "example.com",
+		Records:    []config.RecordConfig{{Name: "www", Types: []string{"A"}}},
+		IPv4Source: config.SourceConfig{Providers: []string{"https://v4.example"}},
+		Backend:    config.BackendCloud,
+		RFC2136:    config.RFC2136Config{Server: "127.0.0.1:53"},
+	}
+	store, err := state.Open(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sources := &staticSources{addrs: map[string]net.IP{"https://v4.example": net.ParseIP("203.0.113.1")}}
+	s := newTestService(t, testConfig(zoneCfg), newMemoryBackend(), sources)
+	s.state = store
+	// Published on the Hetzner backend only; the server still needs it.
+	s.rememberRecord("example.com", desiredRecord{name: "www", recordType: "A", value: "203.0.113.1"}, "", nil)
+
+	work := s.prepareZone(context.Background(), &syncRun{}, make(map[string]net.IP), zoneCfg, time.Now(), false)
+	if len(work) != 1 {
+		t.Fatalf("got %d targets with work, want 1", len(work))
+	}
+	zw := work[0]
+	if zw.name != "example.com" || zw.target.key != "rfc2136:example.com" || !zw.target.extra {
+		t.Fatalf("work = %s on %+v", zw.name, zw.target)
+	}
+	if _, ok := zw.target.backend.(*rfc2136Backend); !ok {
+		t.Fatalf("backend = %T", zw.target.backend)
+	}
+
+	work = s.prepareZone(context.Background(), &syncRun{}, make(map[string]net.IP), zoneCfg, time.Now(), true)
+	var keys []string
+	for _, zw := range work {
+		keys = append(keys, zw.target.key)
+	}
+	if !slices.Equal(keys, []string{"example.com", "rfc2136:example.com"}) {
+		t.Fatalf("forced targets = %v", keys)
+	}
+}
+
+func TestUnreachableRFC2136ServerLeavesCloudUpdating(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := ln.Addr().String()
+	ln.Close()
+
+	zoneCfg := config.ZoneConfig{
+		Name:       "example.com",
+		Records:    []config.RecordConfig{{Name: "www", Types: []string{"A"}}},
+		IPv4Source: config.SourceConfig{Providers: []string{"https://v4.example"}},
+		Backend:    config.BackendCloud,
+		RFC2136:    config.RFC2136Config{Server: server},
+	}
+	cfg := testConfig(zoneCfg)
+	cfg.BreakerThreshold = 1
+	cloud := newMemoryBackend()
+	sources := &staticSources{addrs: map[string]net.IP{"https://v4.example": net.ParseIP("203.0.113.1")}}
+	s := newTestService(t, cfg, cloud, sources)
+
+	for _, addr := range []string{"203.0.113.1", "203.0.113.2"} {
+		sources.addrs["https://v4.example"] = net.ParseIP(addr)
+		err := s.syncOnce(context.Background())
+		var syncErr *SyncError
+		if !errors.As(err, &syncErr) || len(syncErr.Failures) != 1 || syncErr.Failures[0].Zone != "rfc2136:example.com" {
+			t.Fatalf("sync with %s: %v, want one failure on the server", addr, err)
+		}
+		if got := cloud.values("www", "A"); !slices.Equal(got, []string{addr}) {
+			t.Fatalf("cloud www A = %v, want %s", got, addr)
+		}
+	}
+	if state := s.breaker.status(time.Now()).State; state != circuitClosed {
+		t.Errorf("circuit %s after server failures, want closed", state)
+	}
+}
@@ -0,0 +1,184 @@
+package ddns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"hetzner-ddns/internal/metrics"
+)
+
+// The circuit breaker stops API calls once BREAKER_THRESHOLD operations in a
+// row have failed with a retryable error, i.e. the API itself looks degraded.
+// After BREAKER_COOLDOWN one operation is let through as a probe: success
+// closes the circuit, failure opens it for another cool-down.
+
+const (
+	circuitClosed   = "closed"
+	circuitOpen     = "open"
+	circuitHalfOpen = "half-open"
+)
+
+var ErrCircuitOpen = errors.New("API circuit breaker open")
+
+type breaker struct {
+	mu       sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+	retryAt  time.Time
+	probing  bool
+}
+
+type circuitStatus struct {
+	State               string     `json:"state"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	OpenedAt            *time.Time `json:"opened_at,omitempty"`
+	RetryAt             *time.Time `json:"retry_at,omitempty"`
+}
+
+func newBreaker() *breaker {
+	return &breaker{state: circuitClosed}
+}
+
+// allow reports whether an operation may call the API and whether it is the
+// probe of a half-open circuit.
+func (b *breaker) allow(now time.Time) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case circuitOpen:
+		if now.Before(b.retryAt) {
+			return false, ErrCircuitOpen
+		}
+		b.state = circuitHalfOpen
+		fallthrough
+	case circuitHalfOpen:
+		if b.probing {
+			return false, ErrCircuitOpen
+		}
+		b.probing = true
+		return true, nil
+	}
+	return false, nil
+}
+
+// done records the outcome of an operation. degraded is false for successes
+// and for errors the API answered deliberately, such as not_found. It returns
+// the state afterwards and whether it changed.
+func (b *breaker) done(probe, degraded bool, threshold int, cooldown time.Duration, now time.Time) (string, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	previous := b.state
+	if probe {
+		b.probing = false
+	}
+	if !degraded {
+		b.failures = 0
+		if probe {
+			b.state = circuitClosed
+		}
+		return b.state, b.state != previous
+	}
+	b.failures++
+	if probe || (b.state == circuitClosed && threshold > 0 && b.failures >= threshold) {
+		b.state = circuitOpen
+		b.openedAt = now
+		b.retryAt = now.Add(cooldown)
+	}
+	return b.state, b.state != previous
+}
+
+// release gives up a probe without an outcome, e.g. on shutdown.
+func (b *breaker) release(probe bool) {
+	if !probe {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+// halfOpen reports whether the next operation would be a probe.
+func (b *breaker) halfOpen(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state == circuitHalfOpen || (b.state == circuitOpen && !now.Before(b.retryAt))
+}
+
+func (b *breaker) status(now time.Time) circuitStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	status := circuitStatus{State: b.state, ConsecutiveFailures: b.failures}
+	if b.state == circuitOpen && !now.Before(b.retryAt) {
+		status.State = circuitHalfOpen
+	}
+	if b.state != circuitClosed {
+		openedAt, retryAt := b.openedAt, b.retryAt
+		status.OpenedAt = &openedAt
+		status.RetryAt = &retryAt
+	}
+	return status
+}
+
+// guardCircuit skips the API work of a run while the circuit is open. The
+// observed addresses are already tracked at this point, and since nothing is
+// remembered in the state file the records are updated once it closes. Zones
+// on RFC 2136 servers do not use the API and go ahead.
+func (s *Service) guardCircuit(run *syncRun, work []*zoneWork, firewalls []*firewallWork) ([]*zoneWork, []*firewallWork) {
+	if len(work) == 0 && len(firewalls) == 0 {
+		return work, firewalls
+	}
+	status := s.breaker.status(time.Now())
+	if status.State != circuitOpen {
+		return work, firewalls
+	}
+	var skipped, kept []*zoneWork
+	for _, zw := range work {
+		if zw.target.breaker == nil {
+			kept = append(kept, zw)
+		} else {
+			skipped = append(skipped, zw)
+		}
+	}
+	s.logger.Warn("API circuit open; skipping API calls", "zones", len(skipped), "firewalls", len(firewalls), "consecutive_failures", status.ConsecutiveFailures, "retry_in", time.Until(*status.RetryAt).Round(time.Second).String())
+	for _, zw := range skipped {
+		s.fail(run, zw.target.key, "", "", metrics.PhaseCircuitOpen, fmt.Errorf("zone %s: %w", zw.target.key, ErrCircuitOpen))
+	}
+	for _, fw := range firewalls {
+		s.failFirewall(run, fw.cfg.Name, "", "", metrics.PhaseCircuitOpen, fmt.Errorf("firewall %s: %w", fw.cfg.Name, ErrCircuitOpen))
+	}
+	return kept, nil
+}
+
+// concurrency is 1 while the circuit waits for a probe, so the first API call
+// decides whether the rest of the run goes ahead.
+func (s *Service) concurrency() int {
+	if s.breaker.halfOpen(time.Now()) {
+		return 1
+	}
+	return max(s.cfg.Concurrency, 1)
+}
+
+// recordOutcome feeds the result of an operation into the breaker and logs
+// state changes.
+func (s *Service) recordOutcome(ctx context.Context, b *breaker, label string, probe bool, err error, class string) {
+	if err != nil && ctx.Err() != nil {
+		b.release(probe)
+		return
+	}
+	degraded := err != nil && class != classPermanent
+	state, changed := b.done(probe, degraded, s.cfg.BreakerThreshold, s.cfg.BreakerCooldown, time.Now())
+	if !changed {
+		return
+	}
+	s.metrics.CircuitState(state)
+	switch state {
+	case circuitOpen:
+		s.log(ctx).Error("API circuit opened; pausing API calls", "op", label, "cooldown", s.cfg.BreakerCooldown.String(), "probe", probe, "error", err)
+	case circuitClosed:
+		s.log(ctx).Info("API circuit closed; probe succeeded", "op", label)
+	}
+}
@@ -0,0 +1,188 @@
+package ddns
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"hetzner-ddns/internal/config"
+	"hetzner-ddns/internal/metrics"
+)
+
+func TestBreakerTransitions(t *testing.T) {
+	const threshold, cooldown = 3, time.Minute
+	now := time.Unix(1_700_000_000, 0)
+	b := newBreaker()
+
+	// Failures below the threshold, or interrupted by a success, keep it closed.
+	for _, degraded := range []bool{true, true, false, true, true} {
+		if probe, err := b.allow(now); probe || err != nil {
+			t.Fatalf("closed circuit: allow = %v, %v", probe, err)
+		}
+		if state, _ := b.done(false, degraded, threshold, cooldown, now); state != circuitClosed {
+			t.Fatalf("state = %s after %d failures in a row", state, b.failures)
+		}
+	}
+
+	state, changed := b.done(false, true, threshold, cooldown, now)
+	if state != circuitOpen || !changed {
+		t.Fatalf("threshold reached: state = %s, changed = %v", state, changed)
+	}
+	if _, err := b.allow(now.Add(cooldown - time.Second)); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("allow during cool-down: %v", err)
+	}
+	if status := b.status(now); status.State != circuitOpen || !status.RetryAt.Equal(now.Add(cooldown)) {
+		t.Fatalf("status = %+v", status)
+	}
+
+	// After the cool-down exactly one operation gets through as the probe.
+	now = now.Add(cooldown)
+	if !b.halfOpen(now) || b.status(now).State != circuitHalfOpen {
+		t.Fatal("not half-open after cool-down")
+	}
+	if probe, err := b.allow(now); !probe || err != nil {
+		t.Fatalf("probe: allow = %v, %v", probe, err)
+	}
+	if _, err := b.allow(now); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("second operation during probe: %v", err)
+	}
+
+	// A failed probe opens it for another cool-down.
+	if state, _ := b.done(true, true, threshold, cooldown, now); state != circuitOpen {
+		t.Fatalf("failed probe: state = %s", state)
+	}
+	if _, err := b.allow(now.Add(cooldown - time.Second)); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("allow after failed probe: %v", err)
+	}
+
+	// A successful probe closes it.
+	now = now.Add(cooldown)
+	if probe, _ := b.allow(now); !probe {
+		t.Fatal("no probe after second cool-down")
+	}
+	if state, changed := b.done(true, false, threshold, cooldown, now); state != circuitClosed || !changed {
+		t.Fatalf("successful probe: state = %s, changed = %v", state, changed)
+	}
+	if status := b.status(now); status.ConsecutiveFailures != 0 || status.RetryAt != nil {
+		t.Fatalf("status after closing = %+v", status)
+	}
+}
+
+func TestBreakerReleasedProbe(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	b := newBreaker()
+	b.done(false, true, 1, time.Minute, now)
+	now = now.Add(time.Minute)
+	probe, _ := b.allow(now)
+	b.release(probe)
+	if probe, err := b.allow(now); !probe || err != nil {
+		t.Fatalf("probe after release: allow = %v, %v", probe, err)
+	}
+}
+
+func TestBreakerThresholdZeroNeverOpens(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	b := newBreaker()
+	for range 10 {
+		if state, _ := b.done(false, true, 0, time.Minute, now); state != circuitClosed {
+			t.Fatalf("state = %s with the breaker disabled", state)
+		}
+	}
+}
+
+func TestRecordOutcomeIgnoresPermanentErrors(t *testing.T) {
+	cfg := testConfig()
+	cfg.BreakerThreshold = 2
+	s := newTestService(t, cfg, newMemoryBackend(), nil)
+	ctx := context.Background()
+
+	for range 5 {
+		s.recordOutcome(ctx, s.breaker, "get rrset", false, errors.New("not_found"), classPermanent)
+	}
+	if status := s.breaker.status(time.Now()); status.State != circuitClosed || status.ConsecutiveFailures != 0 {
+		t.Fatalf("permanent errors: status = %+v", status)
+	}
+
+	// Canceled operations are no outcome either.
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	for range 5 {
+		s.recordOutcome(canceled, s.breaker, "get rrset", false, context.Canceled, classTransient)
+	}
+	if status := s.breaker.status(time.Now()); status.State != circuitClosed || status.ConsecutiveFailures != 0 {
+		t.Fatalf("canceled operations: status = %+v", status)
+	}
+
+	for range 2 {
+		s.recordOutcome(ctx, s.breaker, "get rrset", false, errors.New("EOF"), classTransient)
+	}
+	if state := s.breaker.status(time.Now()).State; state != circuitOpen {
+		t.Fatalf("transient errors: state = %s, want open", state)
+	}
+}
+
+func TestWithRetryProbesOnce(t *testing.T) {
+	cfg := testConfig()
+	cfg.BreakerThreshold = 1
+	cfg.BreakerCooldown = time.Millisecond
+	cfg.RetryAttempts = 3
+	s := newTestService(t, cfg, newMemoryBackend(), nil)
+	ctx := context.Background()
+
+	var calls int
+	failing := func(context.Context) error {
+		calls++
+		return errors.New("EOF")
+	}
+	s.withRetry(ctx, "get zone", failing)
+	if calls != 3 || s.breaker.status(time.Now()).State != circuitOpen {
+		t.Fatalf("closed circuit: %d calls, state %s", calls, s.breaker.status(time.Now()).State)
+	}
+	if err := s.withRetry(ctx, "get zone", failing); !errors.Is(err, ErrCircuitOpen) || calls != 3 {
+		t.Fatalf("open circuit: err = %v after %d calls", err, calls)
+	}
+
+	time.Sleep(2 * time.Millisecond)
+	calls = 0
+	s.withRetry(ctx, "get zone", failing)
+	if calls != 1 {
+		t.Fatalf("probe made %d calls, want 1", calls)
+	}
+	time.Sleep(2 * time.Millisecond)
+	if err := s.withRetry(ctx, "get zone", func(context.Context) error { return nil }); err != nil {
+		t.Fatalf("successful probe: %v", err)
+	}
+	if state := s.breaker.status(time.Now()).State; state != circuitClosed {
+		t.Fatalf("state after successful probe = %s", state)
+	}
+}
+
+func TestGuardCircuit(t *testing.T) {
+	s := newTestService(t, testConfig(), newMemoryBackend(), nil)
+	zoneCfg := config.ZoneConfig{Name: "example.com", RFC2136: config.RFC2136Config{Server: "127.0.0.1:53"}}
+	var work []*zoneWork
+	for _, target := range s.zoneTargets(zoneCfg) {
+		work = append(work, newZoneWork(zoneCfg.Name, target, nil, nil, nil))
+	}
+	firewalls := []*firewallWork{{cfg: config.FirewallConfig{Name: "office"}}}
+
+	run := &syncRun{}
+	if kept, fws := s.guardCircuit(run, work, firewalls); len(kept) != 2 || len(fws) != 1 || len(run.failures) > 0 {
+		t.Fatalf("closed circuit skipped work: %d zones, %d firewalls, %v", len(kept), len(fws), run.failures)
+	}
+
+	s.breaker.done(false, true, 1, time.Minute, time.Now())
+	kept, fws := s.guardCircuit(run, work, firewalls)
+	if len(kept) != 1 || kept[0].target.key != "rfc2136:example.com" || len(fws) != 0 {
+		t.Fatalf("open circuit kept %d zones, %d firewalls", len(kept), len(fws))
+	}
+	if len(run.failures) != 2 {
+		t.Fatalf("failures = %+v", run.failures)
+	}
+	for _, failure := range run.failures {
+		if failure.Phase != metrics.PhaseCircuitOpen {
+			t.Errorf("failure %+v, want phase %s", failure, metrics.PhaseCircuitOpen)
+		}
+	}
+}
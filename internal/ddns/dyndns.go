@@ -0,0 +1,320 @@
+package ddns
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+
+	"hetzner-ddns/internal/config"
+	"hetzner-ddns/internal/ip"
+	"hetzner-ddns/internal/metrics"
+	"hetzner-ddns/internal/state"
+)
+
+// DynDNS2 allows up to 20 hostnames per request.
+const maxPushHostnames = 20
+
+// pushRequest is an update received by the DynDNS2 server. It is handled on
+// the Run loop, so it never overlaps a sync or a reload.
+type pushRequest struct {
+	username  string
+	password  string
+	remote    string
+	hostnames []string
+	addrs     []net.IP
+	done      chan pushResult
+}
+
+// pushResult holds one DynDNS2 response line per requested hostname.
+type pushResult struct {
+	unauthorized bool
+	lines        []string
+}
+
+// DynDNSHandler serves /nic/update for routers that push their address with
+// the dyndns2 protocol. Pushed addresses go through the same update path as
+// observed ones.
+func (s *Service) DynDNSHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		username, password, ok := r.BasicAuth()
+		if !ok {
+			s.metrics.DynDNSUpdate("badauth")
+			writeUnauthorized(w)
+			return
+		}
+		query := r.URL.Query()
+		var hostnames []string
+		for _, hostname := range strings.Split(query.Get("hostname"), ",") {
+			if hostname = strings.TrimSpace(hostname); hostname != "" {
+				hostnames = append(hostnames, hostname)
+			}
+		}
+		switch {
+		case len(hostnames) == 0:
+			s.metrics.DynDNSUpdate("notfqdn")
+			fmt.Fprintln(w, "notfqdn")
+			return
+		case len(hostnames) > maxPushHostnames:
+			s.metrics.DynDNSUpdate("numhost")
+			fmt.Fprintln(w, "numhost")
+			return
+		}
+		addrs, err := pushedAddrs(query.Get("myip"), query.Get("myipv6"), r.RemoteAddr)
+		if err != nil {
+			s.logger.Warn("DynDNS update rejected", "username", username, "remote", r.RemoteAddr, "error", err)
+			s.metrics.DynDNSUpdate("911")
+			fmt.Fprintln(w, "911")
+			return
+		}
+
+		req := pushRequest{
+			username:  username,
+			password:  password,
+			remote:    r.RemoteAddr,
+			hostnames: hostnames,
+			addrs:     addrs,
+			done:      make(chan pushResult, 1),
+		}
+		select {
+		case s.pushCh <- req:
+		case <-r.Context().Done():
+			return
+		}
+		var result pushResult
+		select {
+		case result = <-req.done:
+		case <-r.Context().Done():
+			return
+		}
+		if result.unauthorized {
+			writeUnauthorized(w)
+			return
+		}
+		for _, line := range result.lines {
+			fmt.Fprintln(w, line)
+		}
+	})
+}
+
+func writeUnauthorized(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", `Basic realm="hetzner-ddns"`)
+	w.WriteHeader(http.StatusUnauthorized)
+	fmt.Fprintln(w, "badauth")
+}
+
+// pushedAddrs reads myip, which may list an IPv4 and an IPv6 address
+// separated by a comma, and myipv6. Without either the request's source
+// address is used.
+func pushedAddrs(myip, myipv6, remoteAddr string) ([]net.IP, error) {
+	var addrs []net.IP
+	for _, value := range strings.Split(myip+","+myipv6, ",") {
+		if value = strings.TrimSpace(value); value == "" {
+			continue
+		}
+		addr := net.ParseIP(value)
+		if addr == nil {
+			return nil, fmt.Errorf("invalid address %q", value)
+		}
+		if !slices.ContainsFunc(addrs, func(other net.IP) bool { return (other.To4() != nil) == (addr.To4() != nil) }) {
+			addrs = append(addrs, addr)
+		}
+	}
+	if len(addrs) > 0 {
+		return addrs, nil
+	}
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	addr := net.ParseIP(host)
+	if addr == nil {
+		return nil, fmt.Errorf("no myip and no usable source address %q", remoteAddr)
+	}
+	return []net.IP{addr}, nil
+}
+
+func (s *Service) handlePush(ctx context.Context, req pushRequest) pushResult {
+	client := s.dyndnsClient(req.username, req.password)
+	if client == nil {
+		s.logger.Warn("DynDNS authentication failed", "username", req.username, "remote", req.remote)
+		s.metrics.DynDNSUpdate("badauth")
+		return pushResult{unauthorized: true}
+	}
+
+	s.syncMu.Lock()
+	defer s.syncMu.Unlock()
+	lines := make([]string, 0, len(req.hostnames))
+	for _, hostname := range req.hostnames {
+		line := s.pushHostname(ctx, client, hostname, req.addrs)
+		s.metrics.DynDNSUpdate(strings.Fields(line)[0])
+		lines = append(lines, line)
+	}
+	s.saveState()
+	return pushResult{lines: lines}
+}
+
+func (s *Service) dyndnsClient(username, password string) *config.DynDNSClient {
+	for i := range s.cfg.DynDNSClients {
+		client := &s.cfg.DynDNSClients[i]
+		if subtle.ConstantTimeCompare([]byte(client.Username), []byte(username)) == 1 &&
+			subtle.ConstantTimeCompare([]byte(client.Password), []byte(password)) == 1 {
+			return client
+		}
+	}
+	return nil
+}
+
+// pushHostname publishes the pushed addresses on one record and returns its
+// DynDNS2 response line.
+func (s *Service) pushHostname(ctx context.Context, client *config.DynDNSClient, hostname string, addrs []net.IP) string {
+	hostname = strings.ToLower(strings.TrimSuffix(hostname, "."))
+	if !strings.Contains(hostname, ".") {
+		return "notfqdn"
+	}
+	zoneCfg, record, ok := s.findRecord(hostname)
+	if !ok || !slices.Contains(client.Hostnames, hostname) {
+		s.logger.Warn("DynDNS update for unknown hostname", "username", client.Username, "hostname", hostname)
+		return "nohost"
+	}
+	ttl := record.TTL
+	if ttl == nil {
+		ttl = zoneCfg.TTL
+	}
+
+	var desired []desiredRecord
+	var values []string
+	for _, addr := range addrs {
+		recordType := "A"
+		if addr.To4() == nil {
+			recordType = "AAAA"
+		}
+		if !slices.Contains(record.Types, recordType) {
+			s.logger.Debug("Ignoring pushed address; record has no such type", "zone", zoneCfg.Name, "record", record.Name, "record_type", recordType, "ip", addr.String())
+			continue
+		}
+		value := addr.String()
+		if record.Suffix != nil && recordType == "AAAA" {
+			derived, err := ip.CombinePrefix(addr, record.Suffix.Address, record.Suffix.PrefixLen)
+			if err != nil {
+				s.logger.Error("Prefix derivation failed", "zone", zoneCfg.Name, "record", record.Name, "error", err)
+				return "dnserr"
+			}
+			value = derived.String()
+		}
+		values = append(values, addr.String())
+		desired = append(desired, desiredRecord{name: record.Name, recordType: recordType, value: value, ttl: ttl, adopt: record.Adopt, reverse: record.Reverse})
+	}
+	if len(desired) == 0 {
+		s.logger.Warn("DynDNS update has no address for the record's types", "zone", zoneCfg.Name, "record", record.Name, "types", record.Types)
+		return "nohost"
+	}
+	ips := strings.Join(values, ",")
+
+	var pending []desiredRecord
+	for _, rec := range desired {
+		if s.pushedIP(zoneCfg.Name, rec.name, rec.recordType) != rec.value {
+			pending = append(pending, rec)
+		}
+	}
+	if len(pending) == 0 {
+		s.logger.Debug("DynDNS update unchanged", "zone", zoneCfg.Name, "record", record.Name, "ip", ips)
+		return "nochg " + ips
+	}
+	s.logger.Info("DynDNS update received", "username", client.Username, "zone", zoneCfg.Name, "record", record.Name, "ip", ips)
+
+	run := &syncRun{}
+	var work []*zoneWork
+	for _, target := range s.zoneTargets(zoneCfg) {
+		work = append(work, newZoneWork(zoneCfg.Name, target, nil, pending, nil))
+	}
+	if work, _ = s.guardCircuit(run, work, nil); len(work) == 0 {
+		return "911"
+	}
+	for _, zw := range work {
+		zone, err := s.resolveZone(ctx, zw.target, zw.name, false)
+		if err != nil {
+			s.logger.Error("Zone lookup failed", "zone", zw.target.key, "error", err)
+			s.fail(run, zw.target.key, "", "", metrics.PhaseZoneLookup, fmt.Errorf("zone %s lookup: %w", zw.target.key, err))
+			continue
+		}
+		zw.zone = zone
+		for _, group := range zw.groups {
+			s.syncRecordGroup(ctx, run, group)
+		}
+	}
+	if len(run.failures) > 0 {
+		return "dnserr"
+	}
+	for _, rec := range pending {
+		s.rememberPushedIP(zoneCfg.Name, rec)
+		for _, zw := range work {
+			s.metrics.Published(zw.target.key, rec.recordType, rec.value)
+		}
+	}
+	return "good " + ips
+}
+
+func (s *Service) findRecord(hostname string) (config.ZoneConfig, config.RecordConfig, bool) {
+	for _, zone := range s.cfg.Zones {
+		for _, record := range zone.Records {
+			if strings.EqualFold(recordFQDN(zone.Name, record.Name), hostname) {
+				return zone, record, true
+			}
+		}
+	}
+	return config.ZoneConfig{}, config.RecordConfig{}, false
+}
+
+// pushedRecord reports whether a DynDNS client publishes the record, so its
+// address is not observed by the sync.
+func (s *Service) pushedRecord(zoneName, recordName string) bool {
+	hostname := strings.ToLower(recordFQDN(zoneName, recordName))
+	for _, client := range s.cfg.DynDNSClients {
+		if slices.Contains(client.Hostnames, hostname) {
+			return true
+		}
+	}
+	return false
+}
+
+// pushedIP returns the value last pushed for a record, or "" when none is
+// known. The state file keeps it across restarts.
+func (s *Service) pushedIP(zoneName, recordName, recordType string) string {
+	key := state.RecordKey(zoneName, recordName, recordType)
+	s.pushMu.Lock()
+	defer s.pushMu.Unlock()
+	if value, ok := s.pushedIPs[key]; ok {
+		return value
+	}
+	if s.state != nil {
+		known, _ := s.state.Record(key)
+		return known.Value
+	}
+	return ""
+}
+
+func (s *Service) rememberPushedIP(zoneName string, rec desiredRecord) {
+	s.pushMu.Lock()
+	defer s.pushMu.Unlock()
+	s.pushedIPs[state.RecordKey(zoneName, rec.name, rec.recordType)] = rec.value
+}
+
+// pushedRecords returns the records of a pushed record that have a known
+// address, so a sync keeps them as the client last set them.
+func (s *Service) pushedRecords(zoneName string, record config.RecordConfig, ttl *int) []desiredRecord {
+	var desired []desiredRecord
+	for _, recordType := range record.Types {
+		value := s.pushedIP(zoneName, record.Name, recordType)
+		if value == "" {
+			s.logger.Debug("Skipping record; no address pushed yet", "zone", zoneName, "record", record.Name, "record_type", recordType)
+			continue
+		}
+		desired = append(desired, desiredRecord{name: record.Name, recordType: recordType, value: value, ttl: ttl, adopt: record.Adopt, reverse: record.Reverse})
+	}
+	return desired
+}
@@ -0,0 +1,152 @@
+package ddns
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"hetzner-ddns/internal/config"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+)
+
+// newPushService returns a service with home (A, AAAA), office (A) and lab (A)
+// in example.com. fritzbox may push home and office, lab belongs to another
+// client. Pushes are handled until the test ends, as the Run loop would.
+func newPushService(t *testing.T) (*Service, *memoryBackend) {
+	t.Helper()
+	zoneCfg := config.ZoneConfig{
+		Name: "example.com",
+		Records: []config.RecordConfig{
+			{Name: "home", Types: []string{"A", "AAAA"}},
+			{Name: "office", Types: []string{"A"}},
+			{Name: "lab", Types: []string{"A"}},
+		},
+	}
+	cfg := testConfig(zoneCfg)
+	cfg.DynDNSClients = []config.DynDNSClient{
+		{Username: "fritzbox", Password: "secret", Hostnames: []string{"home.example.com", "office.example.com"}},
+		{Username: "lab", Password: "other", Hostnames: []string{"lab.example.com"}},
+	}
+	backend := newMemoryBackend()
+	s := newTestService(t, cfg, backend, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go func() {
+		for {
+			select {
+			case req := <-s.pushCh:
+				req.done <- s.handlePush(ctx, req)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return s, backend
+}
+
+// push sends an update from 198.51.100.7, with basic auth unless username is
+// empty.
+func push(s *Service, username, password, query string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/nic/update?"+query, nil)
+	req.RemoteAddr = "198.51.100.7:4711"
+	if username != "" {
+		req.SetBasicAuth(username, password)
+	}
+	rec := httptest.NewRecorder()
+	s.DynDNSHandler().ServeHTTP(rec, req)
+	return rec
+}
+
+func responseLines(rec *httptest.ResponseRecorder) []string {
+	return strings.Split(strings.TrimSpace(rec.Body.String()), "\n")
+}
+
+func TestDynDNSAuthentication(t *testing.T) {
+	s, backend := newPushService(t)
+	tests := []struct {
+		name               string
+		username, password string
+	}{
+		{"no credentials", "", ""},
+		{"wrong password", "fritzbox", "wrong"},
+		{"unknown user", "router", "secret"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := push(s, tt.username, tt.password, "hostname=home.example.com&myip=203.0.113.1")
+			if rec.Code != http.StatusUnauthorized || strings.TrimSpace(rec.Body.String()) != "badauth" {
+				t.Fatalf("got %d %q, want 401 badauth", rec.Code, rec.Body.String())
+			}
+			if rec.Header().Get("WWW-Authenticate") == "" {
+				t.Error("no WWW-Authenticate challenge")
+			}
+		})
+	}
+	if len(backend.changes) > 0 {
+		t.Fatalf("unauthenticated pushes changed records: %v", backend.changes)
+	}
+}
+
+func TestDynDNSResponses(t *testing.T) {
+	s, backend := newPushService(t)
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{"no hostname", "myip=203.0.113.1", []string{"notfqdn"}},
+		{"not qualified", "hostname=home&myip=203.0.113.1", []string{"notfqdn"}},
+		{"too many hostnames", "hostname=" + strings.Repeat("home.example.com,", 21), []string{"numhost"}},
+		{"unknown hostname", "hostname=nas.example.com&myip=203.0.113.1", []string{"nohost"}},
+		{"another client's hostname", "hostname=lab.example.com&myip=203.0.113.1", []string{"nohost"}},
+		{"no record of the address type", "hostname=office.example.com&myip=2001:db8::1", []string{"nohost"}},
+		{"invalid myip", "hostname=home.example.com&myip=home", []string{"911"}},
+		{"first push", "hostname=home.example.com&myip=203.0.113.1", []string{"good 203.0.113.1"}},
+		{"repeated push", "hostname=home.example.com&myip=203.0.113.1", []string{"nochg 203.0.113.1"}},
+		{"both families in myip", "hostname=home.example.com&myip=203.0.113.2,2001:db8::2", []string{"good 203.0.113.2,2001:db8::2"}},
+		{"myipv6", "hostname=home.example.com&myip=203.0.113.2&myipv6=2001:db8::3", []string{"good 203.0.113.2,2001:db8::3"}},
+		{"source address", "hostname=office.example.com", []string{"good 198.51.100.7"}},
+		{"several hostnames", "hostname=home.example.com,office.example.com,lab.example.com&myip=203.0.113.4", []string{"good 203.0.113.4", "good 203.0.113.4", "nohost"}},
+	}
+	for _, tt := range tests {
+		changes := len(backend.changes)
+		rec := push(s, "fritzbox", "secret", tt.query)
+		if lines := responseLines(rec); rec.Code != http.StatusOK || !slices.Equal(lines, tt.want) {
+			t.Errorf("%s: got %d %q, want 200 %q", tt.name, rec.Code, lines, tt.want)
+		}
+		if changed := len(backend.changes) > changes; changed != strings.HasPrefix(tt.want[0], "good") {
+			t.Errorf("%s: records changed = %v (%v)", tt.name, changed, backend.changes[changes:])
+		}
+	}
+
+	for _, tt := range []struct {
+		name, rrType string
+		want         []string
+	}{
+		{"home", "A", []string{"203.0.113.4"}},
+		{"home", "AAAA", []string{"2001:db8::3"}},
+		{"office", "A", []string{"203.0.113.4"}},
+		{"lab", "A", nil},
+	} {
+		if got := backend.values(tt.name, hcloud.ZoneRRSetType(tt.rrType)); !slices.Equal(got, tt.want) {
+			t.Errorf("%s/%s = %v, want %v", tt.name, tt.rrType, got, tt.want)
+		}
+	}
+}
+
+func TestDynDNSPushedRecordsAreNotObserved(t *testing.T) {
+	s, backend := newPushService(t)
+	if rec := push(s, "fritzbox", "secret", "hostname=home.example.com&myip=203.0.113.1"); responseLines(rec)[0] != "good 203.0.113.1" {
+		t.Fatalf("push: %d %q", rec.Code, rec.Body.String())
+	}
+	// The sync keeps home at the pushed address; it has no source of its own.
+	s.syncOnce(context.Background())
+	if got := backend.values("home", "A"); !slices.Equal(got, []string{"203.0.113.1"}) {
+		t.Fatalf("home/A after sync = %v", got)
+	}
+}
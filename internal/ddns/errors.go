@@ -0,0 +1,71 @@
+package ddns
+
+import (
+	"errors"
+	"fmt"
+
+	"hetzner-ddns/internal/metrics"
+)
+
+type phaseError struct {
+	phase string
+	err   error
+}
+
+func (e *phaseError) Error() string {
+	return e.err.Error()
+}
+
+func (e *phaseError) Unwrap() error {
+	return e.err
+}
+
+func withPhase(phase string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &phaseError{phase: phase, err: err}
+}
+
+func errorPhase(err error, fallback string) string {
+	var pe *phaseError
+	if errors.As(err, &pe) {
+		return pe.phase
+	}
+	return fallback
+}
+
+type SyncError struct {
+	Failures []Failure
+}
+
+func (e *SyncError) Error() string {
+	return fmt.Sprintf("sync completed with %d error(s)", len(e.Failures))
+}
+
+func (e *SyncError) HasIPFailure() bool {
+	for _, f := range e.Failures {
+		if isIPPhase(f.Phase) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *SyncError) HasAPIFailure() bool {
+	for _, f := range e.Failures {
+		if !isIPPhase(f.Phase) {
+			return true
+		}
+	}
+	return false
+}
+
+func isIPPhase(phase string) bool {
+	switch phase {
+	case metrics.PhaseIPFetch, metrics.PhaseIPConsensus, metrics.PhaseIPPrefix:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,36 @@
+package ddns
+
+import (
+	"time"
+
+	"hetzner-ddns/internal/notify"
+)
+
+// notify hands an event to the notifier; dry runs send nothing.
+func (s *Service) notify(event notify.Event) {
+	if s.plan != nil {
+		return
+	}
+	s.notifier.Notify(event)
+}
+
+// trackRecovery sends sync_recovered for the first clean run after one or
+// more failed runs.
+func (s *Service) trackRecovery(start time.Time, failures []Failure) {
+	if s.plan != nil {
+		return
+	}
+	if len(failures) > 0 {
+		if s.failingSince.IsZero() {
+			s.failingSince = start
+		}
+		return
+	}
+	if s.failingSince.IsZero() {
+		return
+	}
+	since := s.failingSince
+	s.failingSince = time.Time{}
+	s.logger.Info("Sync recovered", "failing_since", since)
+	s.notify(notify.Event{Type: notify.EventSyncRecovered, Since: &since})
+}
@@ -0,0 +1,243 @@
+package ddns
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"slices"
+	"time"
+
+	"hetzner-ddns/internal/config"
+	"hetzner-ddns/internal/ip"
+	"hetzner-ddns/internal/metrics"
+	"hetzner-ddns/internal/state"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+)
+
+// firewallWork is a firewall that needs API calls this run.
+type firewallWork struct {
+	cfg   config.FirewallConfig
+	addrs map[string]net.IP
+}
+
+// firewallTarget names a firewall in state keys and metric labels, which are
+// shared with zones.
+func firewallTarget(name string) string {
+	return "firewall:" + name
+}
+
+func firewallSource(fwCfg config.FirewallConfig, recordType string) config.SourceConfig {
+	if recordFamily(recordType) == ip.IPv6 {
+		return fwCfg.IPv6Source
+	}
+	return fwCfg.IPv4Source
+}
+
+// prepareFirewall observes the firewall's addresses. It returns nil when no
+// address is available or none changed since the rules were last written.
+func (s *Service) prepareFirewall(ctx context.Context, run *syncRun, ipCache map[string]net.IP, fwCfg config.FirewallConfig, force bool) *firewallWork {
+	addrs := make(map[string]net.IP)
+	for _, recordType := range fwCfg.RecordTypes {
+		addr, err := s.observeIP(ctx, ipCache, "firewall", fwCfg.Name, firewallSource(fwCfg, recordType), recordType)
+		if err != nil {
+			s.failFirewall(run, fwCfg.Name, "", recordType, errorPhase(err, metrics.PhaseIPFetch), err)
+			continue
+		}
+		addrs[recordType] = addr
+	}
+	if len(addrs) == 0 {
+		return nil
+	}
+	if !force && s.firewallUnchanged(fwCfg, addrs) {
+		s.logger.Debug("Firewall rules unchanged since last sync; skipping API", "firewall", fwCfg.Name, "rules", len(fwCfg.Rules))
+		return nil
+	}
+	return &firewallWork{cfg: fwCfg, addrs: addrs}
+}
+
+func (s *Service) firewallUnchanged(fwCfg config.FirewallConfig, addrs map[string]net.IP) bool {
+	for _, rule := range fwCfg.Rules {
+		for recordType, addr := range addrs {
+			known, ok := s.state.Record(state.RecordKey(firewallTarget(fwCfg.Name), rule, recordType))
+			if !ok || known.Value != addr.String() {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// syncFirewall writes the observed addresses into the configured rules of one
+// firewall. All rules are replaced in a single call, so the firewall is read
+// first and every rule it does not manage is sent back unchanged.
+func (s *Service) syncFirewall(ctx context.Context, run *syncRun, fw *firewallWork) {
+	name := fw.cfg.Name
+	firewall, err := s.getFirewall(ctx, name)
+	if err != nil {
+		s.log(ctx).Error("Firewall lookup failed", "firewall", name, "error", err)
+		s.failFirewall(run, name, "", "", metrics.PhaseFirewallGet, fmt.Errorf("firewall %s lookup: %w", name, err))
+		return
+	}
+
+	rules := slices.Clone(firewall.Rules)
+	written := make(map[string]string)
+	changed := 0
+	for _, ruleName := range fw.cfg.Rules {
+		matched := false
+		for i := range rules {
+			rule := &rules[i]
+			if rule.Description == nil || *rule.Description != ruleName {
+				continue
+			}
+			matched = true
+			addresses := ruleAddresses(rule)
+			for _, recordType := range fw.cfg.RecordTypes {
+				addr, ok := fw.addrs[recordType]
+				if !ok {
+					continue
+				}
+				key := state.RecordKey(firewallTarget(name), ruleName, recordType)
+				written[key] = addr.String()
+				next := rewriteHosts(*addresses, addr, s.firewallIP(key))
+				current, target := netStrings(*addresses), netStrings(next)
+				if slices.Equal(sortedCopy(current), sortedCopy(target)) {
+					s.log(ctx).Info("Firewall rule already up to date", "firewall", name, "rule", ruleName, "record_type", recordType, "ip", addr.String())
+					continue
+				}
+				s.log(ctx).Info("Firewall rule will change", "firewall", name, "rule", ruleName, "direction", rule.Direction, "record_type", recordType, "current_values", current, "target_values", target)
+				if s.plan != nil {
+					s.plan.add(PlanEntry{Firewall: name, Record: ruleName, RecordType: recordType, Action: PlanRule, CurrentValues: current, TargetValues: target})
+				}
+				*addresses = next
+				changed++
+			}
+		}
+		if !matched {
+			s.log(ctx).Error("Firewall rule not found", "firewall", name, "rule", ruleName)
+			s.failFirewall(run, name, ruleName, "", metrics.PhaseFirewallGet, fmt.Errorf("firewall %s has no rule with description %q", name, ruleName))
+		}
+	}
+
+	if changed > 0 && s.plan == nil {
+		err := s.withRetry(ctx, "set firewall rules", func(opCtx context.Context) error {
+			s.log(ctx).Debug("API request: set firewall rules", "firewall", name, "rules", len(rules))
+			_, _, setErr := s.client.Firewall.SetRules(opCtx, firewall, hcloud.FirewallSetRulesOpts{Rules: rules})
+			return setErr
+		})
+		if err != nil {
+			s.log(ctx).Error("Firewall update failed", "firewall", name, "error", err)
+			s.failFirewall(run, name, "", "", metrics.PhaseFirewallSet, fmt.Errorf("firewall %s set rules: %w", name, err))
+			return
+		}
+		s.log(ctx).Info("Firewall rules updated", "firewall", name, "changes", changed)
+		for range changed {
+			s.metrics.FirewallRuleChanged(name)
+		}
+	}
+	for key, addr := range written {
+		s.rememberFirewallIP(key, addr)
+	}
+}
+
+func (s *Service) getFirewall(ctx context.Context, name string) (*hcloud.Firewall, error) {
+	var firewall *hcloud.Firewall
+	err := s.withRetry(ctx, "get firewall", func(opCtx context.Context) error {
+		s.log(ctx).Debug("API request: get firewall", "firewall", name)
+		var getErr error
+		firewall, _, getErr = s.client.Firewall.Get(opCtx, name)
+		if getErr != nil {
+			return getErr
+		}
+		if firewall == nil {
+			return permanent(fmt.Errorf("firewall not found: %s", name))
+		}
+		return nil
+	})
+	return firewall, err
+}
+
+// firewallIP returns the address last written for a rule and record type, or
+// "" when it is not known.
+func (s *Service) firewallIP(key string) string {
+	s.firewallMu.Lock()
+	defer s.firewallMu.Unlock()
+	if addr, ok := s.firewallIPs[key]; ok {
+		return addr
+	}
+	if s.state != nil {
+		known, _ := s.state.Record(key)
+		return known.Value
+	}
+	return ""
+}
+
+func (s *Service) rememberFirewallIP(key, addr string) {
+	if s.plan != nil {
+		return
+	}
+	s.firewallMu.Lock()
+	defer s.firewallMu.Unlock()
+	s.firewallIPs[key] = addr
+	if s.state != nil {
+		s.state.SetRecord(key, state.Record{Value: addr, UpdatedAt: time.Now().UTC()})
+	}
+}
+
+func (s *Service) failFirewall(run *syncRun, firewall, rule, recordType, phase string, err error) {
+	s.metrics.SyncError(firewallTarget(firewall), rule, phase)
+	run.mu.Lock()
+	defer run.mu.Unlock()
+	run.failures = append(run.failures, Failure{
+		Firewall:   firewall,
+		Record:     rule,
+		RecordType: recordType,
+		Phase:      phase,
+		Error:      err.Error(),
+	})
+}
+
+// ruleAddresses returns the remote side of a rule: the sources of incoming
+// rules and the destinations of outgoing ones.
+func ruleAddresses(rule *hcloud.FirewallRule) *[]net.IPNet {
+	if rule.Direction == hcloud.FirewallRuleDirectionOut {
+		return &rule.DestinationIPs
+	}
+	return &rule.SourceIPs
+}
+
+// rewriteHosts puts addr into nets as a single-address entry (/32 or /128) in
+// place of the one written on an earlier run. Networks, other hosts and the
+// other address family are kept. When the previous address is not known,
+// addr is only added: an entry we did not record may belong to someone else.
+func rewriteHosts(nets []net.IPNet, addr net.IP, previous string) []net.IPNet {
+	prevIP := net.ParseIP(previous)
+	result := make([]net.IPNet, 0, len(nets)+1)
+	for _, n := range nets {
+		ones, bits := n.Mask.Size()
+		if ones == bits && bits > 0 && (n.IP.Equal(addr) || n.IP.Equal(prevIP)) {
+			continue
+		}
+		result = append(result, n)
+	}
+	v4 := addr.To4() != nil
+	if v4 {
+		addr = addr.To4()
+	}
+	bits := len(addr) * 8
+	return append(result, net.IPNet{IP: addr, Mask: net.CIDRMask(bits, bits)})
+}
+
+func netStrings(nets []net.IPNet) []string {
+	values := make([]string, 0, len(nets))
+	for _, n := range nets {
+		values = append(values, n.String())
+	}
+	return values
+}
+
+func sortedCopy(values []string) []string {
+	values = slices.Clone(values)
+	slices.Sort(values)
+	return values
+}
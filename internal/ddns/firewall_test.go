@@ -0,0 +1,39 @@
+package ddns
+
+import (
+	"net"
+	"slices"
+	"testing"
+)
+
+func TestRewriteHosts(t *testing.T) {
+	tests := []struct {
+		name     string
+		nets     []string
+		addr     string
+		previous string
+		want     []string
+	}{
+		{"replaces previous", []string{"10.0.0.0/8", "203.0.113.1/32"}, "203.0.113.2", "203.0.113.1", []string{"10.0.0.0/8", "203.0.113.2/32"}},
+		{"unknown previous keeps lone host", []string{"198.51.100.7/32"}, "203.0.113.2", "", []string{"198.51.100.7/32", "203.0.113.2/32"}},
+		{"unknown previous keeps other hosts", []string{"198.51.100.7/32", "198.51.100.8/32"}, "203.0.113.2", "", []string{"198.51.100.7/32", "198.51.100.8/32", "203.0.113.2/32"}},
+		{"previous already gone", []string{"198.51.100.7/32"}, "203.0.113.2", "203.0.113.1", []string{"198.51.100.7/32", "203.0.113.2/32"}},
+		{"already present", []string{"203.0.113.2/32", "::/0"}, "203.0.113.2", "", []string{"::/0", "203.0.113.2/32"}},
+		{"network equal to previous kept", []string{"203.0.113.0/24"}, "203.0.113.2", "203.0.113.0", []string{"203.0.113.0/24", "203.0.113.2/32"}},
+		{"ipv6", []string{"2001:db8::1/128", "203.0.113.1/32"}, "2001:db8::2", "2001:db8::1", []string{"203.0.113.1/32", "2001:db8::2/128"}},
+	}
+	for _, tt := range tests {
+		var nets []net.IPNet
+		for _, cidr := range tt.nets {
+			_, n, err := net.ParseCIDR(cidr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			nets = append(nets, *n)
+		}
+		got := netStrings(rewriteHosts(nets, net.ParseIP(tt.addr), tt.previous))
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
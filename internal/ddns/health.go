@@ -0,0 +1,114 @@
+package ddns
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"hetzner-ddns/internal/config"
+)
+
+type Failure struct {
+	Zone       string `json:"zone,omitempty"`
+	Firewall   string `json:"firewall,omitempty"`
+	Record     string `json:"record,omitempty"`
+	RecordType string `json:"record_type,omitempty"`
+	Phase      string `json:"phase"`
+	Error      string `json:"error"`
+}
+
+type health struct {
+	mu          sync.Mutex
+	started     time.Time
+	maxAge      time.Duration
+	lastRun     time.Time
+	lastSuccess time.Time
+	failures    []Failure
+}
+
+type readiness struct {
+	Ready       bool          `json:"ready"`
+	Reason      string        `json:"reason,omitempty"`
+	LastSync    *time.Time    `json:"last_sync,omitempty"`
+	LastSuccess *time.Time    `json:"last_success,omitempty"`
+	MaxAge      string        `json:"max_age"`
+	Circuit     circuitStatus `json:"circuit"`
+	Failures    []Failure     `json:"failures"`
+}
+
+func newHealth(cfg config.Config) *health {
+	h := &health{started: time.Now()}
+	h.configure(cfg)
+	return h
+}
+
+func (h *health) configure(cfg config.Config) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.maxAge = cfg.Interval * time.Duration(cfg.ReadyIntervals)
+}
+
+func (h *health) finish(at time.Time, failures []Failure) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastRun = at
+	h.failures = failures
+	if len(failures) == 0 {
+		h.lastSuccess = at
+	}
+}
+
+func (h *health) readiness(now time.Time) readiness {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	r := readiness{
+		MaxAge:   h.maxAge.String(),
+		Failures: append([]Failure{}, h.failures...),
+	}
+	if !h.lastRun.IsZero() {
+		lastRun := h.lastRun
+		r.LastSync = &lastRun
+	}
+	if !h.lastSuccess.IsZero() {
+		lastSuccess := h.lastSuccess
+		r.LastSuccess = &lastSuccess
+	}
+	switch {
+	case h.lastSuccess.IsZero() && now.Sub(h.started) < h.maxAge:
+		r.Reason = "no successful sync yet"
+	case h.lastSuccess.IsZero():
+		r.Reason = fmt.Sprintf("no successful sync since start %s ago", now.Sub(h.started).Round(time.Second))
+	case now.Sub(h.lastSuccess) > h.maxAge:
+		r.Reason = fmt.Sprintf("last successful sync %s ago", now.Sub(h.lastSuccess).Round(time.Second))
+	default:
+		r.Ready = true
+	}
+	return r
+}
+
+func (s *Service) LivenessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	})
+}
+
+func (s *Service) ReadinessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		now := time.Now()
+		status := s.health.readiness(now)
+		status.Circuit = s.breaker.status(now)
+		code := http.StatusOK
+		if !status.Ready {
+			code = http.StatusServiceUnavailable
+		}
+		writeJSON(w, code, status)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, code int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(body)
+}
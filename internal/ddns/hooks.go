@@ -0,0 +1,88 @@
+package ddns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"hetzner-ddns/internal/config"
+	"hetzner-ddns/internal/metrics"
+)
+
+const (
+	hookPreUpdate  = "pre-update"
+	hookPostUpdate = "post-update"
+)
+
+// Output beyond this is cut off in the log.
+const maxHookOutput = 4096
+
+// beforeUpdate runs PRE_UPDATE_HOOK before a record value is created or
+// changed. With HOOK_FAILURE_POLICY=abort a failing hook cancels the update.
+func (s *Service) beforeUpdate(ctx context.Context, zoneName string, rec desiredRecord, oldValues []string) error {
+	return s.runHook(ctx, hookPreUpdate, s.cfg.PreUpdateHook, zoneName, rec, oldValues, "")
+}
+
+// afterUpdate runs POST_UPDATE_HOOK once the update was attempted; RESULT
+// tells the hook whether it succeeded. With HOOK_FAILURE_POLICY=abort a
+// failing hook fails the record, although the DNS change stays in place.
+func (s *Service) afterUpdate(ctx context.Context, zoneName string, rec desiredRecord, oldValues []string, updateErr error) error {
+	result := "success"
+	if updateErr != nil {
+		result = "failure"
+	}
+	return s.runHook(ctx, hookPostUpdate, s.cfg.PostUpdateHook, zoneName, rec, oldValues, result)
+}
+
+func (s *Service) runHook(ctx context.Context, hook, command, zoneName string, rec desiredRecord, oldValues []string, result string) error {
+	if command == "" || s.plan != nil {
+		return nil
+	}
+	// Hooks often restart shared services, so they never run concurrently.
+	s.hookMu.Lock()
+	defer s.hookMu.Unlock()
+
+	hookCtx, cancel := context.WithTimeout(ctx, s.cfg.HookTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(hookCtx, "sh", "-c", command)
+	cmd.Env = append(os.Environ(),
+		"HOOK="+hook,
+		"ZONE="+zoneName,
+		"RECORD="+rec.name,
+		"RECORD_TYPE="+rec.recordType,
+		"OLD_IP="+strings.Join(oldValues, ","),
+		"NEW_IP="+rec.value,
+		"RESULT="+result,
+	)
+	cmd.WaitDelay = time.Second
+
+	s.log(ctx).Info("Running hook", "hook", hook, "zone", zoneName, "record", rec.name, "record_type", rec.recordType)
+	start := time.Now()
+	output, err := cmd.CombinedOutput()
+	attrs := []any{"hook", hook, "zone", zoneName, "record", rec.name, "record_type", rec.recordType, "duration", time.Since(start).Round(time.Millisecond).String(), "output", hookOutput(output)}
+	if err == nil {
+		s.log(ctx).Info("Hook finished", attrs...)
+		return nil
+	}
+	if errors.Is(hookCtx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("timed out after %s", s.cfg.HookTimeout)
+	}
+	if s.cfg.HookFailure != config.HookAbort {
+		s.log(ctx).Warn("Hook failed; continuing", append(attrs, "error", err)...)
+		return nil
+	}
+	s.log(ctx).Error("Hook failed", append(attrs, "error", err)...)
+	return withPhase(metrics.PhaseHook, fmt.Errorf("%s hook: %w", hook, err))
+}
+
+func hookOutput(output []byte) string {
+	text := strings.TrimSpace(string(output))
+	if len(text) > maxHookOutput {
+		text = text[:maxHookOutput] + "..."
+	}
+	return text
+}
@@ -0,0 +1,145 @@
+package ddns
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"hetzner-ddns/internal/config"
+	"hetzner-ddns/internal/metrics"
+)
+
+// newHookService returns a service whose hooks run with sh, skipping the test
+// where there is none.
+func newHookService(t *testing.T, backend *memoryBackend, policy string) *Service {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("hooks run with sh")
+	}
+	cfg := testConfig()
+	cfg.HookTimeout = 5 * time.Second
+	cfg.HookFailure = policy
+	return newTestService(t, cfg, backend, nil)
+}
+
+func TestHookEnvironment(t *testing.T) {
+	s := newHookService(t, newMemoryBackend(), config.HookIgnore)
+	out := filepath.Join(t.TempDir(), "env")
+	command := `printf '%s\n' "$HOOK" "$ZONE" "$RECORD" "$RECORD_TYPE" "$OLD_IP" "$NEW_IP" "$RESULT" >> ` + out
+	s.cfg.PreUpdateHook, s.cfg.PostUpdateHook = command, command
+	rec := desiredRecord{name: "www", recordType: "AAAA", value: "2001:db8::2"}
+	old := []string{"2001:db8::1", "2001:db8::3"}
+
+	if err := s.beforeUpdate(context.Background(), "example.com", rec, old); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.afterUpdate(context.Background(), "example.com", rec, old, errors.New("set failed")); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "pre-update\nexample.com\nwww\nAAAA\n2001:db8::1,2001:db8::3\n2001:db8::2\n\n" +
+		"post-update\nexample.com\nwww\nAAAA\n2001:db8::1,2001:db8::3\n2001:db8::2\nfailure\n"
+	if string(data) != want {
+		t.Fatalf("hook environment:\n%s\nwant:\n%s", data, want)
+	}
+}
+
+func TestHookFailurePolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  string
+		command string
+		timeout time.Duration
+		want    string
+	}{
+		{"ignored failure", config.HookIgnore, "echo oops >&2; exit 3", time.Second, ""},
+		{"aborting failure", config.HookAbort, "echo oops >&2; exit 3", time.Second, "pre-update hook: exit status 3"},
+		{"ignored timeout", config.HookIgnore, "exec sleep 10", 100 * time.Millisecond, ""},
+		{"aborting timeout", config.HookAbort, "exec sleep 10", 100 * time.Millisecond, "pre-update hook: timed out after 100ms"},
+		{"success", config.HookAbort, "exit 0", time.Second, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newHookService(t, newMemoryBackend(), tt.policy)
+			s.cfg.PreUpdateHook = tt.command
+			s.cfg.HookTimeout = tt.timeout
+			start := time.Now()
+			err := s.beforeUpdate(context.Background(), "example.com", desiredRecord{name: "www", recordType: "A", value: "203.0.113.1"}, nil)
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Fatalf("hook ran for %v", elapsed)
+			}
+			if tt.want == "" {
+				if err != nil {
+					t.Fatalf("err = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.want || errorPhase(err, "") != metrics.PhaseHook {
+				t.Fatalf("err = %v (phase %q), want %q in phase %s", err, errorPhase(err, ""), tt.want, metrics.PhaseHook)
+			}
+		})
+	}
+}
+
+func TestHooksAroundRecordUpdate(t *testing.T) {
+	rec := desiredRecord{name: "www", recordType: "A", value: "203.0.113.2"}
+
+	t.Run("aborting pre-update hook", func(t *testing.T) {
+		backend := newMemoryBackend()
+		backend.put("www", "A", "203.0.113.1")
+		s := newHookService(t, backend, config.HookAbort)
+		s.cfg.PreUpdateHook = "exit 1"
+		if _, _, err := s.updateRecord(context.Background(), testZone(backend), rec, nil); errorPhase(err, "") != metrics.PhaseHook {
+			t.Fatalf("err = %v, want a hook failure", err)
+		}
+		if len(backend.changes) > 0 {
+			t.Fatalf("record changed despite the failed pre-update hook: %v", backend.changes)
+		}
+	})
+
+	t.Run("failing post-update hook", func(t *testing.T) {
+		backend := newMemoryBackend()
+		backend.put("www", "A", "203.0.113.1")
+		s := newHookService(t, backend, config.HookAbort)
+		s.cfg.PostUpdateHook = `test "$RESULT" = success && exit 1`
+		if _, _, err := s.updateRecord(context.Background(), testZone(backend), rec, nil); errorPhase(err, "") != metrics.PhaseHook {
+			t.Fatalf("err = %v, want a hook failure", err)
+		}
+		if got := backend.values("www", "A"); len(got) != 1 || got[0] != "203.0.113.2" {
+			t.Fatalf("www/A = %v; the update must stay in place", got)
+		}
+	})
+
+	t.Run("dry run", func(t *testing.T) {
+		backend := newMemoryBackend()
+		backend.put("www", "A", "203.0.113.1")
+		s := newHookService(t, backend, config.HookAbort)
+		out := filepath.Join(t.TempDir(), "ran")
+		s.cfg.PreUpdateHook, s.cfg.PostUpdateHook = "touch "+out, "touch "+out
+		s.plan = &Plan{}
+		if _, _, err := s.updateRecord(context.Background(), testZone(backend), rec, nil); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(out); !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("hook ran in a dry run: %v", err)
+		}
+	})
+}
+
+func TestHookOutputIsTruncated(t *testing.T) {
+	long := strings.Repeat("x", maxHookOutput+10)
+	if got := hookOutput([]byte("  " + long + "\n")); got != long[:maxHookOutput]+"..." {
+		t.Fatalf("hookOutput kept %d bytes", len(got))
+	}
+	if got := hookOutput([]byte("done\n")); got != "done" {
+		t.Fatalf("hookOutput = %q", got)
+	}
+}
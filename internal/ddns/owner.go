@@ -0,0 +1,200 @@
+package ddns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"hetzner-ddns/internal/metrics"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+)
+
+// Ownership markers follow external-dns: every record the updater manages has
+// a TXT RRSet next to it, named TXT_PREFIX + record name, holding one value per
+// record type that names the owner. Records without our marker are left alone
+// unless the record is configured to be adopted.
+
+const heritage = "hetzner-ddns"
+
+const txtType = hcloud.ZoneRRSetType("TXT")
+
+func (s *Service) ownerMarkerName(name string) string {
+	if name == "@" {
+		return strings.TrimRight(s.cfg.TXTPrefix, ".-")
+	}
+	return s.cfg.TXTPrefix + name
+}
+
+func (s *Service) ownerMarkerValue(rrType hcloud.ZoneRRSetType) string {
+	return fmt.Sprintf(`"heritage=%s,%s/owner=%s,%s/record-type=%s"`, heritage, heritage, s.cfg.TXTOwnerID, heritage, rrType)
+}
+
+// errNotOwned marks an RRSet the updater may not change because it carries no
+// marker of ours, or because another owner has claimed it.
+var errNotOwned = errors.New("not owned by this updater")
+
+// checkOwnership returns an error unless the existing RRSet carries our marker.
+// With adopt set, a missing marker is written instead.
+func (s *Service) checkOwnership(ctx context.Context, zone *targetZone, rrset *hcloud.ZoneRRSet, adopt bool) error {
+	if s.cfg.TXTOwnerID == "" {
+		return nil
+	}
+	marker, owners, err := s.getOwnerMarker(ctx, zone, rrset.Name, rrset.Type)
+	if err != nil {
+		return err
+	}
+	if slices.Contains(owners, s.cfg.TXTOwnerID) {
+		return nil
+	}
+	if !adopt {
+		return withPhase(metrics.PhaseOwnership, fmt.Errorf("rrset %s/%s is %w %q; set adopt on the record to take it over", rrset.Name, rrset.Type, errNotOwned, s.cfg.TXTOwnerID))
+	}
+	s.log(ctx).Warn("Adopting record not owned by this updater", "zone", zone.key, "record", rrset.Name, "record_type", rrset.Type, "owner_id", s.cfg.TXTOwnerID, "other_owners", owners)
+	return s.writeOwnerMarker(ctx, zone, marker, rrset.Name, rrset.Type)
+}
+
+// claimOwnership writes our marker before a new RRSet is created, so a record
+// never exists without one. A marker left by another owner is only taken over
+// with adopt set.
+func (s *Service) claimOwnership(ctx context.Context, zone *targetZone, name string, rrType hcloud.ZoneRRSetType, adopt bool) error {
+	if s.cfg.TXTOwnerID == "" {
+		return nil
+	}
+	marker, owners, err := s.getOwnerMarker(ctx, zone, name, rrType)
+	if err != nil || slices.Contains(owners, s.cfg.TXTOwnerID) {
+		return err
+	}
+	if len(owners) > 0 {
+		if !adopt {
+			return withPhase(metrics.PhaseOwnership, fmt.Errorf("rrset %s/%s is %w %q but claimed by %q; set adopt on the record to take it over", name, rrType, errNotOwned, s.cfg.TXTOwnerID, owners[0]))
+		}
+		s.log(ctx).Warn("Adopting record claimed by another owner", "zone", zone.key, "record", name, "record_type", rrType, "owner_id", s.cfg.TXTOwnerID, "other_owners", owners)
+	}
+	return s.writeOwnerMarker(ctx, zone, marker, name, rrType)
+}
+
+// getOwnerMarker returns the marker RRSet of a record name, if any, and the
+// owner IDs its values claim the record type for.
+func (s *Service) getOwnerMarker(ctx context.Context, zone *targetZone, name string, rrType hcloud.ZoneRRSetType) (*hcloud.ZoneRRSet, []string, error) {
+	markerName := s.ownerMarkerName(name)
+	var marker *hcloud.ZoneRRSet
+	err := s.retryOn(ctx, zone.breaker, "get owner marker", func(opCtx context.Context) error {
+		s.log(ctx).Debug("API request: get owner marker", "zone", zone.key, "record", markerName)
+		var getErr error
+		marker, getErr = zone.backend.GetRRSet(opCtx, zone.Zone, markerName, txtType)
+		return getErr
+	})
+	if err != nil {
+		return nil, nil, withPhase(metrics.PhaseOwnership, fmt.Errorf("get owner marker %s: %w", markerName, err))
+	}
+	if marker == nil {
+		return nil, nil, nil
+	}
+	var owners []string
+	for _, value := range rrsetValues(marker) {
+		if owner, claimed, ok := parseOwnerMarker(value); ok && claimed == rrType {
+			owners = append(owners, owner)
+		}
+	}
+	return marker, owners, nil
+}
+
+// parseOwnerMarker returns the owner ID and record type of a marker value.
+func parseOwnerMarker(value string) (string, hcloud.ZoneRRSetType, bool) {
+	fields := make(map[string]string)
+	for _, part := range strings.Split(strings.Trim(value, `"`), ",") {
+		key, val, _ := strings.Cut(part, "=")
+		fields[key] = val
+	}
+	if fields["heritage"] != heritage {
+		return "", "", false
+	}
+	return fields[heritage+"/owner"], hcloud.ZoneRRSetType(fields[heritage+"/record-type"]), true
+}
+
+// removeOwnerMarker drops our marker value for a record type once its RRSet
+// is gone, deleting the marker RRSet when no other value is left.
+func (s *Service) removeOwnerMarker(ctx context.Context, zone *targetZone, name string, rrType hcloud.ZoneRRSetType) error {
+	if s.cfg.TXTOwnerID == "" {
+		return nil
+	}
+	marker, owners, err := s.getOwnerMarker(ctx, zone, name, rrType)
+	if err != nil || !slices.Contains(owners, s.cfg.TXTOwnerID) {
+		return err
+	}
+	markerName := s.ownerMarkerName(name)
+	value := s.ownerMarkerValue(rrType)
+	values := rrsetValues(marker)
+	remaining := slices.DeleteFunc(slices.Clone(values), func(v string) bool { return v == value })
+	if s.plan != nil {
+		entry := PlanEntry{Zone: zone.key, Record: markerName, RecordType: string(txtType), Action: PlanWithdraw, CurrentValues: values, TargetValues: remaining}
+		if len(remaining) == 0 {
+			entry.Action = PlanDelete
+			entry.TargetValues = []string{}
+		}
+		s.plan.add(entry)
+		return nil
+	}
+
+	if len(remaining) == 0 {
+		err = s.retryOn(ctx, zone.breaker, "delete owner marker", func(opCtx context.Context) error {
+			s.log(ctx).Debug("API request: delete owner marker", "zone", zone.key, "record", markerName)
+			return zone.backend.DeleteRRSet(opCtx, marker)
+		})
+	} else {
+		err = s.retryOn(ctx, zone.breaker, "remove owner marker", func(opCtx context.Context) error {
+			s.log(ctx).Debug("API request: remove owner marker", "zone", zone.key, "record", markerName)
+			return zone.backend.RemoveRecords(opCtx, marker, hcloud.ZoneRRSetRemoveRecordsOpts{
+				Records: []hcloud.ZoneRRSetRecord{{Value: value}},
+			})
+		})
+	}
+	if err != nil {
+		return withPhase(metrics.PhaseOwnership, fmt.Errorf("remove owner marker %s: %w", markerName, err))
+	}
+	s.log(ctx).Info("Owner marker removed", "zone", zone.key, "record", name, "record_type", rrType, "marker", markerName)
+	return nil
+}
+
+func (s *Service) writeOwnerMarker(ctx context.Context, zone *targetZone, marker *hcloud.ZoneRRSet, name string, rrType hcloud.ZoneRRSetType) error {
+	markerName := s.ownerMarkerName(name)
+	value := s.ownerMarkerValue(rrType)
+	if s.plan != nil {
+		entry := PlanEntry{Zone: zone.key, Record: markerName, RecordType: string(txtType), Action: PlanCreate, TargetValues: []string{value}}
+		if marker != nil {
+			entry.Action = PlanAppend
+			entry.CurrentValues = rrsetValues(marker)
+			entry.TargetValues = append(rrsetValues(marker), value)
+		}
+		s.plan.add(entry)
+		return nil
+	}
+
+	var err error
+	if marker == nil {
+		err = s.retryOn(ctx, zone.breaker, "create owner marker", func(opCtx context.Context) error {
+			s.log(ctx).Debug("API request: create owner marker", "zone", zone.key, "record", markerName)
+			_, createErr := zone.backend.CreateRRSet(opCtx, zone.Zone, hcloud.ZoneRRSetCreateOpts{
+				Name:    markerName,
+				Type:    txtType,
+				Records: []hcloud.ZoneRRSetRecord{{Value: value}},
+			})
+			return createErr
+		})
+	} else {
+		err = s.retryOn(ctx, zone.breaker, "add owner marker", func(opCtx context.Context) error {
+			s.log(ctx).Debug("API request: add owner marker", "zone", zone.key, "record", markerName)
+			return zone.backend.AddRecords(opCtx, marker, hcloud.ZoneRRSetAddRecordsOpts{
+				Records: []hcloud.ZoneRRSetRecord{{Value: value}},
+			})
+		})
+	}
+	if err != nil {
+		return withPhase(metrics.PhaseOwnership, fmt.Errorf("write owner marker %s: %w", markerName, err))
+	}
+	s.log(ctx).Info("Owner marker written", "zone", zone.key, "record", name, "record_type", rrType, "marker", markerName)
+	return nil
+}
@@ -0,0 +1,74 @@
+package ddns
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"hetzner-ddns/internal/config"
+)
+
+const otherMarker = `"heritage=hetzner-ddns,hetzner-ddns/owner=terraform,hetzner-ddns/record-type=A"`
+
+func TestUpdateRecordSkipsUnownedUpToDate(t *testing.T) {
+	backend := newMemoryBackend()
+	backend.put("www", "A", "203.0.113.1")
+	cfg := testConfig()
+	cfg.TXTOwnerID = "home"
+	s := newTestService(t, cfg, backend, nil)
+	zone := testZone(backend)
+
+	_, _, err := s.updateRecord(context.Background(), zone, desiredRecord{name: "www", recordType: "A", value: "203.0.113.1"}, nil)
+	if err != nil {
+		t.Fatalf("up-to-date unowned record failed: %v", err)
+	}
+	_, _, err = s.updateRecord(context.Background(), zone, desiredRecord{name: "www", recordType: "A", value: "203.0.113.2"}, nil)
+	if !errors.Is(err, errNotOwned) {
+		t.Fatalf("got %v, want errNotOwned", err)
+	}
+	if len(backend.changes) > 0 {
+		t.Fatalf("unowned record was changed: %v", backend.changes)
+	}
+}
+
+func TestClaimOwnershipRefusesOtherOwner(t *testing.T) {
+	backend := newMemoryBackend()
+	backend.put("_hetzner-ddns.www", "TXT", otherMarker)
+	cfg := testConfig()
+	cfg.TXTOwnerID = "home"
+	s := newTestService(t, cfg, backend, nil)
+	zone := testZone(backend)
+	rec := desiredRecord{name: "www", recordType: "A", value: "203.0.113.1"}
+
+	_, _, err := s.updateRecord(context.Background(), zone, rec, nil)
+	if !errors.Is(err, errNotOwned) {
+		t.Fatalf("got %v, want errNotOwned", err)
+	}
+	if backend.values("www", "A") != nil {
+		t.Fatal("record created despite another owner's marker")
+	}
+
+	rec.adopt = true
+	if _, _, err := s.updateRecord(context.Background(), zone, rec, nil); err != nil {
+		t.Fatalf("adopt: %v", err)
+	}
+	markers := backend.values("_hetzner-ddns.www", "TXT")
+	if !slices.Contains(markers, s.ownerMarkerValue("A")) || !slices.Contains(markers, otherMarker) {
+		t.Fatalf("markers = %v", markers)
+	}
+	if got := backend.values("www", "A"); !slices.Equal(got, []string{"203.0.113.1"}) {
+		t.Fatalf("record = %v", got)
+	}
+}
+
+func TestParseOwnerMarker(t *testing.T) {
+	s := newTestService(t, config.Config{TXTOwnerID: "home", Interval: 1}, newMemoryBackend(), nil)
+	owner, rrType, ok := parseOwnerMarker(s.ownerMarkerValue("AAAA"))
+	if !ok || owner != "home" || rrType != "AAAA" {
+		t.Fatalf("got %q %q %v", owner, rrType, ok)
+	}
+	if _, _, ok := parseOwnerMarker(`"v=spf1 -all"`); ok {
+		t.Fatal("parsed an unrelated TXT value as marker")
+	}
+}
@@ -0,0 +1,122 @@
+package ddns
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+	"text/tabwriter"
+)
+
+const (
+	PlanCreate    = "create"
+	PlanAppend    = "append"
+	PlanReplace   = "replace"
+	PlanTTLChange = "ttl-change"
+	PlanPrune     = "prune"
+	PlanWithdraw  = "withdraw"
+	PlanDelete    = "delete"
+	PlanRule      = "set-rule"
+	PlanPTR       = "set-ptr"
+)
+
+type PlanEntry struct {
+	Zone          string   `json:"zone,omitempty"`
+	Firewall      string   `json:"firewall,omitempty"`
+	Record        string   `json:"record"`
+	RecordType    string   `json:"record_type"`
+	Action        string   `json:"action"`
+	CurrentValues []string `json:"current_values"`
+	TargetValues  []string `json:"target_values"`
+	CurrentTTL    *int     `json:"current_ttl,omitempty"`
+	TargetTTL     *int     `json:"target_ttl,omitempty"`
+}
+
+type Plan struct {
+	mu       sync.Mutex
+	Changes  []PlanEntry `json:"changes"`
+	Failures []Failure   `json:"failures"`
+}
+
+// DryRun performs a single full reconcile in which every mutating API call is
+// recorded in the returned plan instead of being sent. Lookups still hit the
+// API so the plan reflects the live zone; the state file is left untouched.
+func (s *Service) DryRun(ctx context.Context) (*Plan, error) {
+	plan := &Plan{Changes: []PlanEntry{}, Failures: []Failure{}}
+	s.plan = plan
+	defer func() { s.plan = nil }()
+	err := s.syncOnce(ctx)
+	// Records are planned concurrently; sort for a stable plan.
+	slices.SortStableFunc(plan.Changes, func(a, b PlanEntry) int {
+		return cmp.Or(cmp.Compare(a.Firewall, b.Firewall), cmp.Compare(a.Zone, b.Zone), cmp.Compare(a.Record, b.Record))
+	})
+	var syncErr *SyncError
+	if errors.As(err, &syncErr) {
+		plan.Failures = syncErr.Failures
+	}
+	return plan, err
+}
+
+func (p *Plan) add(entry PlanEntry) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if entry.CurrentValues == nil {
+		entry.CurrentValues = []string{}
+	}
+	p.Changes = append(p.Changes, entry)
+}
+
+func (p *Plan) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(p)
+}
+
+func (p *Plan) WriteText(w io.Writer) error {
+	if len(p.Changes) == 0 {
+		fmt.Fprintln(w, "No changes. All records are up to date.")
+	} else {
+		fmt.Fprintf(w, "Plan: %d change(s)\n\n", len(p.Changes))
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "ACTION\tZONE\tRECORD\tTYPE\tCURRENT\tTARGET")
+		for _, entry := range p.Changes {
+			current, target := planValues(entry.CurrentValues), planValues(entry.TargetValues)
+			if entry.Action == PlanTTLChange {
+				current, target = "ttl "+planTTL(entry.CurrentTTL), "ttl "+planTTL(entry.TargetTTL)
+			} else if entry.TargetTTL != nil {
+				target += " (ttl " + planTTL(entry.TargetTTL) + ")"
+			}
+			zone := entry.Zone
+			if entry.Firewall != "" {
+				zone = "firewall " + entry.Firewall
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", entry.Action, zone, entry.Record, entry.RecordType, current, target)
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+	if len(p.Failures) > 0 {
+		fmt.Fprintf(w, "\n%d record(s) could not be planned:\n", len(p.Failures))
+		for _, f := range p.Failures {
+			fmt.Fprintf(w, "  %s: %s\n", f.Phase, f.Error)
+		}
+	}
+	return nil
+}
+
+func planValues(values []string) string {
+	if len(values) == 0 {
+		return "-"
+	}
+	return strings.Join(values, ",")
+}
+
+func planTTL(ttl *int) string {
+	return fmt.Sprint(ttlValue(ttl))
+}
@@ -0,0 +1,59 @@
+package ddns
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestPlanValueAndTTLChangeIsOneEntry(t *testing.T) {
+	ttl := func(v int) *int { return &v }
+	tests := []struct {
+		name     string
+		values   []string
+		preserve bool
+		ttl      *int
+		action   string
+		wantTTL  *int
+	}{
+		{"replace with new ttl", []string{"203.0.113.1"}, false, ttl(60), PlanReplace, ttl(60)},
+		{"replace with same ttl", []string{"203.0.113.1"}, false, ttl(300), PlanReplace, nil},
+		{"replace without ttl", []string{"203.0.113.1"}, false, nil, PlanReplace, nil},
+		{"append with new ttl", []string{"203.0.113.1", "198.51.100.1"}, true, ttl(60), PlanAppend, ttl(60)},
+		{"ttl only", []string{"203.0.113.2"}, false, ttl(60), PlanTTLChange, ttl(60)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := newMemoryBackend()
+			backend.put("www", "A", tt.values...)
+			backend.rrsets[memoryKey("www", "A")].TTL = ttl(300)
+			cfg := testConfig()
+			cfg.PreserveRecords = tt.preserve
+			s := newTestService(t, cfg, backend, nil)
+			s.plan = &Plan{}
+
+			if _, _, err := s.updateRecord(context.Background(), testZone(backend), desiredRecord{name: "www", recordType: "A", value: "203.0.113.2", ttl: tt.ttl}, nil); err != nil {
+				t.Fatal(err)
+			}
+			if len(backend.changes) > 0 {
+				t.Fatalf("dry run changed records: %v", backend.changes)
+			}
+			if len(s.plan.Changes) != 1 {
+				t.Fatalf("plan = %+v, want one change", s.plan.Changes)
+			}
+			entry := s.plan.Changes[0]
+			if entry.Action != tt.action || ttlValue(entry.TargetTTL) != ttlValue(tt.wantTTL) || ttlValue(entry.CurrentTTL) != 300 {
+				t.Fatalf("entry = %s current ttl %v target ttl %v, want %s target ttl %v", entry.Action, ttlValue(entry.CurrentTTL), ttlValue(entry.TargetTTL), tt.action, ttlValue(tt.wantTTL))
+			}
+
+			var text bytes.Buffer
+			if err := s.plan.WriteText(&text); err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.Count(text.String(), "ttl 60"); (tt.wantTTL != nil) != (got > 0) || got > 1 {
+				t.Errorf("text plan mentions the new ttl %d times:\n%s", got, text.String())
+			}
+		})
+	}
+}
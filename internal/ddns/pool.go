@@ -0,0 +1,105 @@
+package ddns
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+)
+
+type loggerKey struct{}
+
+// log returns the logger for ctx: inside forEach that is the task's buffered
+// logger, otherwise the service logger.
+func (s *Service) log(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return s.logger
+}
+
+// forEach calls fn for every index below n on at most CONCURRENCY goroutines.
+// Log output of each call is held back and written once all calls with a lower
+// index are done, so a concurrent run logs in the same order as a sequential
+// one.
+func (s *Service) forEach(ctx context.Context, n int, fn func(ctx context.Context, i int)) {
+	if n == 0 {
+		return
+	}
+	workers := min(s.concurrency(), n)
+
+	buffers := make([]*logBuffer, n)
+	done := make([]bool, n)
+	next := 0
+	var mu sync.Mutex
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				buf := &logBuffer{}
+				buffers[i] = buf
+				logger := slog.New(&bufferHandler{buf: buf, next: s.logger.Handler()})
+				fn(context.WithValue(ctx, loggerKey{}, logger), i)
+
+				mu.Lock()
+				done[i] = true
+				for next < n && done[next] {
+					buffers[next].flush(ctx)
+					buffers[next] = nil
+					next++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for i := range n {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+type bufferedRecord struct {
+	handler slog.Handler
+	record  slog.Record
+}
+
+type logBuffer struct {
+	mu      sync.Mutex
+	records []bufferedRecord
+}
+
+func (b *logBuffer) flush(ctx context.Context) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, entry := range b.records {
+		entry.handler.Handle(ctx, entry.record)
+	}
+	b.records = nil
+}
+
+type bufferHandler struct {
+	buf  *logBuffer
+	next slog.Handler
+}
+
+func (h *bufferHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *bufferHandler) Handle(_ context.Context, record slog.Record) error {
+	h.buf.mu.Lock()
+	defer h.buf.mu.Unlock()
+	h.buf.records = append(h.buf.records, bufferedRecord{handler: h.next, record: record.Clone()})
+	return nil
+}
+
+func (h *bufferHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &bufferHandler{buf: h.buf, next: h.next.WithAttrs(attrs)}
+}
+
+func (h *bufferHandler) WithGroup(name string) slog.Handler {
+	return &bufferHandler{buf: h.buf, next: h.next.WithGroup(name)}
+}
@@ -0,0 +1,125 @@
+package ddns
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// logLines returns the messages written to out, one per record.
+func logLines(out *bytes.Buffer) []string {
+	var lines []string
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		_, msg, _ := strings.Cut(line, "msg=")
+		lines = append(lines, msg)
+	}
+	return lines
+}
+
+// occupancy counts the calls running at once and the most seen so far.
+type occupancy struct {
+	running, peak atomic.Int32
+}
+
+func (o *occupancy) enter() int32 {
+	cur := o.running.Add(1)
+	for {
+		old := o.peak.Load()
+		if cur <= old || o.peak.CompareAndSwap(old, cur) {
+			return cur
+		}
+	}
+}
+
+func (o *occupancy) leave() {
+	o.running.Add(-1)
+}
+
+func TestForEachLogsInIndexOrder(t *testing.T) {
+	const n, workers = 6, 3
+	cfg := testConfig()
+	cfg.Concurrency = workers
+	s := newTestService(t, cfg, newMemoryBackend(), nil)
+	var out bytes.Buffer
+	s.logger = slog.New(slog.NewTextHandler(&out, &slog.HandlerOptions{
+		ReplaceAttr: func(_ []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey || a.Key == slog.LevelKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	}))
+
+	// Item 0 finishes last: it waits until every other item is done, so the
+	// others run and finish on the remaining workers while it holds its own.
+	var others sync.WaitGroup
+	others.Add(n - 1)
+	var pool occupancy
+	results := make([]int, n)
+	s.forEach(context.Background(), n, func(ctx context.Context, i int) {
+		pool.enter()
+		defer pool.leave()
+
+		s.log(ctx).Info(fmt.Sprintf("start-%d", i))
+		if i == 0 {
+			others.Wait()
+		} else {
+			defer others.Done()
+		}
+		results[i] = i * i
+		s.log(ctx).Info(fmt.Sprintf("end-%d", i))
+	})
+
+	var want []string
+	for i := range n {
+		want = append(want, fmt.Sprintf("start-%d", i), fmt.Sprintf("end-%d", i))
+		if results[i] != i*i {
+			t.Errorf("results[%d] = %d, want %d", i, results[i], i*i)
+		}
+	}
+	if got := logLines(&out); strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Fatalf("log order = %v, want %v", got, want)
+	}
+	if p := pool.peak.Load(); p > workers || p < 2 {
+		t.Fatalf("peak concurrency = %d, want between 2 and %d", p, workers)
+	}
+}
+
+func TestForEachRespectsConcurrency(t *testing.T) {
+	for _, workers := range []int{1, 2, 4} {
+		t.Run(fmt.Sprint(workers), func(t *testing.T) {
+			cfg := testConfig()
+			cfg.Concurrency = workers
+			s := newTestService(t, cfg, newMemoryBackend(), nil)
+
+			// Each item waits until the pool is full, so the peak is exactly
+			// the configured limit unless more items than workers run at once.
+			var pool occupancy
+			full := make(chan struct{})
+			var once sync.Once
+			s.forEach(context.Background(), 3*workers, func(ctx context.Context, i int) {
+				cur := pool.enter()
+				defer pool.leave()
+				if cur == int32(workers) {
+					once.Do(func() { close(full) })
+				}
+				<-full
+			})
+			if p := pool.peak.Load(); p != int32(workers) {
+				t.Fatalf("peak concurrency = %d, want %d", p, workers)
+			}
+		})
+	}
+}
+
+func TestForEachEmpty(t *testing.T) {
+	s := newTestService(t, testConfig(), newMemoryBackend(), nil)
+	s.forEach(context.Background(), 0, func(context.Context, int) {
+		t.Fatal("fn called for an empty range")
+	})
+}
@@ -0,0 +1,58 @@
+package ddns
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"hetzner-ddns/internal/metrics"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+)
+
+// pruneStale removes values the updater added on earlier runs from a preserved
+// RRSet once ip is published. Values added by anyone else are never touched.
+// It returns the owned values still present in the RRSet.
+func (s *Service) pruneStale(ctx context.Context, zone *targetZone, rrset *hcloud.ZoneRRSet, ip string, owned []string) ([]string, error) {
+	var kept, target []string
+	var stale []hcloud.ZoneRRSetRecord
+	for _, value := range rrsetValues(rrset) {
+		isOwned := slices.Contains(owned, value)
+		if isOwned && value != ip && s.cfg.PruneStaleValues {
+			stale = append(stale, hcloud.ZoneRRSetRecord{Value: value})
+			continue
+		}
+		if isOwned {
+			kept = append(kept, value)
+		}
+		target = append(target, value)
+	}
+	if len(stale) == 0 {
+		return kept, nil
+	}
+	if !slices.Contains(target, ip) {
+		target = append(target, ip)
+	}
+
+	staleValues := make([]string, 0, len(stale))
+	for _, record := range stale {
+		staleValues = append(staleValues, record.Value)
+	}
+	s.log(ctx).Info("Stale values will be pruned", "zone", zone.key, "record", rrset.Name, "record_type", rrset.Type, "stale_values", staleValues, "ip", ip)
+	if s.plan != nil {
+		s.plan.add(PlanEntry{Zone: zone.key, Record: rrset.Name, RecordType: string(rrset.Type), Action: PlanPrune, CurrentValues: rrsetValues(rrset), TargetValues: target})
+		return kept, nil
+	}
+	err := s.retryOn(ctx, zone.breaker, "remove rrset records", func(opCtx context.Context) error {
+		s.log(ctx).Debug("API request: remove rrset records", "zone", zone.key, "record", rrset.Name, "record_type", rrset.Type)
+		return zone.backend.RemoveRecords(opCtx, rrset, hcloud.ZoneRRSetRemoveRecordsOpts{
+			Records: stale,
+		})
+	})
+	if err != nil {
+		return owned, withPhase(metrics.PhaseRRSetRemove, fmt.Errorf("remove rrset records %s/%s: %w", rrset.Name, rrset.Type, err))
+	}
+	s.log(ctx).Info("Stale values pruned", "zone", zone.key, "record", rrset.Name, "record_type", rrset.Type, "pruned", staleValues)
+	s.metrics.RecordChanged(zone.key, "pruned")
+	return kept, nil
+}
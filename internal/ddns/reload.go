@@ -0,0 +1,151 @@
+package ddns
+
+import (
+	"reflect"
+	"slices"
+	"strings"
+
+	"hetzner-ddns/internal/config"
+)
+
+func (s *Service) Reload(cfg config.Config) {
+	s.reloadMu.Lock()
+	s.pending = &cfg
+	s.reloadMu.Unlock()
+	select {
+	case s.reloadCh <- struct{}{}:
+	default:
+	}
+}
+
+func (s *Service) applyReload() bool {
+	s.reloadMu.Lock()
+	next := s.pending
+	s.pending = nil
+	s.reloadMu.Unlock()
+	if next == nil {
+		return false
+	}
+
+	cfg := *next
+	var restartRequired []string
+	if cfg.Token != s.cfg.Token {
+		restartRequired = append(restartRequired, "HETZNER_TOKEN")
+		cfg.Token = s.cfg.Token
+	}
+	if cfg.DNSConsoleToken != s.cfg.DNSConsoleToken || cfg.DNSConsoleURL != s.cfg.DNSConsoleURL {
+		restartRequired = append(restartRequired, "HETZNER_DNS_*")
+		cfg.DNSConsoleToken = s.cfg.DNSConsoleToken
+		cfg.DNSConsoleURL = s.cfg.DNSConsoleURL
+	}
+	if cfg.StateFile != s.cfg.StateFile {
+		restartRequired = append(restartRequired, "STATE_FILE")
+		cfg.StateFile = s.cfg.StateFile
+	}
+	if cfg.LogLevel != s.cfg.LogLevel {
+		restartRequired = append(restartRequired, "LOG_LEVEL")
+		cfg.LogLevel = s.cfg.LogLevel
+	}
+	if cfg.LogFormat != s.cfg.LogFormat {
+		restartRequired = append(restartRequired, "LOG_FORMAT")
+		cfg.LogFormat = s.cfg.LogFormat
+	}
+	if cfg.HTTPListenAddr != s.cfg.HTTPListenAddr {
+		restartRequired = append(restartRequired, "HTTP_LISTEN_ADDR")
+		cfg.HTTPListenAddr = s.cfg.HTTPListenAddr
+	}
+	if cfg.DynDNSListenAddr != s.cfg.DynDNSListenAddr {
+		restartRequired = append(restartRequired, "DYNDNS_LISTEN_ADDR")
+		cfg.DynDNSListenAddr = s.cfg.DynDNSListenAddr
+	}
+	if !reflect.DeepEqual(cfg.Webhooks, s.cfg.Webhooks) {
+		restartRequired = append(restartRequired, "WEBHOOK_*")
+		cfg.Webhooks = s.cfg.Webhooks
+	}
+	for _, service := range changedChats(s.cfg.Chats, cfg.Chats) {
+		restartRequired = append(restartRequired, strings.ToUpper(service)+"_*")
+	}
+	cfg.Chats = s.cfg.Chats
+	if cfg.NotifyAttempts != s.cfg.NotifyAttempts || cfg.NotifyTimeout != s.cfg.NotifyTimeout {
+		restartRequired = append(restartRequired, "NOTIFY_*")
+		cfg.NotifyAttempts = s.cfg.NotifyAttempts
+		cfg.NotifyTimeout = s.cfg.NotifyTimeout
+	}
+	if len(restartRequired) > 0 {
+		s.logger.Warn("Reloaded settings require a restart; keeping current values", "settings", restartRequired)
+	}
+
+	diff := diffConfig(s.cfg, cfg)
+	if cfg.HTTPTimeout != s.cfg.HTTPTimeout || cfg.UserAgent != s.cfg.UserAgent {
+		s.sources = s.newSources(cfg.HTTPTimeout, cfg.UserAgent)
+	}
+	s.cfg = cfg
+	s.health.configure(cfg)
+	s.logger.Info("Configuration reloaded",
+		"zones_added", diff.zonesAdded,
+		"zones_removed", diff.zonesRemoved,
+		"records_added", diff.recordsAdded,
+		"records_removed", diff.recordsRemoved,
+		"zone_count", len(cfg.Zones),
+		"firewall_count", len(cfg.Firewalls),
+		"interval", cfg.Interval.String(),
+	)
+	return true
+}
+
+// changedChats returns the chat services whose settings differ.
+func changedChats(old, next []config.ChatConfig) []string {
+	var changed []string
+	for _, chats := range [][2][]config.ChatConfig{{old, next}, {next, old}} {
+		for _, chat := range chats[0] {
+			same := slices.ContainsFunc(chats[1], func(other config.ChatConfig) bool { return reflect.DeepEqual(chat, other) })
+			if !same && !slices.Contains(changed, chat.Service) {
+				changed = append(changed, chat.Service)
+			}
+		}
+	}
+	return changed
+}
+
+type configDiff struct {
+	zonesAdded     []string
+	zonesRemoved   []string
+	recordsAdded   []string
+	recordsRemoved []string
+}
+
+func diffConfig(old, next config.Config) configDiff {
+	oldZones, oldRecords := configEntries(old)
+	nextZones, nextRecords := configEntries(next)
+	return configDiff{
+		zonesAdded:     missingFrom(nextZones, oldZones),
+		zonesRemoved:   missingFrom(oldZones, nextZones),
+		recordsAdded:   missingFrom(nextRecords, oldRecords),
+		recordsRemoved: missingFrom(oldRecords, nextRecords),
+	}
+}
+
+func configEntries(cfg config.Config) ([]string, []string) {
+	var zones, records []string
+	for _, zone := range cfg.Zones {
+		if !slices.Contains(zones, zone.Name) {
+			zones = append(zones, zone.Name)
+		}
+		for _, record := range zone.Records {
+			for _, recordType := range record.Types {
+				records = append(records, zone.Name+"/"+record.Name+"/"+recordType)
+			}
+		}
+	}
+	return zones, records
+}
+
+func missingFrom(items, other []string) []string {
+	out := []string{}
+	for _, item := range items {
+		if !slices.Contains(other, item) {
+			out = append(out, item)
+		}
+	}
+	return out
+}
@@ -2,28 +2,84 @@ package ddns
 
 import (
 	"context"
+	"errors"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
 	"time"
+
+	"hetzner-ddns/internal/dnsconsole"
+	"hetzner-ddns/internal/rfc2136"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+)
+
+// Rate-limit waits longer than this are not sat out; the operation fails and
+// is retried on the next run instead.
+const maxRateLimitWait = time.Minute
+
+const (
+	classRateLimited = "rate_limited"
+	classTransient   = "transient"
+	classPermanent   = "permanent"
 )
 
-func retry(ctx context.Context, attempts int, baseDelay, maxDelay time.Duration, fn func(context.Context, int) error) error {
+type retryDecision struct {
+	class string
+	code  string
+	retry bool
+	wait  time.Duration
+}
+
+// permanentError marks an error produced by the updater itself that retrying
+// cannot fix.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+func permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+func retry(ctx context.Context, attempts int, baseDelay, maxDelay time.Duration, fn func(context.Context, int) error, observe func(attempt int, err error, decision retryDecision)) error {
 	if attempts <= 0 {
 		attempts = 1
 	}
 
-	var lastErr error
 	delay := baseDelay
-	for attempt := 1; attempt <= attempts; attempt++ {
+	for attempt := 1; ; attempt++ {
 		err := fn(ctx, attempt)
 		if err == nil {
 			return nil
 		}
-		lastErr = err
 
-		if attempt == attempts {
-			break
+		decision := classifyError(err, time.Now())
+		if attempt == attempts || ctx.Err() != nil {
+			decision.retry = false
+		}
+		if decision.retry {
+			backoff := jitter(delay)
+			if decision.wait > maxRateLimitWait {
+				decision.retry = false
+			} else {
+				decision.wait = max(decision.wait, backoff)
+			}
+		}
+		observe(attempt, err, decision)
+		if !decision.retry {
+			return err
 		}
 
-		timer := time.NewTimer(delay)
+		timer := time.NewTimer(decision.wait)
 		select {
 		case <-ctx.Done():
 			timer.Stop()
@@ -35,5 +91,114 @@ func retry(ctx context.Context, attempts int, baseDelay, maxDelay time.Duration,
 			delay = maxDelay
 		}
 	}
-	return lastErr
+}
+
+// classifyError decides whether an API error is worth retrying. Hetzner error
+// codes are authoritative; anything else is assumed to be a network problem.
+func classifyError(err error, now time.Time) retryDecision {
+	var permErr *permanentError
+	if errors.As(err, &permErr) || errors.Is(err, context.Canceled) {
+		return retryDecision{class: classPermanent}
+	}
+
+	var consoleErr *dnsconsole.Error
+	if errors.As(err, &consoleErr) {
+		return classifyStatus(consoleErr.StatusCode, consoleErr.Header, now)
+	}
+
+	var updateErr *rfc2136.Error
+	if errors.As(err, &updateErr) {
+		if updateErr.Rcode == rfc2136.RcodeServFail {
+			return retryDecision{class: classTransient, code: updateErr.Code(), retry: true}
+		}
+		return retryDecision{class: classPermanent, code: updateErr.Code()}
+	}
+
+	var apiErr hcloud.Error
+	if !errors.As(err, &apiErr) {
+		var netErr net.Error
+		if errors.As(err, &netErr) || errors.Is(err, context.DeadlineExceeded) {
+			return retryDecision{class: classTransient, code: "timeout", retry: true}
+		}
+		return retryDecision{class: classTransient, retry: true}
+	}
+
+	decision := retryDecision{code: string(apiErr.Code)}
+	switch apiErr.Code {
+	case hcloud.ErrorCodeRateLimitExceeded:
+		decision.class = classRateLimited
+		decision.retry = true
+		if resp := apiErr.Response(); resp != nil && resp.Response != nil {
+			decision.wait, _ = rateLimitWait(resp.Header, now)
+		}
+	case hcloud.ErrorCodeConflict, hcloud.ErrorCodeLocked, hcloud.ErrorCodeTimeout,
+		hcloud.ErrorCodeServiceError, hcloud.ErrorCodeMaintenance, hcloud.ErrorCodeResourceUnavailable:
+		decision.class = classTransient
+		decision.retry = true
+	case hcloud.ErrorCodeUnauthorized, hcloud.ErrorCodeForbidden, hcloud.ErrorCodeNotFound,
+		hcloud.ErrorCodeInvalidInput, hcloud.ErrorCodeUniquenessError, hcloud.ErrorCodeProtected,
+		hcloud.ErrorCodeJSONError:
+		decision.class = classPermanent
+	default:
+		decision.class = classPermanent
+		if resp := apiErr.Response(); resp != nil && resp.Response != nil && resp.StatusCode >= http.StatusInternalServerError {
+			decision.class = classTransient
+			decision.retry = true
+		}
+	}
+	return decision
+}
+
+// classifyStatus decides on APIs without error codes, such as the DNS Console,
+// by the HTTP status alone.
+func classifyStatus(status int, header http.Header, now time.Time) retryDecision {
+	decision := retryDecision{code: strconv.Itoa(status)}
+	switch {
+	case status == http.StatusTooManyRequests:
+		decision.class = classRateLimited
+		decision.retry = true
+		decision.wait, _ = rateLimitWait(header, now)
+	case status == http.StatusRequestTimeout, status == http.StatusConflict, status >= http.StatusInternalServerError:
+		decision.class = classTransient
+		decision.retry = true
+	default:
+		decision.class = classPermanent
+	}
+	return decision
+}
+
+// rateLimitWait reads how long to wait from Retry-After or, failing that, from
+// the RateLimit-* headers. Hetzner refills the bucket one request at a time and
+// RateLimit-Reset is when it is full again, so only the share of one request is
+// waited for.
+func rateLimitWait(header http.Header, now time.Time) (time.Duration, bool) {
+	if value := header.Get("Retry-After"); value != "" {
+		if seconds, err := strconv.Atoi(value); err == nil {
+			return time.Duration(seconds) * time.Second, true
+		}
+		if at, err := http.ParseTime(value); err == nil {
+			return max(at.Sub(now), 0), true
+		}
+	}
+	reset, err := strconv.ParseInt(header.Get("RateLimit-Reset"), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	wait := time.Unix(reset, 0).Sub(now)
+	limit, limitErr := strconv.Atoi(header.Get("RateLimit-Limit"))
+	remaining, remainingErr := strconv.Atoi(header.Get("RateLimit-Remaining"))
+	if limitErr == nil && remainingErr == nil && limit > remaining {
+		wait /= time.Duration(limit - remaining)
+	}
+	return max(wait, 0), true
+}
+
+// jitter returns a random delay between d/2 and d so that retries of parallel
+// operations do not hit the API in lockstep.
+func jitter(d time.Duration) time.Duration {
+	if d <= 1 {
+		return d
+	}
+	half := d / 2
+	return half + rand.N(d-half)
 }
@@ -0,0 +1,170 @@
+package ddns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"hetzner-ddns/internal/dnsconsole"
+	"hetzner-ddns/internal/rfc2136"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+)
+
+func TestClassifyError(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	consoleErr := func(status int, header http.Header) error {
+		return fmt.Errorf("get zone: %w", &dnsconsole.Error{StatusCode: status, Header: header})
+	}
+	tests := []struct {
+		name  string
+		err   error
+		class string
+		code  string
+		retry bool
+		wait  time.Duration
+	}{
+		{"updater error", permanent(errors.New("zone not found: example.com")), classPermanent, "", false, 0},
+		{"canceled", fmt.Errorf("get rrset: %w", context.Canceled), classPermanent, "", false, 0},
+		{"request timeout", fmt.Errorf("get rrset: %w", context.DeadlineExceeded), classTransient, "timeout", true, 0},
+		{"network error", &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", errors.New("connection refused"))}, classTransient, "timeout", true, 0},
+		{"unknown error", errors.New("unexpected EOF"), classTransient, "", true, 0},
+		{"hcloud rate limit", hcloud.Error{Code: hcloud.ErrorCodeRateLimitExceeded}, classRateLimited, "rate_limit_exceeded", true, 0},
+		{"hcloud conflict", hcloud.Error{Code: hcloud.ErrorCodeConflict}, classTransient, "conflict", true, 0},
+		{"hcloud locked", hcloud.Error{Code: hcloud.ErrorCodeLocked}, classTransient, "locked", true, 0},
+		{"hcloud maintenance", hcloud.Error{Code: hcloud.ErrorCodeMaintenance}, classTransient, "maintenance", true, 0},
+		{"hcloud not found", fmt.Errorf("set rrset: %w", hcloud.Error{Code: hcloud.ErrorCodeNotFound}), classPermanent, "not_found", false, 0},
+		{"hcloud unauthorized", hcloud.Error{Code: hcloud.ErrorCodeUnauthorized}, classPermanent, "unauthorized", false, 0},
+		{"hcloud invalid input", hcloud.Error{Code: hcloud.ErrorCodeInvalidInput}, classPermanent, "invalid_input", false, 0},
+		{"hcloud unknown code", hcloud.Error{Code: "something_new"}, classPermanent, "something_new", false, 0},
+		{"console 429", consoleErr(http.StatusTooManyRequests, http.Header{"Retry-After": {"7"}}), classRateLimited, "429", true, 7 * time.Second},
+		{"console 408", consoleErr(http.StatusRequestTimeout, nil), classTransient, "408", true, 0},
+		{"console 409", consoleErr(http.StatusConflict, nil), classTransient, "409", true, 0},
+		{"console 502", consoleErr(http.StatusBadGateway, nil), classTransient, "502", true, 0},
+		{"console 401", consoleErr(http.StatusUnauthorized, nil), classPermanent, "401", false, 0},
+		{"console 422", consoleErr(http.StatusUnprocessableEntity, nil), classPermanent, "422", false, 0},
+		{"rfc2136 servfail", &rfc2136.Error{Rcode: rfc2136.RcodeServFail}, classTransient, "SERVFAIL", true, 0},
+		{"rfc2136 refused", &rfc2136.Error{Rcode: 5}, classPermanent, "REFUSED", false, 0},
+		{"rfc2136 badsig", &rfc2136.Error{Rcode: 9, TSIGError: 16}, classPermanent, "BADSIG", false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := classifyError(tt.err, now)
+			want := retryDecision{class: tt.class, code: tt.code, retry: tt.retry, wait: tt.wait}
+			if got != want {
+				t.Fatalf("got %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestRateLimitWait(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	reset := func(after time.Duration) string {
+		return strconv.FormatInt(now.Add(after).Unix(), 10)
+	}
+	tests := []struct {
+		name   string
+		header http.Header
+		wait   time.Duration
+		ok     bool
+	}{
+		{"no headers", http.Header{}, 0, false},
+		{"retry-after seconds", http.Header{"Retry-After": {"30"}}, 30 * time.Second, true},
+		{"retry-after date", http.Header{"Retry-After": {now.Add(90 * time.Second).UTC().Format(http.TimeFormat)}}, 90 * time.Second, true},
+		{"retry-after in the past", http.Header{"Retry-After": {now.Add(-time.Minute).UTC().Format(http.TimeFormat)}}, 0, true},
+		{"retry-after wins", http.Header{"Retry-After": {"2"}, "Ratelimit-Reset": {reset(time.Hour)}}, 2 * time.Second, true},
+		// 3600 requests refill over an hour: with all used, one is back in a second.
+		{"reset over the used budget", http.Header{"Ratelimit-Reset": {reset(time.Hour)}, "Ratelimit-Limit": {"3600"}, "Ratelimit-Remaining": {"0"}}, time.Second, true},
+		{"reset over part of the budget", http.Header{"Ratelimit-Reset": {reset(time.Minute)}, "Ratelimit-Limit": {"100"}, "Ratelimit-Remaining": {"40"}}, time.Second, true},
+		{"reset without limit", http.Header{"Ratelimit-Reset": {reset(time.Minute)}}, time.Minute, true},
+		{"reset with full budget", http.Header{"Ratelimit-Reset": {reset(time.Minute)}, "Ratelimit-Limit": {"100"}, "Ratelimit-Remaining": {"100"}}, time.Minute, true},
+		{"reset in the past", http.Header{"Ratelimit-Reset": {reset(-time.Minute)}}, 0, true},
+		{"invalid reset", http.Header{"Ratelimit-Reset": {"soon"}}, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wait, ok := rateLimitWait(tt.header, now)
+			if wait != tt.wait || ok != tt.ok {
+				t.Fatalf("got %v, %v; want %v, %v", wait, ok, tt.wait, tt.ok)
+			}
+		})
+	}
+}
+
+func TestRetry(t *testing.T) {
+	rateLimited := func(retryAfter string) error {
+		return &dnsconsole.Error{StatusCode: http.StatusTooManyRequests, Header: http.Header{"Retry-After": {retryAfter}}}
+	}
+	tests := []struct {
+		name     string
+		errs     []error
+		attempts int
+		calls    int
+		retried  []bool
+	}{
+		{"success", []error{nil}, 3, 1, nil},
+		{"transient then success", []error{errors.New("EOF"), nil}, 3, 2, []bool{true}},
+		{"transient until attempts run out", []error{errors.New("EOF"), errors.New("EOF"), errors.New("EOF")}, 3, 3, []bool{true, true, false}},
+		{"permanent", []error{permanent(errors.New("bad")), nil}, 3, 1, []bool{false}},
+		{"short rate limit", []error{rateLimited("0"), nil}, 3, 2, []bool{true}},
+		{"rate limit beyond the cap", []error{rateLimited(strconv.Itoa(int(maxRateLimitWait/time.Second) + 1)), nil}, 3, 1, []bool{false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int
+			var retried []bool
+			err := retry(context.Background(), tt.attempts, time.Millisecond, 2*time.Millisecond, func(ctx context.Context, attempt int) error {
+				calls++
+				return tt.errs[attempt-1]
+			}, func(attempt int, err error, decision retryDecision) {
+				retried = append(retried, decision.retry)
+				if decision.retry && decision.wait < time.Millisecond/2 {
+					t.Errorf("attempt %d waits %v, less than the jittered backoff", attempt, decision.wait)
+				}
+			})
+			if calls != tt.calls || fmt.Sprint(retried) != fmt.Sprint(tt.retried) {
+				t.Fatalf("calls = %d, retried = %v; want %d, %v", calls, retried, tt.calls, tt.retried)
+			}
+			if (err == nil) != (tt.errs[calls-1] == nil) {
+				t.Fatalf("err = %v", err)
+			}
+		})
+	}
+}
+
+func TestRetryStopsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var calls int
+	err := retry(ctx, 5, time.Hour, time.Hour, func(ctx context.Context, attempt int) error {
+		calls++
+		cancel()
+		return errors.New("EOF")
+	}, func(int, error, retryDecision) {})
+	if calls != 1 || err == nil {
+		t.Fatalf("calls = %d, err = %v; want one failed call", calls, err)
+	}
+}
+
+func TestJitter(t *testing.T) {
+	for _, d := range []time.Duration{0, 1, 2, time.Millisecond, time.Second, 30 * time.Second} {
+		for range 1000 {
+			got := jitter(d)
+			if d <= 1 {
+				if got != d {
+					t.Fatalf("jitter(%v) = %v, want %v", d, got, d)
+				}
+				continue
+			}
+			if got < d/2 || got >= d {
+				t.Fatalf("jitter(%v) = %v, want within [%v, %v)", d, got, d/2, d)
+			}
+		}
+	}
+}
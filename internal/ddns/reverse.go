@@ -0,0 +1,235 @@
+package ddns
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	"hetzner-ddns/internal/config"
+	"hetzner-ddns/internal/metrics"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+)
+
+// reverseTarget is a Primary IP or Floating IP of the project. Reverse DNS is
+// set on those; the public addresses of servers are Primary IPs as well.
+type reverseTarget struct {
+	primary  *hcloud.PrimaryIP
+	floating *hcloud.FloatingIP
+}
+
+func (t reverseTarget) String() string {
+	if t.primary != nil {
+		return "primary IP " + t.primary.Name
+	}
+	return "floating IP " + t.floating.Name
+}
+
+// contains reports whether addr is the target's IPv4 address or lies in its
+// IPv6 network.
+func (t reverseTarget) contains(addr net.IP) bool {
+	ip, network := t.address()
+	if network != nil {
+		return network.Contains(addr)
+	}
+	return ip.Equal(addr)
+}
+
+func (t reverseTarget) address() (net.IP, *net.IPNet) {
+	if t.primary != nil {
+		return t.primary.IP, t.primary.Network
+	}
+	return t.floating.IP, t.floating.Network
+}
+
+// ptr returns the reverse DNS name set for addr, or "".
+func (t reverseTarget) ptr(addr net.IP) string {
+	var ptrs map[string]string
+	if t.primary != nil {
+		ptrs = t.primary.DNSPtr
+	} else {
+		ptrs = t.floating.DNSPtr
+	}
+	for ip, name := range ptrs {
+		if net.ParseIP(ip).Equal(addr) {
+			return name
+		}
+	}
+	return ""
+}
+
+// reverseBackend is the part of the Cloud API that reverse DNS uses.
+type reverseBackend interface {
+	PrimaryIPs(ctx context.Context) ([]*hcloud.PrimaryIP, error)
+	FloatingIPs(ctx context.Context) ([]*hcloud.FloatingIP, error)
+	// ChangePtr sets the reverse DNS name of ip and waits until the change
+	// is applied.
+	ChangePtr(ctx context.Context, t reverseTarget, ip, ptr string) error
+	// Reload returns the target as the API reports it now, and false when it
+	// no longer exists.
+	Reload(ctx context.Context, t reverseTarget) (reverseTarget, bool, error)
+}
+
+// cloudReverse sets reverse DNS through the Cloud API.
+type cloudReverse struct {
+	client *hcloud.Client
+}
+
+func (b *cloudReverse) PrimaryIPs(ctx context.Context) ([]*hcloud.PrimaryIP, error) {
+	return b.client.PrimaryIP.All(ctx)
+}
+
+func (b *cloudReverse) FloatingIPs(ctx context.Context) ([]*hcloud.FloatingIP, error) {
+	return b.client.FloatingIP.All(ctx)
+}
+
+func (b *cloudReverse) ChangePtr(ctx context.Context, t reverseTarget, ip, ptr string) error {
+	var action *hcloud.Action
+	var err error
+	if t.primary != nil {
+		action, _, err = b.client.PrimaryIP.ChangeDNSPtr(ctx, hcloud.PrimaryIPChangeDNSPtrOpts{ID: t.primary.ID, IP: ip, DNSPtr: ptr})
+	} else {
+		action, _, err = b.client.FloatingIP.ChangeDNSPtr(ctx, t.floating, ip, &ptr)
+	}
+	if err != nil || action == nil {
+		return err
+	}
+	return b.client.Action.WaitFor(ctx, action)
+}
+
+func (b *cloudReverse) Reload(ctx context.Context, t reverseTarget) (reverseTarget, bool, error) {
+	if t.primary != nil {
+		primary, _, err := b.client.PrimaryIP.GetByID(ctx, t.primary.ID)
+		return reverseTarget{primary: primary}, primary != nil, err
+	}
+	floating, _, err := b.client.FloatingIP.GetByID(ctx, t.floating.ID)
+	return reverseTarget{floating: floating}, floating != nil, err
+}
+
+// reverseTargets lists the project's Primary and Floating IPs once per run.
+func (s *Service) reverseTargets(ctx context.Context, run *syncRun) ([]reverseTarget, error) {
+	run.reverseOnce.Do(func() {
+		var primaries []*hcloud.PrimaryIP
+		run.reverseErr = s.withRetry(ctx, "list primary ips", func(opCtx context.Context) error {
+			s.log(ctx).Debug("API request: list primary ips")
+			var err error
+			primaries, err = s.reverse.PrimaryIPs(opCtx)
+			return err
+		})
+		if run.reverseErr != nil {
+			return
+		}
+		var floatings []*hcloud.FloatingIP
+		run.reverseErr = s.withRetry(ctx, "list floating ips", func(opCtx context.Context) error {
+			s.log(ctx).Debug("API request: list floating ips")
+			var err error
+			floatings, err = s.reverse.FloatingIPs(opCtx)
+			return err
+		})
+		if run.reverseErr != nil {
+			return
+		}
+		for _, primary := range primaries {
+			run.reverseTargets = append(run.reverseTargets, reverseTarget{primary: primary})
+		}
+		for _, floating := range floatings {
+			run.reverseTargets = append(run.reverseTargets, reverseTarget{floating: floating})
+		}
+	})
+	return run.reverseTargets, run.reverseErr
+}
+
+// syncReverse keeps the PTR of a published address pointing at the record's
+// name when the address belongs to the project. It returns false when the
+// reverse entry could not be checked or set, so the record is retried.
+func (s *Service) syncReverse(ctx context.Context, run *syncRun, zoneName string, rec desiredRecord) bool {
+	fqdn := recordFQDN(zoneName, rec.name)
+	addr := net.ParseIP(rec.value)
+	targets, err := s.reverseTargets(ctx, run)
+	if err != nil {
+		s.log(ctx).Error("Reverse DNS lookup failed", "zone", zoneName, "record", rec.name, "record_type", rec.recordType, "error", err)
+		s.fail(run, zoneName, rec.name, rec.recordType, metrics.PhasePTRLookup, fmt.Errorf("zone %s record %s/%s reverse dns: %w", zoneName, rec.name, rec.recordType, err))
+		return false
+	}
+	var target *reverseTarget
+	for i := range targets {
+		if targets[i].contains(addr) {
+			target = &targets[i]
+			break
+		}
+	}
+	if target == nil {
+		s.log(ctx).Info("Address is not a Primary or Floating IP of the project; skipping reverse DNS", "zone", zoneName, "record", rec.name, "ip", rec.value)
+		return true
+	}
+
+	current := target.ptr(addr)
+	if ptrEqual(current, fqdn) {
+		s.log(ctx).Debug("Reverse DNS already up to date", "zone", zoneName, "record", rec.name, "ip", rec.value, "ptr", current, "target", target.String())
+		s.metrics.ReverseMismatch(zoneName, rec.name, rec.recordType, false)
+		return true
+	}
+	if s.cfg.ReverseMode == config.ReverseVerify {
+		s.log(ctx).Warn("Reverse DNS mismatch", "zone", zoneName, "record", rec.name, "record_type", rec.recordType, "ip", rec.value, "ptr", current, "expected", fqdn, "target", target.String())
+		s.metrics.ReverseMismatch(zoneName, rec.name, rec.recordType, true)
+		return true
+	}
+
+	s.log(ctx).Info("Reverse DNS will change", "zone", zoneName, "record", rec.name, "ip", rec.value, "current_ptr", current, "ptr", fqdn, "target", target.String())
+	if s.plan != nil {
+		var currentValues []string
+		if current != "" {
+			currentValues = []string{current}
+		}
+		s.plan.add(PlanEntry{Zone: zoneName, Record: rec.name, RecordType: rec.recordType, Action: PlanPTR, CurrentValues: currentValues, TargetValues: []string{fqdn}})
+		return true
+	}
+	err = s.withRetry(ctx, "change dns ptr", func(opCtx context.Context) error {
+		s.log(ctx).Debug("API request: change dns ptr", "zone", zoneName, "record", rec.name, "ip", rec.value, "target", target.String())
+		return s.reverse.ChangePtr(opCtx, *target, rec.value, fqdn)
+	})
+	if err != nil {
+		s.log(ctx).Error("Reverse DNS update failed", "zone", zoneName, "record", rec.name, "ip", rec.value, "error", err)
+		s.fail(run, zoneName, rec.name, rec.recordType, metrics.PhasePTRSet, fmt.Errorf("zone %s record %s/%s reverse dns: %w", zoneName, rec.name, rec.recordType, err))
+		s.metrics.ReverseMismatch(zoneName, rec.name, rec.recordType, true)
+		return false
+	}
+
+	// Read the entry back; the action finishing does not guarantee the new
+	// name is what the API now reports.
+	var reloaded reverseTarget
+	err = s.withRetry(ctx, "get dns ptr", func(opCtx context.Context) error {
+		var found bool
+		var err error
+		reloaded, found, err = s.reverse.Reload(opCtx, *target)
+		if err == nil && !found {
+			err = permanent(fmt.Errorf("%s no longer exists", target))
+		}
+		return err
+	})
+	if err == nil && !ptrEqual(reloaded.ptr(addr), fqdn) {
+		err = fmt.Errorf("%s reports %q after the change", target, reloaded.ptr(addr))
+	}
+	if err != nil {
+		s.log(ctx).Error("Reverse DNS verification failed", "zone", zoneName, "record", rec.name, "ip", rec.value, "error", err)
+		s.fail(run, zoneName, rec.name, rec.recordType, metrics.PhasePTRVerify, fmt.Errorf("zone %s record %s/%s reverse dns verify: %w", zoneName, rec.name, rec.recordType, err))
+		s.metrics.ReverseMismatch(zoneName, rec.name, rec.recordType, true)
+		return false
+	}
+	s.log(ctx).Info("Reverse DNS updated", "zone", zoneName, "record", rec.name, "ip", rec.value, "ptr", fqdn, "target", target.String())
+	s.metrics.RecordChanged(zoneName, "ptr_changed")
+	s.metrics.ReverseMismatch(zoneName, rec.name, rec.recordType, false)
+	return true
+}
+
+func recordFQDN(zoneName, name string) string {
+	if name == "@" {
+		return zoneName
+	}
+	return name + "." + zoneName
+}
+
+func ptrEqual(ptr, fqdn string) bool {
+	return strings.EqualFold(strings.TrimSuffix(ptr, "."), fqdn)
+}
@@ -0,0 +1,150 @@
+package ddns
+
+import (
+	"context"
+	"errors"
+	"net"
+	"slices"
+	"sync"
+	"testing"
+
+	"hetzner-ddns/internal/config"
+	"hetzner-ddns/internal/metrics"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+)
+
+// memoryReverse is a reverseBackend holding one project's Primary and Floating
+// IPs. changes lists every PTR it set as "ip=ptr".
+type memoryReverse struct {
+	mu        sync.Mutex
+	primaries []*hcloud.PrimaryIP
+	floatings []*hcloud.FloatingIP
+	listErr   error
+	// ignore makes changes succeed without taking effect.
+	ignore  bool
+	changes []string
+}
+
+func (b *memoryReverse) PrimaryIPs(ctx context.Context) ([]*hcloud.PrimaryIP, error) {
+	return b.primaries, b.listErr
+}
+
+func (b *memoryReverse) FloatingIPs(ctx context.Context) ([]*hcloud.FloatingIP, error) {
+	return b.floatings, b.listErr
+}
+
+func (b *memoryReverse) ChangePtr(ctx context.Context, t reverseTarget, ip, ptr string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.changes = append(b.changes, ip+"="+ptr)
+	if b.ignore {
+		return nil
+	}
+	var ptrs *map[string]string
+	if t.primary != nil {
+		ptrs = &t.primary.DNSPtr
+	} else {
+		ptrs = &t.floating.DNSPtr
+	}
+	if *ptrs == nil {
+		*ptrs = make(map[string]string)
+	}
+	(*ptrs)[ip] = ptr
+	return nil
+}
+
+func (b *memoryReverse) Reload(ctx context.Context, t reverseTarget) (reverseTarget, bool, error) {
+	return t, true, nil
+}
+
+func newReverseService(t *testing.T, mode string) (*Service, *memoryReverse) {
+	t.Helper()
+	_, v6, _ := net.ParseCIDR("2001:db8:1::/64")
+	backend := &memoryReverse{
+		primaries: []*hcloud.PrimaryIP{
+			{ID: 1, Name: "mail-v4", IP: net.ParseIP("203.0.113.7")},
+			{ID: 2, Name: "web-v4", IP: net.ParseIP("203.0.113.8"), DNSPtr: map[string]string{"203.0.113.8": "www.example.com."}},
+		},
+		floatings: []*hcloud.FloatingIP{
+			{ID: 3, Name: "mail-v6", IP: v6.IP, Network: v6},
+		},
+	}
+	cfg := testConfig()
+	cfg.ReverseMode = mode
+	s := newTestService(t, cfg, newMemoryBackend(), nil)
+	s.reverse = backend
+	return s, backend
+}
+
+func TestSyncReverse(t *testing.T) {
+	tests := []struct {
+		name    string
+		mode    string
+		rec     desiredRecord
+		changes []string
+	}{
+		{"primary ip", config.ReverseUpdate, desiredRecord{name: "mail", recordType: "A", value: "203.0.113.7"}, []string{"203.0.113.7=mail.example.com"}},
+		{"inside a floating ipv6 network", config.ReverseUpdate, desiredRecord{name: "mail", recordType: "AAAA", value: "2001:db8:1::25"}, []string{"2001:db8:1::25=mail.example.com"}},
+		{"already pointing back", config.ReverseUpdate, desiredRecord{name: "www", recordType: "A", value: "203.0.113.8"}, nil},
+		{"apex", config.ReverseUpdate, desiredRecord{name: "@", recordType: "A", value: "203.0.113.7"}, []string{"203.0.113.7=example.com"}},
+		{"not a project address", config.ReverseUpdate, desiredRecord{name: "home", recordType: "A", value: "198.51.100.9"}, nil},
+		{"outside the ipv6 network", config.ReverseUpdate, desiredRecord{name: "home", recordType: "AAAA", value: "2001:db8:2::1"}, nil},
+		{"verify only", config.ReverseVerify, desiredRecord{name: "mail", recordType: "A", value: "203.0.113.7"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, backend := newReverseService(t, tt.mode)
+			run := &syncRun{}
+			if !s.syncReverse(context.Background(), run, "example.com", tt.rec) || len(run.failures) > 0 {
+				t.Fatalf("syncReverse failed: %+v", run.failures)
+			}
+			if !slices.Equal(backend.changes, tt.changes) {
+				t.Fatalf("changes = %v, want %v", backend.changes, tt.changes)
+			}
+		})
+	}
+}
+
+func TestSyncReverseFailures(t *testing.T) {
+	rec := desiredRecord{name: "mail", recordType: "A", value: "203.0.113.7"}
+	tests := []struct {
+		name  string
+		setup func(*memoryReverse)
+		phase string
+	}{
+		{"listing fails", func(b *memoryReverse) { b.listErr = permanent(errors.New("forbidden")) }, metrics.PhasePTRLookup},
+		{"change does not stick", func(b *memoryReverse) { b.ignore = true }, metrics.PhasePTRVerify},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, backend := newReverseService(t, config.ReverseUpdate)
+			tt.setup(backend)
+			run := &syncRun{}
+			if s.syncReverse(context.Background(), run, "example.com", rec) {
+				t.Fatal("syncReverse reported success")
+			}
+			if len(run.failures) != 1 || run.failures[0].Phase != tt.phase {
+				t.Fatalf("failures = %+v, want phase %s", run.failures, tt.phase)
+			}
+		})
+	}
+}
+
+func TestSyncReverseDryRun(t *testing.T) {
+	s, backend := newReverseService(t, config.ReverseUpdate)
+	s.plan = &Plan{}
+	if !s.syncReverse(context.Background(), &syncRun{}, "example.com", desiredRecord{name: "mail", recordType: "A", value: "203.0.113.8"}) {
+		t.Fatal("syncReverse failed")
+	}
+	if len(backend.changes) > 0 {
+		t.Fatalf("dry run changed PTRs: %v", backend.changes)
+	}
+	if len(s.plan.Changes) != 1 {
+		t.Fatalf("plan = %+v, want one entry", s.plan.Changes)
+	}
+	got := s.plan.Changes[0]
+	if got.Action != PlanPTR || got.Record != "mail" || !slices.Equal(got.CurrentValues, []string{"www.example.com."}) || !slices.Equal(got.TargetValues, []string{"mail.example.com"}) {
+		t.Fatalf("plan entry = %+v", got)
+	}
+}
@@ -2,34 +2,151 @@ package ddns
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net"
+	"slices"
 	"strings"
+	"sync"
 	"time"
 
 	"hetzner-ddns/internal/config"
+	"hetzner-ddns/internal/dnsconsole"
 	"hetzner-ddns/internal/ip"
+	"hetzner-ddns/internal/metrics"
+	"hetzner-ddns/internal/notify"
+	"hetzner-ddns/internal/state"
 
 	"github.com/hetznercloud/hcloud-go/v2/hcloud"
 )
 
 type Service struct {
-	client    *hcloud.Client
-	ipFetcher *ip.Fetcher
-	logger    *slog.Logger
-	cfg       config.Config
+	client     *hcloud.Client
+	newSources SourceFactory
+	sources    ip.Factory
+	state      *state.Store
+	metrics    *metrics.Metrics
+	notifier   *notify.Notifier
+	health     *health
+	logger     *slog.Logger
+	cfg        config.Config
+	plan       *Plan
+	breaker    *breaker
+	cloud      dnsBackend
+	console    dnsBackend
+	reverse    reverseBackend
+
+	lastReconcile time.Time
+	lastObserved  map[string]string
+	missingSince  map[string]time.Time
+	failingSince  time.Time
+	firewallIPs   map[string]string
+	pushedIPs     map[string]string
+
+	syncMu     sync.Mutex
+	hookMu     sync.Mutex
+	firewallMu sync.Mutex
+	pushMu     sync.Mutex
+	reloadMu   sync.Mutex
+	pending    *config.Config
+	reloadCh   chan struct{}
+	pushCh     chan pushRequest
+}
+
+type syncRun struct {
+	mu       sync.Mutex
+	failures []Failure
+
+	reverseOnce    sync.Once
+	reverseTargets []reverseTarget
+	reverseErr     error
+}
+
+type desiredRecord struct {
+	name       string
+	recordType string
+	value      string
+	ttl        *int
+	adopt      bool
+	reverse    bool
+}
+
+// zoneWork is a zone target that needs API calls this run. Its records are
+// grouped by name so the A and AAAA of one name, which share an owner marker,
+// are handled by the same worker.
+type zoneWork struct {
+	name   string
+	target zoneTarget
+	addrs  map[string]net.IP
+	zone   *targetZone
+	groups []*recordGroup
+
+	mu          sync.Mutex
+	failedTypes map[string]bool
+}
+
+type recordGroup struct {
+	zone        *zoneWork
+	updates     []desiredRecord
+	withdrawals []desiredRecord
+}
+
+func newZoneWork(name string, target zoneTarget, addrs map[string]net.IP, pending, withdrawals []desiredRecord) *zoneWork {
+	zw := &zoneWork{name: name, target: target, addrs: addrs, failedTypes: make(map[string]bool)}
+	byName := make(map[string]*recordGroup)
+	group := func(name string) *recordGroup {
+		if g, ok := byName[name]; ok {
+			return g
+		}
+		g := &recordGroup{zone: zw}
+		byName[name] = g
+		zw.groups = append(zw.groups, g)
+		return g
+	}
+	for _, rec := range pending {
+		g := group(rec.name)
+		g.updates = append(g.updates, rec)
+	}
+	for _, rec := range withdrawals {
+		g := group(rec.name)
+		g.withdrawals = append(g.withdrawals, rec)
+	}
+	return zw
 }
 
-func NewService(client *hcloud.Client, ipFetcher *ip.Fetcher, logger *slog.Logger, cfg config.Config) *Service {
+func (zw *zoneWork) markFailed(recordType string) {
+	zw.mu.Lock()
+	defer zw.mu.Unlock()
+	zw.failedTypes[recordType] = true
+}
+
+func NewService(client *hcloud.Client, newSources SourceFactory, store *state.Store, m *metrics.Metrics, notifier *notify.Notifier, logger *slog.Logger, cfg config.Config) *Service {
 	return &Service{
-		client:    client,
-		ipFetcher: ipFetcher,
-		logger:    logger,
-		cfg:       cfg,
+		client:       client,
+		newSources:   newSources,
+		sources:      newSources(cfg.HTTPTimeout, cfg.UserAgent),
+		state:        store,
+		metrics:      m,
+		notifier:     notifier,
+		health:       newHealth(cfg),
+		breaker:      newBreaker(),
+		cloud:        &cloudBackend{client: client},
+		console:      newConsoleBackend(dnsconsole.New(cfg.DNSConsoleURL, cfg.DNSConsoleToken, cfg.UserAgent)),
+		reverse:      &cloudReverse{client: client},
+		logger:       logger,
+		cfg:          cfg,
+		lastObserved: make(map[string]string),
+		missingSince: make(map[string]time.Time),
+		firewallIPs:  make(map[string]string),
+		pushedIPs:    make(map[string]string),
+		reloadCh:     make(chan struct{}, 1),
+		pushCh:       make(chan pushRequest),
 	}
 }
 
+var ErrSyncInProgress = errors.New("sync already in progress")
+
 func (s *Service) Run(ctx context.Context) error {
 	if err := s.syncOnce(ctx); err != nil {
 		s.logger.Warn("Initial sync failed", "error", err)
@@ -42,126 +159,357 @@ func (s *Service) Run(ctx context.Context) error {
 		select {
 		case <-ctx.Done():
 			return nil
+		case <-s.reloadCh:
+			if s.applyReload() {
+				ticker.Reset(s.cfg.Interval)
+			}
+		case req := <-s.pushCh:
+			req.done <- s.handlePush(ctx, req)
 		case <-ticker.C:
+			started := time.Now()
 			if err := s.syncOnce(ctx); err != nil {
 				s.logger.Warn("Sync failed", "error", err)
 			}
+			s.dropMissedTick(ticker, started)
 		}
 	}
 }
 
-func (s *Service) syncOnce(ctx context.Context) error {
-	var errs []error
+func (s *Service) RunOnce(ctx context.Context) error {
+	if s.state != nil {
+		s.lastReconcile = s.state.LastReconcile()
+	}
+	return s.syncOnce(ctx)
+}
+
+func (s *Service) syncOnce(ctx context.Context) (err error) {
+	if !s.syncMu.TryLock() {
+		s.logger.Warn("Sync already in progress; skipping")
+		return ErrSyncInProgress
+	}
+	defer s.syncMu.Unlock()
+
+	start := time.Now()
+	run := &syncRun{}
+	defer func() {
+		s.metrics.SyncFinished(start, err)
+		s.health.finish(start, run.failures)
+		s.trackRecovery(start, run.failures)
+	}()
+
+	force := s.plan != nil || s.needsReconcile()
+	if force {
+		s.logger.Debug("Full reconcile", "last_reconcile", s.lastReconcile)
+	}
 	ipCache := make(map[string]net.IP)
+	var work []*zoneWork
 	for _, zoneCfg := range s.cfg.Zones {
-		ipAddr, ok := ipCache[zoneCfg.IPProviderURL]
-		if !ok {
-			var fetched net.IP
-			s.logger.Info("Fetching current IP", "zone", zoneCfg.Name, "provider", zoneCfg.IPProviderURL, "record_type", zoneCfg.RecordType)
-			err := s.withTimeout(ctx, func(opCtx context.Context) error {
-				var fetchErr error
-				fetched, fetchErr = s.ipFetcher.Fetch(opCtx, zoneCfg.IPProviderURL)
-				return fetchErr
-			})
-			if err != nil {
-				s.logger.Error("IP fetch failed", "zone", zoneCfg.Name, "provider", zoneCfg.IPProviderURL, "error", err)
-				errs = append(errs, fmt.Errorf("zone %s ip fetch: %w", zoneCfg.Name, err))
-				continue
-			}
-			s.logger.Info("Fetched current IP", "zone", zoneCfg.Name, "provider", zoneCfg.IPProviderURL, "ip", fetched.String())
-			ipCache[zoneCfg.IPProviderURL] = fetched
-			ipAddr = fetched
+		work = append(work, s.prepareZone(ctx, run, ipCache, zoneCfg, start, force)...)
+	}
+	var firewalls []*firewallWork
+	for _, fwCfg := range s.cfg.Firewalls {
+		if fw := s.prepareFirewall(ctx, run, ipCache, fwCfg, force); fw != nil {
+			firewalls = append(firewalls, fw)
 		}
+	}
+	work, firewalls = s.guardCircuit(run, work, firewalls)
 
-		ipStr, err := s.normalizeIP(zoneCfg.RecordType, ipAddr)
+	s.forEach(ctx, len(work), func(ctx context.Context, i int) {
+		zw := work[i]
+		zone, err := s.resolveZone(ctx, zw.target, zw.name, force)
 		if err != nil {
-			s.logger.Error("IP validation failed", "zone", zoneCfg.Name, "record_type", zoneCfg.RecordType, "error", err)
-			errs = append(errs, fmt.Errorf("zone %s ip validation: %w", zoneCfg.Name, err))
-			continue
+			s.log(ctx).Error("Zone lookup failed", "zone", zw.target.key, "error", err)
+			s.fail(run, zw.target.key, "", "", metrics.PhaseZoneLookup, fmt.Errorf("zone %s lookup: %w", zw.target.key, err))
+			return
 		}
-		s.logger.Debug("Normalized IP", "zone", zoneCfg.Name, "record_type", zoneCfg.RecordType, "ip", ipStr)
+		zw.zone = zone
+	})
+
+	var groups []*recordGroup
+	for _, zw := range work {
+		if zw.zone != nil {
+			groups = append(groups, zw.groups...)
+		}
+	}
+	s.forEach(ctx, len(groups), func(ctx context.Context, i int) {
+		s.syncRecordGroup(ctx, run, groups[i])
+	})
+	s.forEach(ctx, len(firewalls), func(ctx context.Context, i int) {
+		s.syncFirewall(ctx, run, firewalls[i])
+	})
+
+	for _, zw := range work {
+		if zw.zone != nil {
+			s.publishZone(zw.target.key, zw.addrs, zw.failedTypes)
+		}
+	}
+	if s.plan == nil {
+		if force {
+			s.markReconciled(time.Now())
+		}
+		s.saveState()
+	}
+	if len(run.failures) > 0 {
+		return &SyncError{Failures: run.failures}
+	}
+	return nil
+}
 
-		s.logger.Info("Looking up zone", "zone", zoneCfg.Name)
-		zone, err := s.getZone(ctx, zoneCfg.Name)
+// prepareZone observes the zone's addresses and works out which records need
+// API calls on each of its targets. Targets that need none this run are left
+// out.
+func (s *Service) prepareZone(ctx context.Context, run *syncRun, ipCache map[string]net.IP, zoneCfg config.ZoneConfig, start time.Time, force bool) []*zoneWork {
+	addrs := make(map[string]net.IP)
+	missing := make(map[string]time.Duration)
+	// Records pushed by DynDNS clients take no part in observing addresses.
+	observed := zoneCfg
+	observed.Records = slices.DeleteFunc(slices.Clone(zoneCfg.Records), func(record config.RecordConfig) bool {
+		return s.pushedRecord(zoneCfg.Name, record.Name)
+	})
+	for _, recordType := range zoneRecordTypes(observed) {
+		addr, err := s.observeIP(ctx, ipCache, "zone", zoneCfg.Name, zoneSource(zoneCfg, recordType), recordType)
 		if err != nil {
-			s.logger.Error("Zone lookup failed", "zone", zoneCfg.Name, "error", err)
-			errs = append(errs, fmt.Errorf("zone %s lookup: %w", zoneCfg.Name, err))
+			s.fail(run, zoneCfg.Name, "", recordType, errorPhase(err, metrics.PhaseIPFetch), err)
+			// Only a source that has no address of this family, or whose
+			// providers cannot be connected to, counts as missing; other
+			// failed requests say nothing about the uplink.
+			if errors.Is(err, ip.ErrNoAddress) || errors.Is(err, ip.ErrUnreachable) {
+				missing[recordType] = s.addressMissingFor(zoneCfg.Name, recordType, start)
+			}
 			continue
 		}
-		s.logger.Debug("Zone resolved", "zone", zoneCfg.Name, "zone_id", zone.ID)
+		addrs[recordType] = addr
+		s.addressSeen(zoneCfg.Name, recordType)
+		s.trackObservedIP(zoneCfg.Name, recordType, addr.String())
+	}
 
-		for _, record := range zoneCfg.Records {
-			ttl := record.TTL
-			if ttl == nil {
-				ttl = zoneCfg.TTL
+	var desired, withdrawals []desiredRecord
+	for _, record := range zoneCfg.Records {
+		ttl := record.TTL
+		if ttl == nil {
+			ttl = zoneCfg.TTL
+		}
+		if s.pushedRecord(zoneCfg.Name, record.Name) {
+			desired = append(desired, s.pushedRecords(zoneCfg.Name, record, ttl)...)
+			continue
+		}
+		for _, recordType := range record.Types {
+			addr, ok := addrs[recordType]
+			if !ok {
+				missingFor, isMissing := missing[recordType]
+				policy := withdrawPolicy(record, recordType)
+				switch {
+				case !isMissing || policy.Action == config.WithdrawKeep:
+					s.logger.Warn("Skipping record; no address for type", "zone", zoneCfg.Name, "record", record.Name, "record_type", recordType)
+				case missingFor < s.cfg.WithdrawGrace:
+					s.logger.Warn("Skipping record; no address for type, within withdraw grace period", "zone", zoneCfg.Name, "record", record.Name, "record_type", recordType, "policy", policy.Action, "missing_for", missingFor.Round(time.Second).String(), "grace", s.cfg.WithdrawGrace.String())
+				case policy.Action == config.WithdrawFallback:
+					s.logger.Warn("No address for type; publishing fallback", "zone", zoneCfg.Name, "record", record.Name, "record_type", recordType, "fallback", policy.Fallback.String(), "missing_for", missingFor.Round(time.Second).String())
+					desired = append(desired, desiredRecord{name: record.Name, recordType: recordType, value: policy.Fallback.String(), ttl: ttl, adopt: record.Adopt, reverse: record.Reverse})
+				default:
+					s.logger.Warn("No address for type; withdrawing record", "zone", zoneCfg.Name, "record", record.Name, "record_type", recordType, "missing_for", missingFor.Round(time.Second).String())
+					withdrawals = append(withdrawals, desiredRecord{name: record.Name, recordType: recordType, ttl: ttl, adopt: record.Adopt})
+				}
+				continue
 			}
-			s.logger.Info("Checking record", "zone", zoneCfg.Name, "record", record.Name, "record_type", zoneCfg.RecordType, "ip", ipStr, "ttl", ttlValue(ttl))
-			if err := s.updateRecord(ctx, zone, zoneCfg.RecordType, record.Name, ipStr, ttl); err != nil {
-				s.logger.Error("Record update failed", "zone", zoneCfg.Name, "record", record.Name, "error", err)
-				errs = append(errs, fmt.Errorf("zone %s record %s: %w", zoneCfg.Name, record.Name, err))
+			value := addr.String()
+			if record.Suffix != nil && recordType == "AAAA" {
+				derived, err := ip.CombinePrefix(addr, record.Suffix.Address, record.Suffix.PrefixLen)
+				if err != nil {
+					s.logger.Error("Prefix derivation failed", "zone", zoneCfg.Name, "record", record.Name, "error", err)
+					s.fail(run, zoneCfg.Name, record.Name, recordType, metrics.PhaseIPPrefix, fmt.Errorf("zone %s record %s prefix: %w", zoneCfg.Name, record.Name, err))
+					continue
+				}
+				value = derived.String()
+				s.logger.Debug("Derived address from prefix", "zone", zoneCfg.Name, "record", record.Name, "observed", addr.String(), "prefix_len", record.Suffix.PrefixLen, "suffix", record.Suffix.Address.String(), "ip", value)
 			}
+			desired = append(desired, desiredRecord{name: record.Name, recordType: recordType, value: value, ttl: ttl, adopt: record.Adopt, reverse: record.Reverse})
 		}
 	}
-	if len(errs) > 0 {
-		return fmt.Errorf("sync completed with %d error(s)", len(errs))
+
+	var work []*zoneWork
+	for _, target := range s.zoneTargets(zoneCfg) {
+		pending, pendingWithdrawals := desired, withdrawals
+		if !force {
+			pending = s.changedRecords(target.key, desired)
+			pendingWithdrawals = s.pendingWithdrawals(target.key, withdrawals)
+		}
+		if len(pending) == 0 && len(pendingWithdrawals) == 0 {
+			if len(desired) > 0 {
+				s.logger.Debug("Records unchanged since last sync; skipping API", "zone", target.key, "records", len(desired))
+			}
+			s.publishZone(target.key, addrs, nil)
+			continue
+		}
+		work = append(work, newZoneWork(zoneCfg.Name, target, addrs, pending, pendingWithdrawals))
 	}
-	return nil
+	return work
+}
+
+func (s *Service) syncRecordGroup(ctx context.Context, run *syncRun, group *recordGroup) {
+	zw := group.zone
+	key := zw.target.key
+	for _, rec := range group.updates {
+		s.log(ctx).Info("Checking record", "zone", key, "record", rec.name, "record_type", rec.recordType, "ip", rec.value, "ttl", ttlValue(rec.ttl))
+		rrsetID, owned, err := s.updateRecord(ctx, zw.zone, rec, s.ownedValues(key, rec))
+		if err != nil {
+			s.log(ctx).Error("Record update failed", "zone", key, "record", rec.name, "record_type", rec.recordType, "error", err)
+			phase := errorPhase(err, "unknown")
+			s.fail(run, key, rec.name, rec.recordType, phase, fmt.Errorf("zone %s record %s/%s: %w", key, rec.name, rec.recordType, err))
+			s.notify(notify.Event{Type: notify.EventRecordFailed, Zone: zw.name, Record: rec.name, RecordType: rec.recordType, NewIP: rec.value, Phase: phase, Error: err.Error()})
+			zw.markFailed(rec.recordType)
+			s.rememberOwned(key, rec, owned)
+			continue
+		}
+		if rec.reverse && !zw.target.extra && !s.syncReverse(ctx, run, zw.name, rec) {
+			s.rememberOwned(key, rec, owned)
+			continue
+		}
+		s.rememberRecord(key, rec, rrsetID, owned)
+	}
+	for _, rec := range group.withdrawals {
+		if err := s.withdrawRecord(ctx, zw.zone, rec, s.ownedValues(key, rec)); err != nil {
+			s.log(ctx).Error("Record withdrawal failed", "zone", key, "record", rec.name, "record_type", rec.recordType, "error", err)
+			phase := errorPhase(err, "unknown")
+			s.fail(run, key, rec.name, rec.recordType, phase, fmt.Errorf("zone %s record %s/%s withdraw: %w", key, rec.name, rec.recordType, err))
+			s.notify(notify.Event{Type: notify.EventRecordFailed, Zone: zw.name, Record: rec.name, RecordType: rec.recordType, Phase: phase, Error: err.Error()})
+			continue
+		}
+		s.forgetRecord(key, rec)
+	}
+}
+
+// dropMissedTick discards a tick that fired while a sync was running, so a
+// sync that outlasts the interval is not immediately followed by another.
+func (s *Service) dropMissedTick(ticker *time.Ticker, started time.Time) {
+	select {
+	case <-ticker.C:
+		s.logger.Warn("Sync took longer than the interval; skipping missed tick", "duration", time.Since(started).Round(time.Millisecond).String(), "interval", s.cfg.Interval.String())
+	default:
+	}
+}
+
+func (s *Service) fail(run *syncRun, zone, record, recordType, phase string, err error) {
+	s.metrics.SyncError(zone, record, phase)
+	run.mu.Lock()
+	defer run.mu.Unlock()
+	run.failures = append(run.failures, Failure{
+		Zone:       zone,
+		Record:     record,
+		RecordType: recordType,
+		Phase:      phase,
+		Error:      err.Error(),
+	})
+}
+
+// observeIP returns the current address for recordType from src. target and
+// name ("zone", "example.com") identify what it is observed for in logs and
+// errors.
+func (s *Service) observeIP(ctx context.Context, ipCache map[string]net.IP, target, name string, src config.SourceConfig, recordType string) (net.IP, error) {
+	source := s.newSource(src, recordType)
+	ipAddr, ok := ipCache[source.Key()]
+	if !ok {
+		var fetched net.IP
+		s.logger.Info("Fetching current IP", target, name, "source", source.Key(), "record_type", recordType)
+		err := s.withTimeout(ctx, func(opCtx context.Context) error {
+			var fetchErr error
+			fetched, fetchErr = source.Fetch(opCtx)
+			return fetchErr
+		})
+		var consensusErr *ip.ConsensusError
+		if errors.As(err, &consensusErr) {
+			s.logger.Error("IP providers disagree; skipping records", target, name, "record_type", recordType, "quorum", consensusErr.Quorum, "votes", consensusErr.Votes, "failed_providers", len(consensusErr.Failures))
+			return nil, withPhase(metrics.PhaseIPConsensus, fmt.Errorf("%s %s %s ip consensus: %w", target, name, recordType, err))
+		}
+		if err != nil {
+			s.logger.Error("IP fetch failed", target, name, "source", source.Key(), "record_type", recordType, "error", err)
+			return nil, withPhase(metrics.PhaseIPFetch, fmt.Errorf("%s %s %s ip fetch: %w", target, name, recordType, err))
+		}
+		s.logger.Info("Fetched current IP", target, name, "source", source.Key(), "ip", fetched.String())
+		ipCache[source.Key()] = fetched
+		ipAddr = fetched
+	}
+
+	normalized, err := s.normalizeIP(recordType, ipAddr)
+	if err != nil {
+		s.logger.Error("IP validation failed", target, name, "record_type", recordType, "error", err)
+		return nil, withPhase(metrics.PhaseIPFetch, fmt.Errorf("%s %s ip validation: %w", target, name, err))
+	}
+	s.logger.Debug("Normalized IP", target, name, "record_type", recordType, "ip", normalized.String())
+	return normalized, nil
 }
 
-func (s *Service) normalizeIP(recordType string, ipAddr net.IP) (string, error) {
+func (s *Service) normalizeIP(recordType string, ipAddr net.IP) (net.IP, error) {
 	switch strings.ToUpper(strings.TrimSpace(recordType)) {
 	case "A":
 		ipv4 := ipAddr.To4()
 		if ipv4 == nil {
-			return "", fmt.Errorf("IP provider returned non-IPv4 address for A record")
+			return nil, fmt.Errorf("IP provider returned non-IPv4 address for A record: %w", ip.ErrNoAddress)
 		}
-		return ipv4.String(), nil
+		return ipv4, nil
 	case "AAAA":
 		if ipAddr.To4() != nil {
-			return "", fmt.Errorf("IP provider returned IPv4 address for AAAA record")
+			return nil, fmt.Errorf("IP provider returned IPv4 address for AAAA record: %w", ip.ErrNoAddress)
 		}
-		return ipAddr.String(), nil
+		return ipAddr, nil
 	default:
-		return "", fmt.Errorf("unsupported record type: %s", recordType)
+		return nil, fmt.Errorf("unsupported record type: %s", recordType)
 	}
 }
 
-func (s *Service) getZone(ctx context.Context, name string) (*hcloud.Zone, error) {
+func (s *Service) getZone(ctx context.Context, target zoneTarget, name string) (*hcloud.Zone, error) {
 	var zone *hcloud.Zone
-	err := s.withRetry(ctx, "get zone", func(opCtx context.Context) error {
-		s.logger.Debug("API request: get zone", "zone", name)
+	err := s.retryOn(ctx, target.breaker, "get zone", func(opCtx context.Context) error {
+		s.log(ctx).Debug("API request: get zone", "zone", name)
 		var getErr error
-		zone, _, getErr = s.client.Zone.GetByName(opCtx, name)
+		zone, getErr = target.backend.GetZone(opCtx, name)
 		if getErr != nil {
 			return getErr
 		}
 		if zone == nil {
-			return fmt.Errorf("zone not found: %s", name)
+			return permanent(fmt.Errorf("zone not found: %s", name))
 		}
 		return nil
 	})
 	return zone, err
 }
 
-func (s *Service) updateRecord(ctx context.Context, zone *hcloud.Zone, recordType string, name, ip string, ttl *int) error {
-	rrType := hcloud.ZoneRRSetType(strings.ToUpper(strings.TrimSpace(recordType)))
+// updateRecord publishes rec.value in the RRSet and returns the RRSet ID together with
+// the values the updater owns afterwards. owned lists the values it added on
+// earlier runs; in preserve mode only those are ever removed. The owned values
+// are also returned with an error when the RRSet was changed only partially.
+func (s *Service) updateRecord(ctx context.Context, zone *targetZone, rec desiredRecord, owned []string) (string, []string, error) {
+	name, ip, ttl := rec.name, rec.value, rec.ttl
+	rrType := hcloud.ZoneRRSetType(strings.ToUpper(strings.TrimSpace(rec.recordType)))
 
 	var rrset *hcloud.ZoneRRSet
-	err := s.withRetry(ctx, "get rrset", func(opCtx context.Context) error {
-		s.logger.Debug("API request: get rrset", "zone", zone.Name, "record", name, "record_type", rrType)
+	err := s.retryOn(ctx, zone.breaker, "get rrset", func(opCtx context.Context) error {
+		s.log(ctx).Debug("API request: get rrset", "zone", zone.key, "record", name, "record_type", rrType)
 		var getErr error
-		rrset, _, getErr = s.client.Zone.GetRRSetByNameAndType(opCtx, zone, name, rrType)
+		rrset, getErr = zone.backend.GetRRSet(opCtx, zone.Zone, name, rrType)
 		return getErr
 	})
 	if err != nil {
-		return fmt.Errorf("get rrset %s/%s: %w", name, rrType, err)
+		return "", nil, withPhase(metrics.PhaseRRSetGet, fmt.Errorf("get rrset %s/%s: %w", name, rrType, err))
 	}
 
 	if rrset == nil {
-		s.logger.Info("Record missing; will create", "zone", zone.Name, "record", name, "record_type", rrType, "ip", ip, "ttl", ttlValue(ttl))
-		err := s.withRetry(ctx, "create rrset", func(opCtx context.Context) error {
-			s.logger.Debug("API request: create rrset", "zone", zone.Name, "record", name, "record_type", rrType, "ttl", ttlValue(ttl))
-			_, _, createErr := s.client.Zone.CreateRRSet(opCtx, zone, hcloud.ZoneRRSetCreateOpts{
+		s.log(ctx).Info("Record missing; will create", "zone", zone.key, "record", name, "record_type", rrType, "ip", ip, "ttl", ttlValue(ttl))
+		if err := s.claimOwnership(ctx, zone, name, rrType, rec.adopt); err != nil {
+			return "", nil, err
+		}
+		if s.plan != nil {
+			s.plan.add(PlanEntry{Zone: zone.key, Record: name, RecordType: string(rrType), Action: PlanCreate, TargetValues: []string{ip}, TargetTTL: ttl})
+			return "", []string{ip}, nil
+		}
+		if err := s.beforeUpdate(ctx, zone.Name, rec, nil); err != nil {
+			return "", nil, err
+		}
+		var created *hcloud.ZoneRRSet
+		err := s.retryOn(ctx, zone.breaker, "create rrset", func(opCtx context.Context) error {
+			s.log(ctx).Debug("API request: create rrset", "zone", zone.key, "record", name, "record_type", rrType, "ttl", ttlValue(ttl))
+			var createErr error
+			created, createErr = zone.backend.CreateRRSet(opCtx, zone.Zone, hcloud.ZoneRRSetCreateOpts{
 				Name: name,
 				Type: rrType,
 				TTL:  ttl,
@@ -171,63 +519,139 @@ func (s *Service) updateRecord(ctx context.Context, zone *hcloud.Zone, recordTyp
 			})
 			return createErr
 		})
+		hookErr := s.afterUpdate(ctx, zone.Name, rec, nil, err)
 		if err != nil {
-			return fmt.Errorf("create rrset %s/%s: %w", name, rrType, err)
+			return "", nil, withPhase(metrics.PhaseRRSetCreate, fmt.Errorf("create rrset %s/%s: %w", name, rrType, err))
 		}
-		s.logger.Info("Record created", "zone", zone.Name, "record", name, "ip", ip)
-		return nil
+		s.log(ctx).Info("Record created", "zone", zone.key, "record", name, "ip", ip)
+		s.metrics.RecordChanged(zone.key, "created")
+		s.notify(notify.Event{Type: notify.EventRecordCreated, Zone: zone.Name, Record: name, RecordType: string(rrType), NewIP: ip})
+		if hookErr != nil {
+			return "", []string{ip}, hookErr
+		}
+		if created != nil {
+			return created.ID, []string{ip}, nil
+		}
+		return "", []string{ip}, nil
 	}
 
-	if rrsetHasValue(rrset, ip) {
-		// If we're preserving, any existing match is enough. If not preserving,
-		// only short-circuit when the RRSet is already a single matching record.
-		if !s.cfg.PreserveRecords && len(rrset.Records) > 1 {
-			// fall through to update
-		} else {
-		s.logger.Info("Record already up to date", "zone", zone.Name, "record", name, "ip", ip)
-		if err := s.ensureTTL(ctx, zone.Name, rrset, ttl); err != nil {
-			return err
+	if err := s.checkOwnership(ctx, zone, rrset, rec.adopt); err != nil {
+		// A record someone else manages that already holds our address needs
+		// no change, so it is not worth failing every run over.
+		if errors.Is(err, errNotOwned) && s.upToDate(rrset, ip) {
+			s.log(ctx).Warn("Record is not owned by this updater but already up to date; skipping", "zone", zone.key, "record", name, "record_type", rrType, "ip", ip, "owner_id", s.cfg.TXTOwnerID)
+			return rrset.ID, nil, nil
 		}
-		return nil
+		return "", nil, err
+	}
+
+	if s.upToDate(rrset, ip) {
+		s.log(ctx).Info("Record already up to date", "zone", zone.key, "record", name, "ip", ip)
+		owned, err := s.pruneStale(ctx, zone, rrset, ip, owned)
+		if err != nil {
+			return "", nil, err
 		}
+		if err := s.ensureTTL(ctx, zone, rrset, ttl); err != nil {
+			return "", nil, err
+		}
+		return rrset.ID, owned, nil
 	}
 
 	if s.cfg.PreserveRecords && len(rrset.Records) > 1 {
-		s.logger.Info("Record will append", "zone", zone.Name, "record", name, "record_type", rrType, "ip", ip, "ttl", ttlValue(ttl), "current_values", rrsetValues(rrset))
-		err = s.withRetry(ctx, "add rrset record", func(opCtx context.Context) error {
-			s.logger.Debug("API request: add rrset record", "zone", zone.Name, "record", name, "record_type", rrType, "ttl", ttlValue(ttl))
-			_, _, addErr := s.client.Zone.AddRRSetRecords(opCtx, rrset, hcloud.ZoneRRSetAddRecordsOpts{
-				Records: []hcloud.ZoneRRSetRecord{{Value: ip}},
-				TTL:     ttl,
+		s.log(ctx).Info("Record will append", "zone", zone.key, "record", name, "record_type", rrType, "ip", ip, "ttl", ttlValue(ttl), "current_values", rrsetValues(rrset))
+		if s.plan != nil {
+			current := rrsetValues(rrset)
+			s.plan.add(PlanEntry{Zone: zone.key, Record: name, RecordType: string(rrType), Action: PlanAppend, CurrentValues: current, TargetValues: append(current[:len(current):len(current)], ip), CurrentTTL: rrset.TTL, TargetTTL: ttlChange(rrset, ttl)})
+		} else {
+			if err := s.beforeUpdate(ctx, zone.Name, rec, rrsetValues(rrset)); err != nil {
+				return "", nil, err
+			}
+			err = s.retryOn(ctx, zone.breaker, "add rrset record", func(opCtx context.Context) error {
+				s.log(ctx).Debug("API request: add rrset record", "zone", zone.key, "record", name, "record_type", rrType, "ttl", ttlValue(ttl))
+				return zone.backend.AddRecords(opCtx, rrset, hcloud.ZoneRRSetAddRecordsOpts{
+					Records: []hcloud.ZoneRRSetRecord{{Value: ip}},
+					TTL:     ttl,
+				})
 			})
-			return addErr
-		})
+			hookErr := s.afterUpdate(ctx, zone.Name, rec, rrsetValues(rrset), err)
+			if err != nil {
+				return "", nil, withPhase(metrics.PhaseRRSetAdd, fmt.Errorf("add rrset record %s/%s: %w", name, rrType, err))
+			}
+			s.log(ctx).Info("Record appended", "zone", zone.key, "record", name, "ip", ip)
+			s.metrics.RecordChanged(zone.key, "appended")
+			s.notify(notify.Event{Type: notify.EventRecordUpdated, Zone: zone.Name, Record: name, RecordType: string(rrType), OldValues: rrsetValues(rrset), NewIP: ip})
+			if hookErr != nil {
+				return "", append(owned, ip), hookErr
+			}
+		}
+		// The new value is ours from here on, even if pruning the old ones fails.
+		owned, err := s.pruneStale(ctx, zone, rrset, ip, owned)
 		if err != nil {
-			return fmt.Errorf("add rrset record %s/%s: %w", name, rrType, err)
+			return "", append(owned, ip), err
 		}
-		s.logger.Info("Record appended", "zone", zone.Name, "record", name, "ip", ip)
-		if err := s.ensureTTL(ctx, zone.Name, rrset, ttl); err != nil {
-			return err
+		// A planned append carries the TTL change already.
+		if s.plan == nil {
+			if err := s.ensureTTL(ctx, zone, rrset, ttl); err != nil {
+				return "", nil, err
+			}
 		}
-		return nil
+		return rrset.ID, append(owned, ip), nil
 	}
 
-	s.logger.Info("Record will update", "zone", zone.Name, "record", name, "record_type", rrType, "ip", ip, "ttl", ttlValue(ttl), "current_values", rrsetValues(rrset))
-	err = s.withRetry(ctx, "set rrset records", func(opCtx context.Context) error {
-		s.logger.Debug("API request: set rrset records", "zone", zone.Name, "record", name, "record_type", rrType)
-		_, _, setErr := s.client.Zone.SetRRSetRecords(opCtx, rrset, hcloud.ZoneRRSetSetRecordsOpts{
+	s.log(ctx).Info("Record will update", "zone", zone.key, "record", name, "record_type", rrType, "ip", ip, "ttl", ttlValue(ttl), "current_values", rrsetValues(rrset))
+	if s.plan != nil {
+		s.plan.add(PlanEntry{Zone: zone.key, Record: name, RecordType: string(rrType), Action: PlanReplace, CurrentValues: rrsetValues(rrset), TargetValues: []string{ip}, CurrentTTL: rrset.TTL, TargetTTL: ttlChange(rrset, ttl)})
+		return rrset.ID, []string{ip}, nil
+	}
+	if err := s.beforeUpdate(ctx, zone.Name, rec, rrsetValues(rrset)); err != nil {
+		return "", nil, err
+	}
+	err = s.retryOn(ctx, zone.breaker, "set rrset records", func(opCtx context.Context) error {
+		s.log(ctx).Debug("API request: set rrset records", "zone", zone.key, "record", name, "record_type", rrType)
+		return zone.backend.SetRecords(opCtx, rrset, hcloud.ZoneRRSetSetRecordsOpts{
 			Records: []hcloud.ZoneRRSetRecord{{Value: ip}},
 		})
-		return setErr
 	})
+	hookErr := s.afterUpdate(ctx, zone.Name, rec, rrsetValues(rrset), err)
 	if err != nil {
-		return fmt.Errorf("set rrset records %s/%s: %w", name, rrType, err)
+		return "", nil, withPhase(metrics.PhaseRRSetSet, fmt.Errorf("set rrset records %s/%s: %w", name, rrType, err))
 	}
-	s.logger.Info("Record updated", "zone", zone.Name, "record", name, "ip", ip, "preserve", s.cfg.PreserveRecords)
-	if err := s.ensureTTL(ctx, zone.Name, rrset, ttl); err != nil {
-		return err
+	s.log(ctx).Info("Record updated", "zone", zone.key, "record", name, "ip", ip, "preserve", s.cfg.PreserveRecords)
+	s.metrics.RecordChanged(zone.key, "replaced")
+	s.notify(notify.Event{Type: notify.EventRecordUpdated, Zone: zone.Name, Record: name, RecordType: string(rrType), OldValues: rrsetValues(rrset), NewIP: ip})
+	if hookErr != nil {
+		return "", []string{ip}, hookErr
+	}
+	if err := s.ensureTTL(ctx, zone, rrset, ttl); err != nil {
+		return "", nil, err
+	}
+	return rrset.ID, []string{ip}, nil
+}
+
+func (s *Service) trackObservedIP(zoneName, recordType, addr string) {
+	key := zoneName + "/" + recordType
+	previous, seen := s.lastObserved[key]
+	s.lastObserved[key] = addr
+	if seen && previous != addr {
+		s.logger.Info("Public IP changed", "zone", zoneName, "record_type", recordType, "old_ip", previous, "new_ip", addr)
+		s.metrics.IPChanged(zoneName, recordType)
+		s.notify(notify.Event{Type: notify.EventIPChanged, Zone: zoneName, RecordType: recordType, OldIP: previous, NewIP: addr})
 	}
-	return nil
+}
+
+func (s *Service) publishZone(zoneName string, addrs map[string]net.IP, failedTypes map[string]bool) {
+	for recordType, addr := range addrs {
+		if failedTypes[recordType] {
+			continue
+		}
+		s.metrics.Published(zoneName, recordType, addr.String())
+	}
+}
+
+// upToDate reports whether the RRSet already publishes ip. When preserving,
+// any existing match is enough; otherwise the RRSet must be that single value.
+func (s *Service) upToDate(rrset *hcloud.ZoneRRSet, ip string) bool {
+	return rrsetHasValue(rrset, ip) && (s.cfg.PreserveRecords || len(rrset.Records) == 1)
 }
 
 func rrsetHasValue(rrset *hcloud.ZoneRRSet, ip string) bool {
@@ -258,25 +682,36 @@ func ttlValue(ttl *int) any {
 	return *ttl
 }
 
-func (s *Service) ensureTTL(ctx context.Context, zoneName string, rrset *hcloud.ZoneRRSet, ttl *int) error {
-	if ttl == nil {
+// ttlChange returns ttl when the RRSet needs it set, or nil when no TTL is
+// configured or the RRSet has it already.
+func ttlChange(rrset *hcloud.ZoneRRSet, ttl *int) *int {
+	if ttl == nil || (rrset.TTL != nil && *rrset.TTL == *ttl) {
 		return nil
 	}
-	if rrset.TTL != nil && *rrset.TTL == *ttl {
+	return ttl
+}
+
+func (s *Service) ensureTTL(ctx context.Context, zone *targetZone, rrset *hcloud.ZoneRRSet, ttl *int) error {
+	if ttl = ttlChange(rrset, ttl); ttl == nil {
+		return nil
+	}
+	s.log(ctx).Info("Record TTL will change", "zone", zone.key, "record", rrset.Name, "current_ttl", ttlValue(rrset.TTL), "target_ttl", *ttl)
+	if s.plan != nil {
+		values := rrsetValues(rrset)
+		s.plan.add(PlanEntry{Zone: zone.key, Record: rrset.Name, RecordType: string(rrset.Type), Action: PlanTTLChange, CurrentValues: values, TargetValues: values, CurrentTTL: rrset.TTL, TargetTTL: ttl})
 		return nil
 	}
-	s.logger.Info("Record TTL will change", "zone", zoneName, "record", rrset.Name, "current_ttl", ttlValue(rrset.TTL), "target_ttl", *ttl)
-	err := s.withRetry(ctx, "change rrset ttl", func(opCtx context.Context) error {
-		s.logger.Debug("API request: change rrset ttl", "zone", zoneName, "record", rrset.Name, "ttl", *ttl)
-		_, _, changeErr := s.client.Zone.ChangeRRSetTTL(opCtx, rrset, hcloud.ZoneRRSetChangeTTLOpts{
+	err := s.retryOn(ctx, zone.breaker, "change rrset ttl", func(opCtx context.Context) error {
+		s.log(ctx).Debug("API request: change rrset ttl", "zone", zone.key, "record", rrset.Name, "ttl", *ttl)
+		return zone.backend.ChangeTTL(opCtx, rrset, hcloud.ZoneRRSetChangeTTLOpts{
 			TTL: ttl,
 		})
-		return changeErr
 	})
 	if err != nil {
-		return fmt.Errorf("change rrset ttl: %w", err)
+		return withPhase(metrics.PhaseTTLChange, fmt.Errorf("change rrset ttl: %w", err))
 	}
-	s.logger.Info("Record TTL updated", "zone", zoneName, "record", rrset.Name, "ttl", *ttl)
+	s.log(ctx).Info("Record TTL updated", "zone", zone.key, "record", rrset.Name, "ttl", *ttl)
+	s.metrics.RecordChanged(zone.key, "ttl_changed")
 	return nil
 }
 
@@ -286,13 +721,46 @@ func (s *Service) withTimeout(ctx context.Context, fn func(context.Context) erro
 	return fn(opCtx)
 }
 
+// withRetry runs a Hetzner API operation behind the API circuit breaker.
 func (s *Service) withRetry(ctx context.Context, label string, fn func(context.Context) error) error {
-	return retry(ctx, s.cfg.RetryAttempts, s.cfg.RetryBaseDelay, s.cfg.RetryMaxDelay, func(opCtx context.Context, attempt int) error {
-		err := s.withTimeout(opCtx, fn)
-		if err != nil {
-			s.logger.Warn("Operation failed", "op", label, "attempt", attempt, "error", err)
+	return s.retryOn(ctx, s.breaker, label, fn)
+}
+
+// retryOn runs an operation behind circuit breaker b, or without one when b
+// is nil.
+func (s *Service) retryOn(ctx context.Context, b *breaker, label string, fn func(context.Context) error) error {
+	var probe bool
+	if b != nil {
+		var err error
+		if probe, err = b.allow(time.Now()); err != nil {
 			return err
 		}
-		return nil
+	}
+	attempts := s.cfg.RetryAttempts
+	if probe {
+		attempts = 1
+		s.log(ctx).Info("API circuit half-open; probing", "op", label)
+		s.metrics.CircuitState(circuitHalfOpen)
+	}
+	var class string
+	err := retry(ctx, attempts, s.cfg.RetryBaseDelay, s.cfg.RetryMaxDelay, func(opCtx context.Context, attempt int) error {
+		return s.withTimeout(opCtx, fn)
+	}, func(attempt int, err error, decision retryDecision) {
+		if decision.retry {
+			s.metrics.Retry(label, decision.class)
+			s.log(ctx).Warn("Operation failed; retrying", "op", label, "attempt", attempt, "class", decision.class, "code", decision.code, "wait", decision.wait.Round(time.Millisecond).String(), "error", err)
+			return
+		}
+		class = decision.class
+		s.metrics.APIFailure(label, decision.class)
+		if decision.class == classRateLimited && decision.wait > maxRateLimitWait {
+			s.log(ctx).Warn("Operation rate limited; giving up until next run", "op", label, "attempt", attempt, "wait", decision.wait.Round(time.Second).String(), "error", err)
+			return
+		}
+		s.log(ctx).Warn("Operation failed", "op", label, "attempt", attempt, "class", decision.class, "code", decision.code, "error", err)
 	})
+	if b != nil {
+		s.recordOutcome(ctx, b, label, probe, err, class)
+	}
+	return err
 }
@@ -0,0 +1,198 @@
+package ddns
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"hetzner-ddns/internal/config"
+	"hetzner-ddns/internal/ip"
+	"hetzner-ddns/internal/metrics"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+)
+
+// memoryBackend is a dnsBackend holding RRSets in memory. changes lists every
+// call that modified them.
+type memoryBackend struct {
+	mu      sync.Mutex
+	rrsets  map[string]*hcloud.ZoneRRSet
+	changes []string
+}
+
+func newMemoryBackend() *memoryBackend {
+	return &memoryBackend{rrsets: make(map[string]*hcloud.ZoneRRSet)}
+}
+
+func memoryKey(name string, rrType hcloud.ZoneRRSetType) string {
+	return name + "/" + string(rrType)
+}
+
+// put stores an RRSet as if someone else had created it.
+func (b *memoryBackend) put(name string, rrType hcloud.ZoneRRSetType, values ...string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	rrset := &hcloud.ZoneRRSet{ID: memoryKey(name, rrType), Name: name, Type: rrType}
+	for _, value := range values {
+		rrset.Records = append(rrset.Records, hcloud.ZoneRRSetRecord{Value: value})
+	}
+	b.rrsets[memoryKey(name, rrType)] = rrset
+}
+
+// values returns the values of an RRSet, or nil when it does not exist.
+func (b *memoryBackend) values(name string, rrType hcloud.ZoneRRSetType) []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	rrset, ok := b.rrsets[memoryKey(name, rrType)]
+	if !ok {
+		return nil
+	}
+	return rrsetValues(rrset)
+}
+
+func (b *memoryBackend) changed(op string, rrset *hcloud.ZoneRRSet) {
+	b.changes = append(b.changes, op+" "+memoryKey(rrset.Name, rrset.Type))
+}
+
+func (b *memoryBackend) GetZone(ctx context.Context, name string) (*hcloud.Zone, error) {
+	return &hcloud.Zone{ID: 1, Name: name}, nil
+}
+
+func (b *memoryBackend) GetRRSet(ctx context.Context, zone *hcloud.Zone, name string, rrType hcloud.ZoneRRSetType) (*hcloud.ZoneRRSet, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	rrset, ok := b.rrsets[memoryKey(name, rrType)]
+	if !ok {
+		return nil, nil
+	}
+	out := *rrset
+	out.Zone = zone
+	out.Records = slices.Clone(rrset.Records)
+	return &out, nil
+}
+
+func (b *memoryBackend) CreateRRSet(ctx context.Context, zone *hcloud.Zone, opts hcloud.ZoneRRSetCreateOpts) (*hcloud.ZoneRRSet, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	rrset := &hcloud.ZoneRRSet{Zone: zone, ID: memoryKey(opts.Name, opts.Type), Name: opts.Name, Type: opts.Type, TTL: opts.TTL, Records: slices.Clone(opts.Records)}
+	b.rrsets[rrset.ID] = rrset
+	b.changed("create", rrset)
+	return rrset, nil
+}
+
+func (b *memoryBackend) AddRecords(ctx context.Context, rrset *hcloud.ZoneRRSet, opts hcloud.ZoneRRSetAddRecordsOpts) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	stored := b.rrsets[memoryKey(rrset.Name, rrset.Type)]
+	stored.Records = append(stored.Records, opts.Records...)
+	b.changed("add", rrset)
+	return nil
+}
+
+func (b *memoryBackend) RemoveRecords(ctx context.Context, rrset *hcloud.ZoneRRSet, opts hcloud.ZoneRRSetRemoveRecordsOpts) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	stored := b.rrsets[memoryKey(rrset.Name, rrset.Type)]
+	stored.Records = slices.DeleteFunc(stored.Records, func(r hcloud.ZoneRRSetRecord) bool {
+		return slices.ContainsFunc(opts.Records, func(o hcloud.ZoneRRSetRecord) bool { return o.Value == r.Value })
+	})
+	if len(stored.Records) == 0 {
+		delete(b.rrsets, stored.ID)
+	}
+	b.changed("remove", rrset)
+	return nil
+}
+
+func (b *memoryBackend) SetRecords(ctx context.Context, rrset *hcloud.ZoneRRSet, opts hcloud.ZoneRRSetSetRecordsOpts) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.rrsets[memoryKey(rrset.Name, rrset.Type)].Records = slices.Clone(opts.Records)
+	b.changed("set", rrset)
+	return nil
+}
+
+func (b *memoryBackend) ChangeTTL(ctx context.Context, rrset *hcloud.ZoneRRSet, opts hcloud.ZoneRRSetChangeTTLOpts) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.rrsets[memoryKey(rrset.Name, rrset.Type)].TTL = opts.TTL
+	b.changed("ttl", rrset)
+	return nil
+}
+
+func (b *memoryBackend) DeleteRRSet(ctx context.Context, rrset *hcloud.ZoneRRSet) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.rrsets, memoryKey(rrset.Name, rrset.Type))
+	b.changed("delete", rrset)
+	return nil
+}
+
+// staticSources is an ip.Factory whose sources answer from addrs, keyed by
+// provider URL or interface name. A missing entry answers with err.
+type staticSources struct {
+	addrs map[string]net.IP
+	err   error
+}
+
+type staticSource struct {
+	key     string
+	sources *staticSources
+}
+
+func (s staticSource) Key() string {
+	return s.key
+}
+
+func (s staticSource) Fetch(ctx context.Context) (net.IP, error) {
+	if addr, ok := s.sources.addrs[s.key]; ok {
+		return addr, nil
+	}
+	return nil, s.sources.err
+}
+
+func (f *staticSources) Providers(urls []string, quorum int) ip.Source {
+	return staticSource{key: urls[0], sources: f}
+}
+
+func (f *staticSources) Interface(name string, family ip.Family, filter ip.InterfaceFilter) ip.Source {
+	return staticSource{key: name, sources: f}
+}
+
+func testConfig(zones ...config.ZoneConfig) config.Config {
+	return config.Config{
+		Zones:            zones,
+		Interval:         time.Minute,
+		RequestTimeout:   time.Second,
+		RetryAttempts:    1,
+		RetryBaseDelay:   time.Millisecond,
+		RetryMaxDelay:    time.Millisecond,
+		Concurrency:      1,
+		BreakerThreshold: 0,
+		BreakerCooldown:  time.Minute,
+		TXTPrefix:        "_hetzner-ddns.",
+		WithdrawGrace:    time.Minute,
+		ReadyIntervals:   3,
+	}
+}
+
+// testZone returns example.com on backend as its Hetzner target.
+func testZone(backend dnsBackend) *targetZone {
+	return &targetZone{Zone: &hcloud.Zone{ID: 1, Name: "example.com"}, zoneTarget: zoneTarget{key: "example.com", backend: backend}}
+}
+
+// newTestService returns a service whose zones all live in backend.
+func newTestService(t *testing.T, cfg config.Config, backend dnsBackend, sources *staticSources) *Service {
+	t.Helper()
+	if sources == nil {
+		sources = &staticSources{}
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	s := NewService(nil, func(time.Duration, string) ip.Factory { return sources }, nil, metrics.New(), nil, logger, cfg)
+	s.cloud = backend
+	return s
+}
@@ -0,0 +1,52 @@
+package ddns
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	"hetzner-ddns/internal/config"
+	"hetzner-ddns/internal/ip"
+)
+
+// SourceFactory builds the IP source factory for the HTTP timeout and user
+// agent. It is called again when either changes on reload.
+type SourceFactory func(timeout time.Duration, userAgent string) ip.Factory
+
+func (s *Service) newSource(src config.SourceConfig, recordType string) ip.Source {
+	if src.Interface != "" {
+		return s.sources.Interface(src.Interface, recordFamily(recordType), ip.InterfaceFilter{
+			GlobalOnly:        src.InterfaceFilter.GlobalOnly,
+			ExcludeTemporary:  src.InterfaceFilter.ExcludeTemporary,
+			ExcludeDeprecated: src.InterfaceFilter.ExcludeDeprecated,
+			ExcludeULA:        src.InterfaceFilter.ExcludeULA,
+		})
+	}
+	return s.sources.Providers(src.Providers, src.Quorum)
+}
+
+func zoneSource(zoneCfg config.ZoneConfig, recordType string) config.SourceConfig {
+	if recordFamily(recordType) == ip.IPv6 {
+		return zoneCfg.IPv6Source
+	}
+	return zoneCfg.IPv4Source
+}
+
+func zoneRecordTypes(zoneCfg config.ZoneConfig) []string {
+	var types []string
+	for _, record := range zoneCfg.Records {
+		for _, recordType := range record.Types {
+			if !slices.Contains(types, recordType) {
+				types = append(types, recordType)
+			}
+		}
+	}
+	return types
+}
+
+func recordFamily(recordType string) ip.Family {
+	if strings.ToUpper(strings.TrimSpace(recordType)) == "AAAA" {
+		return ip.IPv6
+	}
+	return ip.IPv4
+}
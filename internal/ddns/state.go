@@ -0,0 +1,113 @@
+package ddns
+
+import (
+	"context"
+	"time"
+
+	"hetzner-ddns/internal/state"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+)
+
+func (s *Service) needsReconcile() bool {
+	if s.state == nil || s.lastReconcile.IsZero() {
+		return true
+	}
+	return time.Since(s.lastReconcile) >= s.cfg.ReconcileInterval
+}
+
+func (s *Service) markReconciled(at time.Time) {
+	s.lastReconcile = at
+	if s.state != nil {
+		s.state.SetLastReconcile(at)
+	}
+}
+
+func (s *Service) changedRecords(zoneName string, desired []desiredRecord) []desiredRecord {
+	var changed []desiredRecord
+	for _, rec := range desired {
+		known, ok := s.state.Record(state.RecordKey(zoneName, rec.name, rec.recordType))
+		if ok && known.Value == rec.value && ttlEqual(known.TTL, rec.ttl) {
+			continue
+		}
+		changed = append(changed, rec)
+	}
+	return changed
+}
+
+func (s *Service) resolveZone(ctx context.Context, target zoneTarget, name string, force bool) (*targetZone, error) {
+	if !force && s.state != nil {
+		if known, ok := s.state.Zone(target.key); ok && known.ID != 0 {
+			s.log(ctx).Debug("Zone resolved from state", "zone", target.key, "zone_id", known.ID)
+			return &targetZone{Zone: &hcloud.Zone{ID: known.ID, Name: name}, zoneTarget: target}, nil
+		}
+	}
+	s.log(ctx).Info("Looking up zone", "zone", target.key)
+	zone, err := s.getZone(ctx, target, name)
+	if err != nil {
+		return nil, err
+	}
+	s.log(ctx).Debug("Zone resolved", "zone", target.key, "zone_id", zone.ID)
+	if s.state != nil {
+		s.state.SetZone(target.key, state.Zone{ID: zone.ID})
+	}
+	return &targetZone{Zone: zone, zoneTarget: target}, nil
+}
+
+// ownedValues returns the values this updater added to the record's RRSet and
+// has not removed since, so that only those are ever pruned.
+func (s *Service) ownedValues(zoneName string, rec desiredRecord) []string {
+	if s.state == nil {
+		return nil
+	}
+	known, _ := s.state.Record(state.RecordKey(zoneName, rec.name, rec.recordType))
+	return known.Owned
+}
+
+func (s *Service) rememberRecord(zoneName string, rec desiredRecord, rrsetID string, owned []string) {
+	if s.state == nil || s.plan != nil {
+		return
+	}
+	s.state.SetRecord(state.RecordKey(zoneName, rec.name, rec.recordType), state.Record{
+		Value:     rec.value,
+		TTL:       rec.ttl,
+		RRSetID:   rrsetID,
+		Owned:     owned,
+		UpdatedAt: time.Now().UTC(),
+	})
+}
+
+func (s *Service) forgetRecord(zoneName string, rec desiredRecord) {
+	if s.state == nil || s.plan != nil {
+		return
+	}
+	s.state.DeleteRecord(state.RecordKey(zoneName, rec.name, rec.recordType))
+}
+
+// rememberOwned records ownership after a partially applied update without
+// touching the stored value, so the record is retried on the next run.
+func (s *Service) rememberOwned(zoneName string, rec desiredRecord, owned []string) {
+	if s.state == nil || s.plan != nil || owned == nil {
+		return
+	}
+	key := state.RecordKey(zoneName, rec.name, rec.recordType)
+	known, _ := s.state.Record(key)
+	known.Owned = owned
+	s.state.SetRecord(key, known)
+}
+
+func (s *Service) saveState() {
+	if s.state == nil {
+		return
+	}
+	if err := s.state.Save(); err != nil {
+		s.logger.Warn("State save failed", "path", s.cfg.StateFile, "error", err)
+	}
+}
+
+func ttlEqual(a, b *int) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
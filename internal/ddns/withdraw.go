@@ -0,0 +1,143 @@
+package ddns
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"hetzner-ddns/internal/config"
+	"hetzner-ddns/internal/metrics"
+	"hetzner-ddns/internal/state"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+)
+
+// addressMissingFor records that the source for zone/recordType has no address
+// and returns how long that has been the case.
+func (s *Service) addressMissingFor(zoneName, recordType string, now time.Time) time.Duration {
+	key := zoneName + "/" + recordType
+	since, ok := s.missingSince[key]
+	if !ok {
+		since = now
+		if s.state != nil {
+			if stored, found := s.state.MissingSince(key); found {
+				since = stored
+			} else if s.plan == nil {
+				s.state.SetMissingSince(key, now)
+			}
+		}
+		s.missingSince[key] = since
+	}
+	return now.Sub(since)
+}
+
+func (s *Service) addressSeen(zoneName, recordType string) {
+	key := zoneName + "/" + recordType
+	delete(s.missingSince, key)
+	if s.state != nil && s.plan == nil {
+		s.state.ClearMissing(key)
+	}
+}
+
+// withdrawPolicy returns the action for a record type; a fallback address of
+// the other family leaves the record alone.
+func withdrawPolicy(record config.RecordConfig, recordType string) config.WithdrawPolicy {
+	policy := record.Withdraw
+	if policy.Action == config.WithdrawFallback && !recordFamily(recordType).Matches(policy.Fallback) {
+		return config.WithdrawPolicy{Action: config.WithdrawKeep}
+	}
+	if policy.Action == "" {
+		policy.Action = config.WithdrawKeep
+	}
+	return policy
+}
+
+// pendingWithdrawals drops records the state file does not know about: they
+// were either never published or already withdrawn on an earlier run.
+func (s *Service) pendingWithdrawals(zoneName string, withdrawals []desiredRecord) []desiredRecord {
+	var pending []desiredRecord
+	for _, rec := range withdrawals {
+		if _, ok := s.state.Record(state.RecordKey(zoneName, rec.name, rec.recordType)); ok {
+			pending = append(pending, rec)
+		}
+	}
+	return pending
+}
+
+// withdrawRecord removes the updater's values for a record whose source has no
+// address. Preserved multi-value RRSets only lose the values the updater owns;
+// otherwise the whole RRSet is deleted together with our owner marker.
+func (s *Service) withdrawRecord(ctx context.Context, zone *targetZone, rec desiredRecord, owned []string) error {
+	rrType := hcloud.ZoneRRSetType(rec.recordType)
+
+	var rrset *hcloud.ZoneRRSet
+	err := s.retryOn(ctx, zone.breaker, "get rrset", func(opCtx context.Context) error {
+		s.log(ctx).Debug("API request: get rrset", "zone", zone.key, "record", rec.name, "record_type", rrType)
+		var getErr error
+		rrset, getErr = zone.backend.GetRRSet(opCtx, zone.Zone, rec.name, rrType)
+		return getErr
+	})
+	if err != nil {
+		return withPhase(metrics.PhaseRRSetGet, fmt.Errorf("get rrset %s/%s: %w", rec.name, rrType, err))
+	}
+	if rrset == nil {
+		s.log(ctx).Info("Record already absent", "zone", zone.key, "record", rec.name, "record_type", rrType)
+		return nil
+	}
+	if err := s.checkOwnership(ctx, zone, rrset, rec.adopt); err != nil {
+		return err
+	}
+
+	values := rrsetValues(rrset)
+	if s.cfg.PreserveRecords && len(values) > 1 {
+		var ours []hcloud.ZoneRRSetRecord
+		var oursValues []string
+		for _, value := range values {
+			if slices.Contains(owned, value) {
+				ours = append(ours, hcloud.ZoneRRSetRecord{Value: value})
+				oursValues = append(oursValues, value)
+			}
+		}
+		if len(ours) == 0 {
+			s.log(ctx).Warn("Preserved RRSet holds no values added by the updater; nothing to withdraw", "zone", zone.key, "record", rec.name, "record_type", rrType, "current_values", values)
+			return nil
+		}
+		if len(ours) < len(values) {
+			s.log(ctx).Info("Record values will be withdrawn", "zone", zone.key, "record", rec.name, "record_type", rrType, "values", oursValues)
+			if s.plan != nil {
+				target := slices.DeleteFunc(slices.Clone(values), func(v string) bool { return slices.Contains(oursValues, v) })
+				s.plan.add(PlanEntry{Zone: zone.key, Record: rec.name, RecordType: string(rrType), Action: PlanWithdraw, CurrentValues: values, TargetValues: target})
+				return nil
+			}
+			err := s.retryOn(ctx, zone.breaker, "remove rrset records", func(opCtx context.Context) error {
+				s.log(ctx).Debug("API request: remove rrset records", "zone", zone.key, "record", rec.name, "record_type", rrType)
+				return zone.backend.RemoveRecords(opCtx, rrset, hcloud.ZoneRRSetRemoveRecordsOpts{
+					Records: ours,
+				})
+			})
+			if err != nil {
+				return withPhase(metrics.PhaseRRSetRemove, fmt.Errorf("remove rrset records %s/%s: %w", rec.name, rrType, err))
+			}
+			s.log(ctx).Info("Record values withdrawn", "zone", zone.key, "record", rec.name, "record_type", rrType, "values", oursValues)
+			s.metrics.RecordChanged(zone.key, "withdrawn")
+			return nil
+		}
+	}
+
+	s.log(ctx).Info("Record will be deleted", "zone", zone.key, "record", rec.name, "record_type", rrType, "current_values", values)
+	if s.plan != nil {
+		s.plan.add(PlanEntry{Zone: zone.key, Record: rec.name, RecordType: string(rrType), Action: PlanDelete, CurrentValues: values, TargetValues: []string{}, CurrentTTL: rrset.TTL})
+		return s.removeOwnerMarker(ctx, zone, rec.name, rrType)
+	}
+	err = s.retryOn(ctx, zone.breaker, "delete rrset", func(opCtx context.Context) error {
+		s.log(ctx).Debug("API request: delete rrset", "zone", zone.key, "record", rec.name, "record_type", rrType)
+		return zone.backend.DeleteRRSet(opCtx, rrset)
+	})
+	if err != nil {
+		return withPhase(metrics.PhaseRRSetDelete, fmt.Errorf("delete rrset %s/%s: %w", rec.name, rrType, err))
+	}
+	s.log(ctx).Info("Record deleted", "zone", zone.key, "record", rec.name, "record_type", rrType)
+	s.metrics.RecordChanged(zone.key, "deleted")
+	return s.removeOwnerMarker(ctx, zone, rec.name, rrType)
+}
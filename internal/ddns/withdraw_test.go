@@ -0,0 +1,158 @@
+package ddns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"hetzner-ddns/internal/config"
+	"hetzner-ddns/internal/ip"
+	"hetzner-ddns/internal/metrics"
+)
+
+func TestPrepareZoneCountsOnlyMissingAddress(t *testing.T) {
+	zoneCfg := config.ZoneConfig{
+		Name:       "example.com",
+		Records:    []config.RecordConfig{{Name: "www", Types: []string{"A", "AAAA"}, Withdraw: config.WithdrawPolicy{Action: config.WithdrawDelete}}},
+		IPv4Source: config.SourceConfig{Providers: []string{"https://v4.example"}},
+		IPv6Source: config.SourceConfig{Interface: "eth1"},
+	}
+	tests := []struct {
+		name    string
+		err     error
+		missing bool
+	}{
+		{"request failure", errors.New("connection refused"), false},
+		{"no address", ip.ErrNoAddress, true},
+		{"unreachable provider", fmt.Errorf("%w: connect: network is unreachable", ip.ErrUnreachable), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sources := &staticSources{err: tt.err}
+			s := newTestService(t, testConfig(zoneCfg), newMemoryBackend(), sources)
+			s.prepareZone(context.Background(), &syncRun{}, make(map[string]net.IP), zoneCfg, time.Now(), true)
+			for _, key := range []string{"example.com/A", "example.com/AAAA"} {
+				if _, ok := s.missingSince[key]; ok != tt.missing {
+					t.Errorf("%s missing = %v, want %v", key, ok, tt.missing)
+				}
+			}
+		})
+	}
+}
+
+func TestPrepareZoneCountsOtherFamilyAsMissing(t *testing.T) {
+	zoneCfg := config.ZoneConfig{
+		Name:       "example.com",
+		Records:    []config.RecordConfig{{Name: "www", Types: []string{"AAAA"}}},
+		IPv6Source: config.SourceConfig{Providers: []string{"https://v6.example"}},
+	}
+	sources := &staticSources{addrs: map[string]net.IP{"https://v6.example": net.ParseIP("203.0.113.1")}}
+	s := newTestService(t, testConfig(zoneCfg), newMemoryBackend(), sources)
+	s.prepareZone(context.Background(), &syncRun{}, make(map[string]net.IP), zoneCfg, time.Now(), true)
+	if _, ok := s.missingSince["example.com/AAAA"]; !ok {
+		t.Fatal("IPv4 answer for AAAA not counted as missing address")
+	}
+}
+
+func TestWithdrawRecordRemovesOwnerMarker(t *testing.T) {
+	ctx := context.Background()
+	for _, dryRun := range []bool{false, true} {
+		backend := newMemoryBackend()
+		cfg := testConfig()
+		cfg.TXTOwnerID = "home"
+		s := newTestService(t, cfg, backend, nil)
+		backend.put("www", "A", "203.0.113.1")
+		backend.put("www", "AAAA", "2001:db8::1")
+		backend.put("_hetzner-ddns.www", "TXT", s.ownerMarkerValue("A"), s.ownerMarkerValue("AAAA"))
+		if dryRun {
+			s.plan = &Plan{}
+		}
+		zone := testZone(backend)
+
+		if err := s.withdrawRecord(ctx, zone, desiredRecord{name: "www", recordType: "A"}, nil); err != nil {
+			t.Fatalf("dry run %v: withdraw: %v", dryRun, err)
+		}
+		markers := backend.values("_hetzner-ddns.www", "TXT")
+		if dryRun {
+			if len(backend.changes) > 0 {
+				t.Fatalf("dry run changed records: %v", backend.changes)
+			}
+			if len(s.plan.Changes) != 2 || s.plan.Changes[1].Action != PlanWithdraw || !slices.Equal(s.plan.Changes[1].TargetValues, []string{s.ownerMarkerValue("AAAA")}) {
+				t.Fatalf("plan = %+v", s.plan.Changes)
+			}
+			continue
+		}
+		if backend.values("www", "A") != nil {
+			t.Fatal("record not deleted")
+		}
+		if !slices.Equal(markers, []string{s.ownerMarkerValue("AAAA")}) {
+			t.Fatalf("markers = %v", markers)
+		}
+
+		if err := s.withdrawRecord(ctx, zone, desiredRecord{name: "www", recordType: "AAAA"}, nil); err != nil {
+			t.Fatalf("withdraw AAAA: %v", err)
+		}
+		if markers := backend.values("_hetzner-ddns.www", "TXT"); markers != nil {
+			t.Fatalf("marker RRSet left behind: %v", markers)
+		}
+	}
+}
+
+func TestSyncWithdrawsRecordWhenProviderUnreachable(t *testing.T) {
+	unavailable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer unavailable.Close()
+
+	tests := []struct {
+		name      string
+		provider  string
+		withdrawn bool
+	}{
+		// The IPv6 uplink is down: connecting to the IPv6-only provider fails.
+		{"unreachable", "https://api6.example", true},
+		{"http error", unavailable.URL, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport := http.DefaultTransport
+			var dialer net.Dialer
+			http.DefaultTransport = &http.Transport{DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				if strings.HasPrefix(addr, "127.0.0.1:") {
+					return dialer.DialContext(ctx, network, addr)
+				}
+				return nil, &net.OpError{Op: "dial", Net: network, Err: os.NewSyscallError("connect", syscall.ENETUNREACH)}
+			}}
+			defer func() { http.DefaultTransport = transport }()
+
+			zoneCfg := config.ZoneConfig{
+				Name:       "example.com",
+				Records:    []config.RecordConfig{{Name: "www", Types: []string{"AAAA"}, Withdraw: config.WithdrawPolicy{Action: config.WithdrawDelete}}},
+				IPv6Source: config.SourceConfig{Providers: []string{tt.provider}},
+			}
+			cfg := testConfig(zoneCfg)
+			cfg.WithdrawGrace = 0
+			backend := newMemoryBackend()
+			backend.put("www", "AAAA", "2001:db8::1")
+			s := newTestService(t, cfg, backend, nil)
+			s.sources = ip.NewFactory(time.Second, "test")
+
+			var syncErr *SyncError
+			if err := s.syncOnce(context.Background()); !errors.As(err, &syncErr) || syncErr.Failures[0].Phase != metrics.PhaseIPFetch {
+				t.Fatalf("sync: %v, want an ip_fetch failure", err)
+			}
+			if withdrawn := backend.values("www", "AAAA") == nil; withdrawn != tt.withdrawn {
+				t.Fatalf("withdrawn = %v, want %v (changes %v)", withdrawn, tt.withdrawn, backend.changes)
+			}
+		})
+	}
+}
@@ -0,0 +1,207 @@
+// Package dnsconsole is a minimal client for the legacy Hetzner DNS Console
+// API at dns.hetzner.com, covering the zone lookup and record calls the
+// updater needs.
+package dnsconsole
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Records are listed in pages of this size.
+const pageSize = 100
+
+type Zone struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	TTL  int    `json:"ttl"`
+}
+
+// Record is a single value; the console has no RRSets, so the records of one
+// name and type together make up what the Cloud API calls an RRSet.
+type Record struct {
+	ID     string `json:"id,omitempty"`
+	ZoneID string `json:"zone_id"`
+	Type   string `json:"type"`
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	TTL    *int   `json:"ttl,omitempty"`
+}
+
+// Error is a non-2xx response. Header is kept so rate-limit responses can be
+// waited out.
+type Error struct {
+	StatusCode int
+	Message    string
+	Header     http.Header
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("dns console: status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("dns console: status %d: %s", e.StatusCode, e.Message)
+}
+
+type Client struct {
+	http      *http.Client
+	url       string
+	token     string
+	userAgent string
+}
+
+// New returns a client for the API at baseURL, for example
+// https://dns.hetzner.com/api/v1, authenticating with an Auth-API-Token.
+func New(baseURL, token, userAgent string) *Client {
+	return &Client{
+		http:      &http.Client{},
+		url:       strings.TrimSuffix(baseURL, "/"),
+		token:     token,
+		userAgent: userAgent,
+	}
+}
+
+// ZoneByName returns the zone, or nil when the token has no zone of that name.
+func (c *Client) ZoneByName(ctx context.Context, name string) (*Zone, error) {
+	var resp struct {
+		Zones []Zone `json:"zones"`
+	}
+	err := c.do(ctx, http.MethodGet, "/zones?name="+url.QueryEscape(name), nil, &resp)
+	var apiErr *Error
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, zone := range resp.Zones {
+		if strings.EqualFold(zone.Name, name) {
+			return &zone, nil
+		}
+	}
+	return nil, nil
+}
+
+// Records lists all records of a zone.
+func (c *Client) Records(ctx context.Context, zoneID string) ([]Record, error) {
+	var records []Record
+	for page := 1; ; page++ {
+		var resp struct {
+			Records []Record `json:"records"`
+			Meta    struct {
+				Pagination struct {
+					LastPage int `json:"last_page"`
+				} `json:"pagination"`
+			} `json:"meta"`
+		}
+		path := fmt.Sprintf("/records?zone_id=%s&page=%d&per_page=%d", url.QueryEscape(zoneID), page, pageSize)
+		if err := c.do(ctx, http.MethodGet, path, nil, &resp); err != nil {
+			return nil, err
+		}
+		records = append(records, resp.Records...)
+		if page >= resp.Meta.Pagination.LastPage || len(resp.Records) == 0 {
+			return records, nil
+		}
+	}
+}
+
+func (c *Client) CreateRecord(ctx context.Context, record Record) (*Record, error) {
+	var resp struct {
+		Record Record `json:"record"`
+	}
+	record.ID = ""
+	if err := c.do(ctx, http.MethodPost, "/records", record, &resp); err != nil {
+		return nil, err
+	}
+	return &resp.Record, nil
+}
+
+func (c *Client) UpdateRecord(ctx context.Context, record Record) (*Record, error) {
+	var resp struct {
+		Record Record `json:"record"`
+	}
+	id := record.ID
+	record.ID = ""
+	if err := c.do(ctx, http.MethodPut, "/records/"+url.PathEscape(id), record, &resp); err != nil {
+		return nil, err
+	}
+	return &resp.Record, nil
+}
+
+func (c *Client) DeleteRecord(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/records/"+url.PathEscape(id), nil, nil)
+}
+
+func (c *Client) do(ctx context.Context, method, path string, body, out any) error {
+	var reader io.Reader
+	if body != nil {
+		raw, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("encode request: %w", err)
+		}
+		reader = bytes.NewReader(raw)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.url+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Auth-API-Token", c.token)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.userAgent != "" {
+		req.Header.Set("User-Agent", c.userAgent)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, 10<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return &Error{StatusCode: resp.StatusCode, Message: errorMessage(raw), Header: resp.Header}
+	}
+	if out == nil || len(raw) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(raw, out); err != nil {
+		return fmt.Errorf("decode response: %w", err)
+	}
+	return nil
+}
+
+// errorMessage pulls the message out of the API's error bodies, which come as
+// {"error":{"message":...}} or {"message":...}, and falls back to the raw body.
+func errorMessage(raw []byte) string {
+	var body struct {
+		Message string `json:"message"`
+		Error   struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(raw, &body) == nil {
+		if body.Error.Message != "" {
+			return body.Error.Message
+		}
+		if body.Message != "" {
+			return body.Message
+		}
+	}
+	text := strings.TrimSpace(string(raw))
+	if len(text) > 256 {
+		text = text[:256] + "..."
+	}
+	return text
+}
@@ -0,0 +1,207 @@
+package dnsconsole
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+const testToken = "console-token"
+
+// fakeConsole serves the zone and record endpoints of the DNS Console from
+// memory and logs every request as "METHOD path".
+type fakeConsole struct {
+	zones    []Zone
+	records  []Record
+	nextID   int
+	requests []string
+}
+
+func (f *fakeConsole) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.requests = append(f.requests, r.Method+" "+r.URL.Path)
+	if r.Header.Get("Auth-API-Token") != testToken {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, `{"message":"Invalid authentication credentials"}`)
+		return
+	}
+	id := r.PathValue("id")
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/zones":
+		var zones []Zone
+		for _, zone := range f.zones {
+			if zone.Name == r.URL.Query().Get("name") {
+				zones = append(zones, zone)
+			}
+		}
+		if len(zones) == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"error":{"message":"zone not found","code":404}}`)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"zones": zones})
+	case r.Method == http.MethodGet && r.URL.Path == "/records":
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		perPage, _ := strconv.Atoi(r.URL.Query().Get("per_page"))
+		var matching []Record
+		for _, record := range f.records {
+			if record.ZoneID == r.URL.Query().Get("zone_id") {
+				matching = append(matching, record)
+			}
+		}
+		start, end := min((page-1)*perPage, len(matching)), min(page*perPage, len(matching))
+		lastPage := max((len(matching)+perPage-1)/perPage, 1)
+		json.NewEncoder(w).Encode(map[string]any{
+			"records": matching[start:end],
+			"meta":    map[string]any{"pagination": map[string]any{"page": page, "per_page": perPage, "last_page": lastPage}},
+		})
+	case r.Method == http.MethodPost && r.URL.Path == "/records":
+		var record Record
+		json.NewDecoder(r.Body).Decode(&record)
+		f.nextID++
+		record.ID = "r" + strconv.Itoa(f.nextID)
+		f.records = append(f.records, record)
+		json.NewEncoder(w).Encode(map[string]any{"record": record})
+	case id != "" && (r.Method == http.MethodPut || r.Method == http.MethodDelete):
+		for i, record := range f.records {
+			if record.ID != id {
+				continue
+			}
+			if r.Method == http.MethodDelete {
+				f.records = append(f.records[:i], f.records[i+1:]...)
+				return
+			}
+			json.NewDecoder(r.Body).Decode(&record)
+			record.ID = id
+			f.records[i] = record
+			json.NewEncoder(w).Encode(map[string]any{"record": record})
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"error":{"message":"record not found","code":404}}`)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func newFakeConsole(t *testing.T, fake *fakeConsole) *Client {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.Handle("/records/{id}", fake)
+	mux.Handle("/", fake)
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return New(srv.URL+"/", testToken, "hetzner-ddns-test")
+}
+
+func TestZoneByName(t *testing.T) {
+	fake := &fakeConsole{zones: []Zone{{ID: "z1", Name: "example.com", TTL: 86400}}}
+	client := newFakeConsole(t, fake)
+
+	zone, err := client.ZoneByName(context.Background(), "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if zone == nil || zone.ID != "z1" || zone.TTL != 86400 {
+		t.Fatalf("zone = %+v", zone)
+	}
+	zone, err = client.ZoneByName(context.Background(), "example.org")
+	if err != nil || zone != nil {
+		t.Fatalf("unknown zone = %+v, %v; want nil, nil", zone, err)
+	}
+}
+
+func TestRecordsPaginates(t *testing.T) {
+	fake := &fakeConsole{}
+	for i := range pageSize + 5 {
+		fake.records = append(fake.records, Record{ID: strconv.Itoa(i), ZoneID: "z1", Type: "A", Name: "host" + strconv.Itoa(i), Value: "203.0.113.1"})
+	}
+	fake.records = append(fake.records, Record{ID: "other", ZoneID: "z2", Type: "A", Name: "www", Value: "203.0.113.9"})
+	client := newFakeConsole(t, fake)
+
+	records, err := client.Records(context.Background(), "z1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != pageSize+5 {
+		t.Errorf("got %d records, want %d", len(records), pageSize+5)
+	}
+	if len(fake.requests) != 2 {
+		t.Errorf("requests = %v, want two pages", fake.requests)
+	}
+}
+
+func TestRecordLifecycle(t *testing.T) {
+	fake := &fakeConsole{}
+	client := newFakeConsole(t, fake)
+	ctx := context.Background()
+	ttl := 60
+
+	created, err := client.CreateRecord(ctx, Record{ID: "ignored", ZoneID: "z1", Type: "A", Name: "www", Value: "203.0.113.1", TTL: &ttl})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.ID != "r1" || created.Value != "203.0.113.1" || created.TTL == nil || *created.TTL != 60 {
+		t.Fatalf("created = %+v", created)
+	}
+
+	created.Value = "203.0.113.2"
+	updated, err := client.UpdateRecord(ctx, *created)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.ID != "r1" || fake.records[0].Value != "203.0.113.2" {
+		t.Fatalf("updated = %+v, stored %+v", updated, fake.records[0])
+	}
+
+	if err := client.DeleteRecord(ctx, "r1"); err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.records) != 0 {
+		t.Fatalf("records left: %+v", fake.records)
+	}
+	want := []string{"POST /records", "PUT /records/r1", "DELETE /records/r1"}
+	if fmt.Sprint(fake.requests) != fmt.Sprint(want) {
+		t.Errorf("requests = %v, want %v", fake.requests, want)
+	}
+
+	err = client.DeleteRecord(ctx, "r1")
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound || apiErr.Message != "record not found" {
+		t.Errorf("deleting a missing record: %v", err)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "7")
+		w.WriteHeader(http.StatusTooManyRequests)
+		fmt.Fprint(w, "slow down")
+	}))
+	defer srv.Close()
+
+	_, err := New(srv.URL, testToken, "").Records(context.Background(), "z1")
+	var apiErr *Error
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("err = %v, want *Error", err)
+	}
+	if apiErr.StatusCode != http.StatusTooManyRequests || apiErr.Header.Get("Retry-After") != "7" || apiErr.Message != "slow down" {
+		t.Errorf("err = %+v", apiErr)
+	}
+
+	_, err = New(srv.URL, "wrong", "").ZoneByName(context.Background(), "example.com")
+	if err == nil {
+		t.Error("rate-limited zone lookup reported no error")
+	}
+
+	client := newFakeConsole(t, &fakeConsole{})
+	client.token = "wrong"
+	_, err = client.ZoneByName(context.Background(), "example.com")
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized || apiErr.Message != "Invalid authentication credentials" {
+		t.Errorf("unauthorized: %v", err)
+	}
+}
@@ -0,0 +1,114 @@
+package ip
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var ErrNoConsensus = errors.New("ip providers disagree")
+
+type ConsensusError struct {
+	Quorum   int
+	Votes    map[string][]string
+	Failures map[string]error
+}
+
+func (e *ConsensusError) Error() string {
+	addrs := make([]string, 0, len(e.Votes))
+	for addr := range e.Votes {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+	parts := make([]string, 0, len(addrs))
+	for _, addr := range addrs {
+		parts = append(parts, fmt.Sprintf("%s=%d", addr, len(e.Votes[addr])))
+	}
+	return fmt.Sprintf("%v: no single address reached quorum %d (%s, %d failed)", ErrNoConsensus, e.Quorum, strings.Join(parts, ", "), len(e.Failures))
+}
+
+func (e *ConsensusError) Unwrap() error {
+	return ErrNoConsensus
+}
+
+type answer struct {
+	url  string
+	addr net.IP
+	err  error
+}
+
+func (f *Fetcher) FetchConsensus(ctx context.Context, urls []string, quorum int) (net.IP, error) {
+	if len(urls) == 0 {
+		return nil, fmt.Errorf("no ip providers configured")
+	}
+	if len(urls) == 1 {
+		return f.Fetch(ctx, urls[0])
+	}
+	if quorum <= 0 {
+		quorum = 1
+	}
+
+	answers := make([]answer, len(urls))
+	var wg sync.WaitGroup
+	for i, url := range urls {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			addr, err := f.Fetch(ctx, url)
+			answers[i] = answer{url: url, addr: addr, err: err}
+		}()
+	}
+	wg.Wait()
+
+	votes := make(map[string][]string)
+	failures := make(map[string]error)
+	addrs := make(map[string]net.IP)
+	for _, a := range answers {
+		if a.err != nil {
+			failures[a.url] = a.err
+			continue
+		}
+		key := a.addr.String()
+		votes[key] = append(votes[key], a.url)
+		addrs[key] = a.addr
+	}
+	var winners []string
+	for key, urls := range votes {
+		if len(urls) >= quorum {
+			winners = append(winners, key)
+		}
+	}
+	// Two addresses can both reach a quorum below a majority; neither is
+	// trusted then.
+	if len(winners) == 1 {
+		return addrs[winners[0]], nil
+	}
+	if len(votes) > 1 {
+		return nil, &ConsensusError{Quorum: quorum, Votes: votes, Failures: failures}
+	}
+
+	answered := len(urls) - len(failures)
+	allUnreachable := answered == 0
+	for _, err := range failures {
+		allUnreachable = allUnreachable && errors.Is(err, ErrUnreachable)
+	}
+	errs := make([]error, 0, len(failures))
+	for _, url := range urls {
+		err, ok := failures[url]
+		if !ok {
+			continue
+		}
+		if errors.Is(err, ErrUnreachable) && !allUnreachable {
+			// The source is unreachable only when every provider is; a
+			// single one says nothing about the uplink.
+			errs = append(errs, fmt.Errorf("%s: %v", url, err))
+			continue
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", url, err))
+	}
+	return nil, fmt.Errorf("only %d of %d providers answered, quorum is %d: %w", answered, len(urls), quorum, errors.Join(errs...))
+}
@@ -0,0 +1,141 @@
+package ip
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func provider(t *testing.T, body string) string {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body + "\n"))
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func TestFetchConsensusMajority(t *testing.T) {
+	f := NewFetcher(time.Second, "test")
+	urls := []string{provider(t, "1.2.3.4"), provider(t, "5.6.7.8"), provider(t, "1.2.3.4")}
+	addr, err := f.FetchConsensus(context.Background(), urls, 2)
+	if err != nil {
+		t.Fatalf("FetchConsensus: %v", err)
+	}
+	if addr.String() != "1.2.3.4" {
+		t.Fatalf("got %s, want 1.2.3.4", addr)
+	}
+}
+
+func TestFetchConsensusTwoAddressesReachQuorum(t *testing.T) {
+	f := NewFetcher(time.Second, "test")
+	urls := []string{provider(t, "1.2.3.4"), provider(t, "1.2.3.4"), provider(t, "5.6.7.8"), provider(t, "5.6.7.8")}
+	_, err := f.FetchConsensus(context.Background(), urls, 2)
+	var consensusErr *ConsensusError
+	if !errors.As(err, &consensusErr) {
+		t.Fatalf("got %v, want ConsensusError", err)
+	}
+	if !errors.Is(err, ErrNoConsensus) {
+		t.Fatalf("error does not wrap ErrNoConsensus: %v", err)
+	}
+}
+
+// deadUplink makes every connection attempt of the default transport, which
+// the fetcher uses, fail with err until the test ends.
+func deadUplink(t *testing.T, err error) {
+	t.Helper()
+	transport := http.DefaultTransport
+	http.DefaultTransport = &http.Transport{DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return nil, &net.OpError{Op: "dial", Net: network, Err: err}
+	}}
+	t.Cleanup(func() { http.DefaultTransport = transport })
+}
+
+func failing(t *testing.T, status int) string {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func TestFetchConsensusUnreachable(t *testing.T) {
+	tests := []struct {
+		name        string
+		dialErr     error
+		urls        []string
+		unreachable bool
+	}{
+		{"single provider", os.NewSyscallError("connect", syscall.ENETUNREACH), []string{"https://api6.example"}, true},
+		{"all providers", os.NewSyscallError("connect", syscall.EHOSTUNREACH), []string{"https://a.example", "https://b.example"}, true},
+		{"connect timeout", os.ErrDeadlineExceeded, []string{"https://api6.example"}, true},
+		{"connection refused", os.NewSyscallError("connect", syscall.ECONNREFUSED), []string{"https://api6.example"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			deadUplink(t, tt.dialErr)
+			_, err := NewFetcher(time.Second, "test").FetchConsensus(context.Background(), tt.urls, len(tt.urls)/2+1)
+			if err == nil {
+				t.Fatal("fetch succeeded")
+			}
+			if got := errors.Is(err, ErrUnreachable); got != tt.unreachable {
+				t.Fatalf("unreachable = %v, want %v: %v", got, tt.unreachable, err)
+			}
+		})
+	}
+}
+
+func TestFetchConsensusOneUnreachableProvider(t *testing.T) {
+	urls := []string{failing(t, http.StatusInternalServerError), failing(t, http.StatusInternalServerError)}
+	// Reach the test servers, but not the third provider.
+	transport := http.DefaultTransport
+	var dialer net.Dialer
+	http.DefaultTransport = &http.Transport{DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if strings.HasPrefix(addr, "127.0.0.1:") {
+			return dialer.DialContext(ctx, network, addr)
+		}
+		return nil, &net.OpError{Op: "dial", Net: network, Err: os.NewSyscallError("connect", syscall.ENETUNREACH)}
+	}}
+	defer func() { http.DefaultTransport = transport }()
+
+	_, err := NewFetcher(time.Second, "test").FetchConsensus(context.Background(), append(urls, "https://api6.example"), 2)
+	if err == nil || errors.Is(err, ErrUnreachable) {
+		t.Fatalf("got %v, want a failure that is not unreachable", err)
+	}
+	if !strings.Contains(err.Error(), "network is unreachable") {
+		t.Errorf("error %q does not name the unreachable provider", err)
+	}
+}
+
+func TestUnreachable(t *testing.T) {
+	dial := func(err error) error {
+		return &url.Error{Op: "Get", URL: "https://api6.ipify.org", Err: &net.OpError{Op: "dial", Net: "tcp6", Err: err}}
+	}
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"network unreachable", dial(os.NewSyscallError("connect", syscall.ENETUNREACH)), true},
+		{"host unreachable", dial(os.NewSyscallError("connect", syscall.EHOSTUNREACH)), true},
+		{"no source address", dial(os.NewSyscallError("connect", syscall.EADDRNOTAVAIL)), true},
+		{"dial timeout", dial(os.ErrDeadlineExceeded), true},
+		{"connection refused", dial(os.NewSyscallError("connect", syscall.ECONNREFUSED)), false},
+		{"read timeout", &url.Error{Op: "Get", URL: "https://api6.ipify.org", Err: &net.OpError{Op: "read", Net: "tcp6", Err: os.ErrDeadlineExceeded}}, false},
+		{"dns", &url.Error{Op: "Get", URL: "https://api6.ipify.org", Err: &net.DNSError{Err: "no such host", Name: "api6.ipify.org", IsNotFound: true}}, false},
+	}
+	for _, tt := range tests {
+		if got := unreachable(tt.err); got != tt.want {
+			t.Errorf("%s: unreachable = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
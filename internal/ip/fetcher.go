@@ -2,14 +2,20 @@ package ip
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
 	"strings"
+	"syscall"
 	"time"
 )
 
+// ErrUnreachable is returned when a provider could not be connected to at
+// all, as happens for a provider of one family while that uplink is down.
+var ErrUnreachable = errors.New("ip provider unreachable")
+
 type Fetcher struct {
 	client *http.Client
 	ua     string
@@ -36,6 +42,9 @@ func (f *Fetcher) Fetch(ctx context.Context, url string) (net.IP, error) {
 
 	resp, err := f.client.Do(req)
 	if err != nil {
+		if unreachable(err) {
+			return nil, fmt.Errorf("%w: %w", ErrUnreachable, err)
+		}
 		return nil, fmt.Errorf("request failed: %w", err)
 	}
 	defer resp.Body.Close()
@@ -56,3 +65,17 @@ func (f *Fetcher) Fetch(ctx context.Context, url string) (net.IP, error) {
 	}
 	return ip, nil
 }
+
+// unreachable reports whether a request failed while connecting because there
+// is no route to the provider or the connection attempt timed out. Refused
+// connections, DNS and HTTP errors come from a reachable network.
+func unreachable(err error) bool {
+	var opErr *net.OpError
+	if !errors.As(err, &opErr) || opErr.Op != "dial" {
+		return false
+	}
+	return opErr.Timeout() ||
+		errors.Is(opErr.Err, syscall.ENETUNREACH) ||
+		errors.Is(opErr.Err, syscall.EHOSTUNREACH) ||
+		errors.Is(opErr.Err, syscall.EADDRNOTAVAIL)
+}
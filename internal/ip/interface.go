@@ -0,0 +1,100 @@
+package ip
+
+import (
+	"context"
+	"fmt"
+	"net"
+)
+
+const (
+	ifaFlagTemporary  = 0x01
+	ifaFlagDadFailed  = 0x08
+	ifaFlagDeprecated = 0x20
+	ifaFlagTentative  = 0x40
+)
+
+type InterfaceFilter struct {
+	GlobalOnly        bool
+	ExcludeTemporary  bool
+	ExcludeDeprecated bool
+	ExcludeULA        bool
+}
+
+type InterfaceSource struct {
+	name   string
+	family Family
+	filter InterfaceFilter
+}
+
+func NewInterfaceSource(name string, family Family, filter InterfaceFilter) *InterfaceSource {
+	return &InterfaceSource{
+		name:   name,
+		family: family,
+		filter: filter,
+	}
+}
+
+func (s *InterfaceSource) Key() string {
+	return fmt.Sprintf("interface:%s/%s#%+v", s.name, s.family, s.filter)
+}
+
+func (s *InterfaceSource) Fetch(ctx context.Context) (net.IP, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	iface, err := net.InterfaceByName(s.name)
+	if err != nil {
+		return nil, fmt.Errorf("lookup interface %s: %w", s.name, err)
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, fmt.Errorf("list addresses of %s: %w", s.name, err)
+	}
+
+	var flags map[string]uint32
+	if s.family == IPv6 {
+		flags = ipv6AddrFlags(s.name)
+	}
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		candidate := ipNet.IP
+		if !s.family.Matches(candidate) {
+			continue
+		}
+		if !s.accept(candidate, flags[candidate.String()]) {
+			continue
+		}
+		if s.family == IPv4 {
+			return candidate.To4(), nil
+		}
+		return candidate, nil
+	}
+	return nil, fmt.Errorf("interface %s: %w for %s", s.name, ErrNoAddress, s.family)
+}
+
+func (s *InterfaceSource) accept(addr net.IP, flags uint32) bool {
+	if flags&(ifaFlagTentative|ifaFlagDadFailed) != 0 {
+		return false
+	}
+	if s.filter.GlobalOnly {
+		if !addr.IsGlobalUnicast() {
+			return false
+		}
+		if addr.To4() != nil && addr.IsPrivate() {
+			return false
+		}
+	}
+	if s.filter.ExcludeULA && addr.To4() == nil && addr.IsPrivate() {
+		return false
+	}
+	if s.filter.ExcludeTemporary && flags&ifaFlagTemporary != 0 {
+		return false
+	}
+	if s.filter.ExcludeDeprecated && flags&ifaFlagDeprecated != 0 {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,39 @@
+package ip
+
+import (
+	"bufio"
+	"encoding/hex"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ipv6AddrFlags reads the kernel address flags, which the net package does not
+// expose, from /proc/net/if_inet6.
+func ipv6AddrFlags(ifname string) map[string]uint32 {
+	f, err := os.Open("/proc/net/if_inet6")
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	out := make(map[string]uint32)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 6 || fields[5] != ifname {
+			continue
+		}
+		raw, err := hex.DecodeString(fields[0])
+		if err != nil || len(raw) != net.IPv6len {
+			continue
+		}
+		flags, err := strconv.ParseUint(fields[4], 16, 32)
+		if err != nil {
+			continue
+		}
+		out[net.IP(raw).String()] = uint32(flags)
+	}
+	return out
+}
@@ -0,0 +1,7 @@
+//go:build !linux
+
+package ip
+
+func ipv6AddrFlags(string) map[string]uint32 {
+	return nil
+}
@@ -0,0 +1,26 @@
+package ip
+
+import (
+	"fmt"
+	"net"
+)
+
+func CombinePrefix(prefix net.IP, suffix net.IP, prefixLen int) (net.IP, error) {
+	p := prefix.To16()
+	sfx := suffix.To16()
+	if p == nil || prefix.To4() != nil {
+		return nil, fmt.Errorf("prefix %s is not an IPv6 address", prefix)
+	}
+	if sfx == nil || suffix.To4() != nil {
+		return nil, fmt.Errorf("suffix %s is not an IPv6 address", suffix)
+	}
+	if prefixLen < 0 || prefixLen > 128 {
+		return nil, fmt.Errorf("prefix length %d out of range", prefixLen)
+	}
+	mask := net.CIDRMask(prefixLen, 128)
+	out := make(net.IP, net.IPv6len)
+	for i := range out {
+		out[i] = p[i]&mask[i] | sfx[i]&^mask[i]
+	}
+	return out, nil
+}
@@ -0,0 +1,88 @@
+package ip
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+var ErrNoAddress = errors.New("no address available")
+
+type Family int
+
+const (
+	IPv4 Family = 4
+	IPv6 Family = 6
+)
+
+func (f Family) String() string {
+	switch f {
+	case IPv4:
+		return "ipv4"
+	case IPv6:
+		return "ipv6"
+	default:
+		return fmt.Sprintf("family(%d)", int(f))
+	}
+}
+
+func (f Family) Matches(addr net.IP) bool {
+	isV4 := addr.To4() != nil
+	if f == IPv4 {
+		return isV4
+	}
+	return !isV4 && addr.To16() != nil
+}
+
+type Source interface {
+	Key() string
+	Fetch(ctx context.Context) (net.IP, error)
+}
+
+// Factory builds the sources a zone or firewall observes its address from.
+type Factory interface {
+	Providers(urls []string, quorum int) Source
+	Interface(name string, family Family, filter InterfaceFilter) Source
+}
+
+// NewFactory returns a Factory whose provider sources share one Fetcher.
+func NewFactory(timeout time.Duration, userAgent string) Factory {
+	return &factory{fetcher: NewFetcher(timeout, userAgent)}
+}
+
+type factory struct {
+	fetcher *Fetcher
+}
+
+func (f *factory) Providers(urls []string, quorum int) Source {
+	return NewProviderSource(f.fetcher, urls, quorum)
+}
+
+func (f *factory) Interface(name string, family Family, filter InterfaceFilter) Source {
+	return NewInterfaceSource(name, family, filter)
+}
+
+type ProviderSource struct {
+	fetcher *Fetcher
+	urls    []string
+	quorum  int
+}
+
+func NewProviderSource(fetcher *Fetcher, urls []string, quorum int) *ProviderSource {
+	return &ProviderSource{
+		fetcher: fetcher,
+		urls:    urls,
+		quorum:  quorum,
+	}
+}
+
+func (s *ProviderSource) Key() string {
+	return fmt.Sprintf("providers:%s#%d", strings.Join(s.urls, ","), s.quorum)
+}
+
+func (s *ProviderSource) Fetch(ctx context.Context) (net.IP, error) {
+	return s.fetcher.FetchConsensus(ctx, s.urls, s.quorum)
+}
@@ -1,20 +1,20 @@
 package logging
 
 import (
+	"io"
 	"log/slog"
-	"os"
 	"strings"
 )
 
-func New(level slog.Level, format string) *slog.Logger {
+func New(w io.Writer, level slog.Level, format string) *slog.Logger {
 	format = strings.ToLower(strings.TrimSpace(format))
 	switch format {
 	case "json":
-		return slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
+		return slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{
 			Level: level,
 		}))
 	default:
-		return slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+		return slog.New(slog.NewTextHandler(w, &slog.HandlerOptions{
 			Level: level,
 		}))
 	}
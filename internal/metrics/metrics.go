@@ -0,0 +1,246 @@
+package metrics
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "ddns"
+
+const (
+	PhaseIPFetch     = "ip_fetch"
+	PhaseIPConsensus = "ip_consensus"
+	PhaseIPPrefix    = "ip_prefix"
+	PhaseZoneLookup  = "zone_lookup"
+	PhaseRRSetGet    = "rrset_get"
+	PhaseRRSetCreate = "rrset_create"
+	PhaseRRSetSet    = "rrset_set"
+	PhaseRRSetAdd    = "rrset_add"
+	PhaseRRSetRemove = "rrset_remove"
+	PhaseRRSetDelete = "rrset_delete"
+	PhaseTTLChange   = "ttl_change"
+	PhaseOwnership   = "ownership"
+	PhaseCircuitOpen = "circuit_open"
+	PhaseHook        = "hook"
+	PhaseFirewallGet = "firewall_get"
+	PhaseFirewallSet = "firewall_set"
+	PhasePTRLookup   = "ptr_lookup"
+	PhasePTRSet      = "ptr_set"
+	PhasePTRVerify   = "ptr_verify"
+)
+
+type Metrics struct {
+	registry *prometheus.Registry
+
+	syncRuns      *prometheus.CounterVec
+	syncErrors    *prometheus.CounterVec
+	retries       *prometheus.CounterVec
+	apiFailures   *prometheus.CounterVec
+	lastSuccess   prometheus.Gauge
+	lastRun       prometheus.Gauge
+	syncDuration  prometheus.Histogram
+	publishedIP   *prometheus.GaugeVec
+	ipChanges     *prometheus.CounterVec
+	recordChanges *prometheus.CounterVec
+	circuitState  *prometheus.GaugeVec
+	notifications *prometheus.CounterVec
+	firewallRules *prometheus.CounterVec
+	ptrMismatch   *prometheus.GaugeVec
+	dyndnsUpdates *prometheus.CounterVec
+
+	mu        sync.Mutex
+	published map[[2]string]string
+}
+
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		syncRuns: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "sync_runs_total",
+			Help:      "Sync runs by result.",
+		}, []string{"result"}),
+		syncErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "sync_errors_total",
+			Help:      "Sync errors by zone, record and phase.",
+		}, []string{"zone", "record", "phase"}),
+		retries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "retry_attempts_total",
+			Help:      "Retried API operations by operation and error class.",
+		}, []string{"op", "class"}),
+		apiFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "api_failures_total",
+			Help:      "API operations that failed without further retries, by operation and error class.",
+		}, []string{"op", "class"}),
+		lastSuccess: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "last_successful_sync_timestamp_seconds",
+			Help:      "Unix time of the last sync run without errors.",
+		}),
+		lastRun: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "last_sync_timestamp_seconds",
+			Help:      "Unix time of the last sync run.",
+		}),
+		syncDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "sync_duration_seconds",
+			Help:      "Duration of sync runs.",
+			Buckets:   prometheus.ExponentialBuckets(0.1, 2, 10),
+		}),
+		publishedIP: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "published_ip_info",
+			Help:      "Currently published address per zone and record type (value is always 1).",
+		}, []string{"zone", "record_type", "ip"}),
+		ipChanges: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "ip_changes_total",
+			Help:      "Observed public IP changes per zone and record type.",
+		}, []string{"zone", "record_type"}),
+		recordChanges: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "record_changes_total",
+			Help:      "DNS changes applied by action.",
+		}, []string{"zone", "action"}),
+		circuitState: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "api_circuit_state",
+			Help:      "State of the API circuit breaker (1 for the current state).",
+		}, []string{"state"}),
+		notifications: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "notifications_total",
+			Help:      "Notifications by event and result.",
+		}, []string{"event", "result"}),
+		firewallRules: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "firewall_rule_changes_total",
+			Help:      "Firewall rules rewritten with a new address.",
+		}, []string{"firewall"}),
+		ptrMismatch: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "reverse_dns_mismatch",
+			Help:      "1 while the PTR of a record's address does not point back at the record.",
+		}, []string{"zone", "record", "record_type"}),
+		dyndnsUpdates: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "dyndns_updates_total",
+			Help:      "Hostnames in DynDNS2 update requests by response code.",
+		}, []string{"result"}),
+		published: make(map[[2]string]string),
+	}
+	m.registry.MustRegister(
+		m.syncRuns,
+		m.syncErrors,
+		m.retries,
+		m.apiFailures,
+		m.lastSuccess,
+		m.lastRun,
+		m.syncDuration,
+		m.publishedIP,
+		m.ipChanges,
+		m.recordChanges,
+		m.circuitState,
+		m.notifications,
+		m.firewallRules,
+		m.ptrMismatch,
+		m.dyndnsUpdates,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	m.CircuitState("closed")
+	return m
+}
+
+func (m *Metrics) Registry() *prometheus.Registry {
+	return m.registry
+}
+
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+}
+
+func (m *Metrics) SyncFinished(start time.Time, err error) {
+	now := time.Now()
+	m.lastRun.Set(float64(now.Unix()))
+	m.syncDuration.Observe(now.Sub(start).Seconds())
+	if err != nil {
+		m.syncRuns.WithLabelValues("failure").Inc()
+		return
+	}
+	m.syncRuns.WithLabelValues("success").Inc()
+	m.lastSuccess.Set(float64(now.Unix()))
+}
+
+func (m *Metrics) SyncError(zone, record, phase string) {
+	m.syncErrors.WithLabelValues(zone, record, phase).Inc()
+}
+
+func (m *Metrics) Retry(op, class string) {
+	m.retries.WithLabelValues(op, class).Inc()
+}
+
+func (m *Metrics) APIFailure(op, class string) {
+	m.apiFailures.WithLabelValues(op, class).Inc()
+}
+
+func (m *Metrics) IPChanged(zone, recordType string) {
+	m.ipChanges.WithLabelValues(zone, recordType).Inc()
+}
+
+func (m *Metrics) RecordChanged(zone, action string) {
+	m.recordChanges.WithLabelValues(zone, action).Inc()
+}
+
+func (m *Metrics) Notification(event, result string) {
+	m.notifications.WithLabelValues(event, result).Inc()
+}
+
+func (m *Metrics) FirewallRuleChanged(firewall string) {
+	m.firewallRules.WithLabelValues(firewall).Inc()
+}
+
+func (m *Metrics) ReverseMismatch(zone, record, recordType string, mismatch bool) {
+	value := 0.0
+	if mismatch {
+		value = 1
+	}
+	m.ptrMismatch.WithLabelValues(zone, record, recordType).Set(value)
+}
+
+func (m *Metrics) DynDNSUpdate(result string) {
+	m.dyndnsUpdates.WithLabelValues(result).Inc()
+}
+
+func (m *Metrics) Published(zone, recordType, ip string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := [2]string{zone, recordType}
+	if previous, ok := m.published[key]; ok {
+		if previous == ip {
+			return
+		}
+		m.publishedIP.DeleteLabelValues(zone, recordType, previous)
+	}
+	m.published[key] = ip
+	m.publishedIP.WithLabelValues(zone, recordType, ip).Set(1)
+}
+
+func (m *Metrics) CircuitState(state string) {
+	for _, s := range []string{"closed", "open", "half-open"} {
+		value := 0.0
+		if s == state {
+			value = 1
+		}
+		m.circuitState.WithLabelValues(s).Set(value)
+	}
+}
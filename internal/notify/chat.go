@@ -0,0 +1,103 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+
+	"hetzner-ddns/internal/config"
+)
+
+const defaultTemplate = "{{.Message}}"
+
+const messageTitle = "hetzner-ddns"
+
+// chat renders an event with the service's template and posts it in the
+// format the service expects.
+type chat struct {
+	client    *http.Client
+	cfg       config.ChatConfig
+	tmpl      *template.Template
+	userAgent string
+}
+
+func newChat(cfg config.ChatConfig, userAgent string) (*chat, error) {
+	text := cfg.Template
+	if strings.TrimSpace(text) == "" {
+		text = defaultTemplate
+	}
+	tmpl, err := template.New(cfg.Service).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("%s template: %w", cfg.Service, err)
+	}
+	return &chat{client: &http.Client{}, cfg: cfg, tmpl: tmpl, userAgent: userAgent}, nil
+}
+
+func (c *chat) Send(ctx context.Context, event Event) error {
+	var text strings.Builder
+	if err := c.tmpl.Execute(&text, event); err != nil {
+		return &permanentError{err: fmt.Errorf("render template: %w", err)}
+	}
+	req, err := c.request(ctx, event, strings.TrimSpace(text.String()))
+	if err != nil {
+		return &permanentError{err: err}
+	}
+	req.Header.Set("User-Agent", c.userAgent)
+	return doRequest(c.client, req)
+}
+
+func (c *chat) request(ctx context.Context, event Event, text string) (*http.Request, error) {
+	switch c.cfg.Service {
+	case config.ChatNtfy:
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.cfg.URL+"/"+url.PathEscape(c.cfg.Channel), strings.NewReader(text))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Title", messageTitle)
+		req.Header.Set("Tags", event.Type)
+		if event.failure() {
+			req.Header.Set("Priority", "high")
+		}
+		if c.cfg.Token != "" {
+			req.Header.Set("Authorization", "Bearer "+c.cfg.Token)
+		}
+		return req, nil
+	case config.ChatGotify:
+		priority := 5
+		if event.failure() {
+			priority = 8
+		}
+		req, err := jsonRequest(ctx, c.cfg.URL+"/message", map[string]any{"title": messageTitle, "message": text, "priority": priority})
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("X-Gotify-Key", c.cfg.Token)
+		return req, nil
+	case config.ChatSlack, config.ChatMattermost:
+		return jsonRequest(ctx, c.cfg.URL, map[string]any{"text": text})
+	case config.ChatTelegram:
+		return jsonRequest(ctx, c.cfg.URL+"/bot"+c.cfg.Token+"/sendMessage", map[string]any{"chat_id": c.cfg.Channel, "text": text, "disable_web_page_preview": true})
+	case config.ChatDiscord:
+		return jsonRequest(ctx, c.cfg.URL, map[string]any{"content": text})
+	default:
+		return nil, fmt.Errorf("unsupported chat service %q", c.cfg.Service)
+	}
+}
+
+func jsonRequest(ctx context.Context, target string, payload any) (*http.Request, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("encode payload: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return req, nil
+}
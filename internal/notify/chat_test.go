@@ -0,0 +1,147 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"hetzner-ddns/internal/config"
+)
+
+type capturedRequest struct {
+	path    string
+	headers http.Header
+	body    string
+}
+
+func captureServer(t *testing.T) (*httptest.Server, <-chan capturedRequest) {
+	t.Helper()
+	requests := make(chan capturedRequest, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- capturedRequest{path: r.URL.Path, headers: r.Header.Clone(), body: string(body)}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, requests
+}
+
+func TestChatSend(t *testing.T) {
+	failed := Event{Type: EventRecordFailed, Zone: "example.com", Record: "www", RecordType: "A", Phase: "rrset_update", Error: "boom"}
+	const message = "www.example.com A update failed (rrset_update): boom"
+	tests := []struct {
+		name     string
+		cfg      config.ChatConfig
+		path     string
+		headers  map[string]string
+		body     string
+		jsonBody bool
+	}{
+		{
+			name:    "ntfy",
+			cfg:     config.ChatConfig{Service: config.ChatNtfy, Channel: "home dns", Token: "tk"},
+			path:    "/home dns",
+			headers: map[string]string{"Title": messageTitle, "Tags": EventRecordFailed, "Priority": "high", "Authorization": "Bearer tk"},
+			body:    message,
+		},
+		{
+			name:     "gotify",
+			cfg:      config.ChatConfig{Service: config.ChatGotify, Token: "app-token"},
+			path:     "/message",
+			headers:  map[string]string{"X-Gotify-Key": "app-token", "Content-Type": "application/json"},
+			body:     `{"message":"` + message + `","priority":8,"title":"hetzner-ddns"}`,
+			jsonBody: true,
+		},
+		{
+			name:     "slack",
+			cfg:      config.ChatConfig{Service: config.ChatSlack},
+			path:     "/",
+			headers:  map[string]string{"Content-Type": "application/json"},
+			body:     `{"text":"` + message + `"}`,
+			jsonBody: true,
+		},
+		{
+			name:     "mattermost",
+			cfg:      config.ChatConfig{Service: config.ChatMattermost, Template: "{{.Type}} {{.FQDN}}"},
+			path:     "/",
+			headers:  map[string]string{"Content-Type": "application/json"},
+			body:     `{"text":"record_failed www.example.com"}`,
+			jsonBody: true,
+		},
+		{
+			name:     "telegram",
+			cfg:      config.ChatConfig{Service: config.ChatTelegram, Token: "123:abc", Channel: "-10042"},
+			path:     "/bot123:abc/sendMessage",
+			headers:  map[string]string{"Content-Type": "application/json"},
+			body:     `{"chat_id":"-10042","disable_web_page_preview":true,"text":"` + message + `"}`,
+			jsonBody: true,
+		},
+		{
+			name:     "discord",
+			cfg:      config.ChatConfig{Service: config.ChatDiscord},
+			path:     "/",
+			headers:  map[string]string{"Content-Type": "application/json"},
+			body:     `{"content":"` + message + `"}`,
+			jsonBody: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, requests := captureServer(t)
+			tt.cfg.URL = srv.URL
+			c, err := newChat(tt.cfg, "hetzner-ddns-test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := c.Send(context.Background(), failed); err != nil {
+				t.Fatal(err)
+			}
+			req := <-requests
+			if req.path != tt.path {
+				t.Errorf("path = %q, want %q", req.path, tt.path)
+			}
+			tt.headers["User-Agent"] = "hetzner-ddns-test"
+			for name, want := range tt.headers {
+				if got := req.headers.Get(name); got != want {
+					t.Errorf("%s = %q, want %q", name, got, want)
+				}
+			}
+			body := req.body
+			if tt.jsonBody {
+				var payload map[string]any
+				if err := json.Unmarshal([]byte(body), &payload); err != nil {
+					t.Fatalf("body %s: %v", body, err)
+				}
+				body = mustJSON(t, payload)
+			}
+			if body != tt.body {
+				t.Errorf("body = %s, want %s", body, tt.body)
+			}
+		})
+	}
+}
+
+func TestChatTemplateError(t *testing.T) {
+	srv, requests := captureServer(t)
+	c, err := newChat(config.ChatConfig{Service: config.ChatSlack, URL: srv.URL, Template: "{{.Missing}}"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.Send(context.Background(), Event{Type: EventTest})
+	var permErr *permanentError
+	if !errors.As(err, &permErr) {
+		t.Fatalf("err = %v, want permanent template error", err)
+	}
+	select {
+	case req := <-requests:
+		t.Errorf("request sent despite template error: %+v", req)
+	default:
+	}
+
+	if _, err := newChat(config.ChatConfig{Service: config.ChatSlack, Template: "{{.Message"}, ""); err == nil {
+		t.Error("unparsable template accepted")
+	}
+}
@@ -0,0 +1,250 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"hetzner-ddns/internal/config"
+	"hetzner-ddns/internal/metrics"
+)
+
+const (
+	EventIPChanged     = "ip_changed"
+	EventRecordCreated = "record_created"
+	EventRecordUpdated = "record_updated"
+	EventRecordFailed  = "record_failed"
+	EventSyncRecovered = "sync_recovered"
+	EventTest          = "test"
+)
+
+// Events are queued and delivered in order by a single goroutine so that a
+// slow endpoint never holds up a sync run. When the queue is full new events
+// are dropped.
+const queueSize = 64
+
+const retryDelay = time.Second
+
+type Event struct {
+	Type       string     `json:"event"`
+	Time       time.Time  `json:"time"`
+	Zone       string     `json:"zone,omitempty"`
+	Record     string     `json:"record,omitempty"`
+	RecordType string     `json:"record_type,omitempty"`
+	OldIP      string     `json:"old_ip,omitempty"`
+	NewIP      string     `json:"new_ip,omitempty"`
+	OldValues  []string   `json:"old_values,omitempty"`
+	Phase      string     `json:"phase,omitempty"`
+	Error      string     `json:"error,omitempty"`
+	Since      *time.Time `json:"since,omitempty"`
+}
+
+// FQDN is the full name of the event's record, or the zone for zone-wide
+// events.
+func (e Event) FQDN() string {
+	if e.Record == "" || e.Record == "@" {
+		return e.Zone
+	}
+	return e.Record + "." + e.Zone
+}
+
+// Message is a one-line, human readable summary of the event and the default
+// text of chat notifications.
+func (e Event) Message() string {
+	switch e.Type {
+	case EventIPChanged:
+		return fmt.Sprintf("%s: public %s address changed %s → %s", e.Zone, e.RecordType, e.OldIP, e.NewIP)
+	case EventRecordCreated:
+		return fmt.Sprintf("%s %s created: %s", e.FQDN(), e.RecordType, e.NewIP)
+	case EventRecordUpdated:
+		return fmt.Sprintf("%s %s updated: %s → %s", e.FQDN(), e.RecordType, strings.Join(e.OldValues, ", "), e.NewIP)
+	case EventRecordFailed:
+		return fmt.Sprintf("%s %s update failed (%s): %s", e.FQDN(), e.RecordType, e.Phase, e.Error)
+	case EventSyncRecovered:
+		if e.Since != nil {
+			return fmt.Sprintf("Sync recovered after failing since %s", e.Since.Format(time.RFC3339))
+		}
+		return "Sync recovered"
+	case EventTest:
+		return "Test notification from hetzner-ddns"
+	default:
+		return e.Type
+	}
+}
+
+// failure reports whether the event is bad news, for services that can
+// highlight those.
+func (e Event) failure() bool {
+	return e.Type == EventRecordFailed
+}
+
+// Sender delivers an event to one endpoint.
+type Sender interface {
+	Send(ctx context.Context, event Event) error
+}
+
+// permanentError marks a delivery failure that retrying will not fix, such as
+// a 4xx response.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+type target struct {
+	name   string
+	sender Sender
+	filter config.NotifyFilter
+}
+
+// wants applies the target's filter. Events without a zone, such as
+// sync_recovered, pass any zone filter.
+func (t target) wants(event Event) bool {
+	if event.Type == EventTest {
+		return true
+	}
+	if len(t.filter.Events) > 0 && !slices.Contains(t.filter.Events, event.Type) {
+		return false
+	}
+	return event.Zone == "" || len(t.filter.Zones) == 0 || slices.Contains(t.filter.Zones, event.Zone)
+}
+
+type Notifier struct {
+	targets  []target
+	attempts int
+	timeout  time.Duration
+	metrics  *metrics.Metrics
+	logger   *slog.Logger
+
+	queue chan Event
+	done  chan struct{}
+}
+
+// New returns a notifier for the configured targets, or nil when there are
+// none. All methods are safe to call on a nil notifier.
+func New(cfg config.Config, m *metrics.Metrics, logger *slog.Logger) (*Notifier, error) {
+	var targets []target
+	for _, webhook := range cfg.Webhooks {
+		targets = append(targets, target{
+			name:   "webhook " + redactURL(webhook.URL),
+			sender: newWebhook(webhook, cfg.UserAgent),
+			filter: webhook.Filter,
+		})
+	}
+	for _, chat := range cfg.Chats {
+		sender, err := newChat(chat, cfg.UserAgent)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, target{name: chat.Service, sender: sender, filter: chat.Filter})
+	}
+	if len(targets) == 0 {
+		return nil, nil
+	}
+	n := &Notifier{
+		targets:  targets,
+		attempts: cfg.NotifyAttempts,
+		timeout:  cfg.NotifyTimeout,
+		metrics:  m,
+		logger:   logger,
+		queue:    make(chan Event, queueSize),
+		done:     make(chan struct{}),
+	}
+	go n.run()
+	return n, nil
+}
+
+// Notify queues an event for delivery.
+func (n *Notifier) Notify(event Event) {
+	if n == nil {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	select {
+	case n.queue <- event:
+	default:
+		n.logger.Warn("Notification queue full; dropping event", "event", event.Type)
+		n.metrics.Notification(event.Type, "dropped")
+	}
+}
+
+// Close stops accepting events and waits until the queue is delivered or ctx
+// is done.
+func (n *Notifier) Close(ctx context.Context) {
+	if n == nil {
+		return
+	}
+	close(n.queue)
+	select {
+	case <-n.done:
+	case <-ctx.Done():
+		n.logger.Warn("Notifications still pending at shutdown", "pending", len(n.queue))
+	}
+}
+
+// Test sends a test event to every target right away, ignoring event filters.
+func (n *Notifier) Test(ctx context.Context) error {
+	if n == nil {
+		return errors.New("no notification targets configured")
+	}
+	event := Event{Type: EventTest, Time: time.Now()}
+	var errs []error
+	for _, t := range n.targets {
+		if err := n.deliver(ctx, t, event); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", t.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (n *Notifier) run() {
+	defer close(n.done)
+	for event := range n.queue {
+		for _, t := range n.targets {
+			if t.wants(event) {
+				n.deliver(context.Background(), t, event)
+			}
+		}
+	}
+}
+
+func (n *Notifier) deliver(ctx context.Context, t target, event Event) error {
+	delay := retryDelay
+	for attempt := 1; ; attempt++ {
+		sendCtx, cancel := context.WithTimeout(ctx, n.timeout)
+		err := t.sender.Send(sendCtx, event)
+		cancel()
+		if err == nil {
+			n.logger.Debug("Notification sent", "target", t.name, "event", event.Type)
+			n.metrics.Notification(event.Type, "success")
+			return nil
+		}
+		var permErr *permanentError
+		if attempt >= n.attempts || errors.As(err, &permErr) {
+			n.logger.Error("Notification failed", "target", t.name, "event", event.Type, "attempt", attempt, "error", err)
+			n.metrics.Notification(event.Type, "failure")
+			return err
+		}
+		n.logger.Warn("Notification failed; retrying", "target", t.name, "event", event.Type, "attempt", attempt, "wait", delay.String(), "error", err)
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+		delay *= 2
+	}
+}
@@ -0,0 +1,98 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"hetzner-ddns/internal/config"
+)
+
+// Signature carries the hex HMAC-SHA256 of the request body, keyed with the
+// webhook secret, in the form sha256=<hex>.
+const signatureHeader = "X-DDNS-Signature"
+
+type webhook struct {
+	client    *http.Client
+	url       string
+	secret    string
+	headers   http.Header
+	userAgent string
+}
+
+func newWebhook(cfg config.WebhookConfig, userAgent string) *webhook {
+	return &webhook{
+		client:    &http.Client{},
+		url:       cfg.URL,
+		secret:    cfg.Secret,
+		headers:   cfg.Headers,
+		userAgent: userAgent,
+	}
+}
+
+func (w *webhook) Send(ctx context.Context, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return &permanentError{err: fmt.Errorf("encode event: %w", err)}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return &permanentError{err: err}
+	}
+	for name, values := range w.headers {
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", w.userAgent)
+	req.Header.Set("X-DDNS-Event", event.Type)
+	if w.secret != "" {
+		mac := hmac.New(sha256.New, []byte(w.secret))
+		mac.Write(body)
+		req.Header.Set(signatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	return doRequest(w.client, req)
+}
+
+// doRequest sends req and turns non-2xx responses into errors. Client errors
+// other than 408 and 429 are not retried.
+func doRequest(client *http.Client, req *http.Request) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		// Keep tokens embedded in the URL out of the logs.
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			urlErr.URL = redactURL(urlErr.URL)
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	snippet, _ := io.ReadAll(io.LimitReader(resp.Body, 256))
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	err = fmt.Errorf("unexpected status %s: %s", resp.Status, bytes.TrimSpace(snippet))
+	if resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests {
+		return &permanentError{err: err}
+	}
+	return err
+}
+
+// redactURL drops credentials, path and query from a URL for logging; webhook
+// URLs often embed tokens.
+func redactURL(raw string) string {
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return "(invalid url)"
+	}
+	return parsed.Scheme + "://" + parsed.Host
+}
@@ -0,0 +1,181 @@
+package notify
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"hetzner-ddns/internal/config"
+	"hetzner-ddns/internal/metrics"
+)
+
+func testNotifier(t *testing.T, cfg config.Config) *Notifier {
+	t.Helper()
+	cfg.UserAgent = "hetzner-ddns-test"
+	if cfg.NotifyAttempts == 0 {
+		cfg.NotifyAttempts = 1
+	}
+	cfg.NotifyTimeout = 5 * time.Second
+	n, err := New(cfg, metrics.New(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestWebhookSend(t *testing.T) {
+	var (
+		body    []byte
+		headers http.Header
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		headers = r.Header.Clone()
+	}))
+	defer srv.Close()
+
+	hook := newWebhook(config.WebhookConfig{
+		URL:     srv.URL,
+		Secret:  "s3cret",
+		Headers: http.Header{"Authorization": {"Bearer token"}},
+	}, "hetzner-ddns-test")
+	event := Event{Type: EventRecordUpdated, Time: time.Unix(0, 0).UTC(), Zone: "example.com", Record: "www", RecordType: "A", OldValues: []string{"203.0.113.1"}, NewIP: "203.0.113.2"}
+	if err := hook.Send(context.Background(), event); err != nil {
+		t.Fatal(err)
+	}
+
+	var got map[string]any
+	if err := json.Unmarshal(body, &got); err != nil {
+		t.Fatalf("body %s: %v", body, err)
+	}
+	want := map[string]any{"event": "record_updated", "time": "1970-01-01T00:00:00Z", "zone": "example.com", "record": "www", "record_type": "A", "old_values": []any{"203.0.113.1"}, "new_ip": "203.0.113.2"}
+	if gotJSON, wantJSON := mustJSON(t, got), mustJSON(t, want); gotJSON != wantJSON {
+		t.Errorf("payload = %s, want %s", gotJSON, wantJSON)
+	}
+
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write(body)
+	if sig := headers.Get(signatureHeader); sig != "sha256="+hex.EncodeToString(mac.Sum(nil)) {
+		t.Errorf("signature = %q", sig)
+	}
+	for name, want := range map[string]string{
+		"Authorization": "Bearer token",
+		"Content-Type":  "application/json",
+		"User-Agent":    "hetzner-ddns-test",
+		"X-DDNS-Event":  EventRecordUpdated,
+	} {
+		if got := headers.Get(name); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestWebhookUnsigned(t *testing.T) {
+	var headers http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = r.Header.Clone()
+	}))
+	defer srv.Close()
+
+	if err := newWebhook(config.WebhookConfig{URL: srv.URL}, "").Send(context.Background(), Event{Type: EventTest}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := headers[signatureHeader]; ok {
+		t.Errorf("unsigned webhook sent %s", signatureHeader)
+	}
+}
+
+func TestWebhookRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+		requests int32
+		fail     bool
+	}{
+		{"server error retried", []int{http.StatusBadGateway, http.StatusOK}, 2, false},
+		{"rate limit retried", []int{http.StatusTooManyRequests, http.StatusOK}, 2, false},
+		{"client error not retried", []int{http.StatusUnauthorized, http.StatusOK}, 1, true},
+		{"attempts exhausted", []int{http.StatusInternalServerError, http.StatusInternalServerError}, 2, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.statuses[requests.Add(1)-1])
+			}))
+			defer srv.Close()
+
+			n := testNotifier(t, config.Config{Webhooks: []config.WebhookConfig{{URL: srv.URL}}, NotifyAttempts: 2})
+			defer n.Close(context.Background())
+			err := n.Test(context.Background())
+			if (err != nil) != tt.fail {
+				t.Errorf("err = %v, want failure %v", err, tt.fail)
+			}
+			if got := requests.Load(); got != tt.requests {
+				t.Errorf("requests = %d, want %d", got, tt.requests)
+			}
+		})
+	}
+}
+
+func TestTargetWants(t *testing.T) {
+	filtered := target{filter: config.NotifyFilter{Events: []string{EventRecordFailed, EventSyncRecovered}, Zones: []string{"example.com"}}}
+	tests := []struct {
+		name   string
+		target target
+		event  Event
+		want   bool
+	}{
+		{"no filter", target{}, Event{Type: EventRecordUpdated, Zone: "example.org"}, true},
+		{"matching event and zone", filtered, Event{Type: EventRecordFailed, Zone: "example.com"}, true},
+		{"other event", filtered, Event{Type: EventRecordUpdated, Zone: "example.com"}, false},
+		{"other zone", filtered, Event{Type: EventRecordFailed, Zone: "example.org"}, false},
+		{"event without zone", filtered, Event{Type: EventSyncRecovered}, true},
+		{"test ignores filter", filtered, Event{Type: EventTest, Zone: "example.org"}, true},
+	}
+	for _, tt := range tests {
+		if got := tt.target.wants(tt.event); got != tt.want {
+			t.Errorf("%s: wants = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestNotifierDeliversFilteredEvents(t *testing.T) {
+	received := make(chan string, 4)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.Header.Get("X-DDNS-Event")
+	}))
+	defer srv.Close()
+
+	n := testNotifier(t, config.Config{Webhooks: []config.WebhookConfig{{URL: srv.URL, Filter: config.NotifyFilter{Events: []string{EventRecordFailed}}}}})
+	n.Notify(Event{Type: EventRecordUpdated, Zone: "example.com"})
+	n.Notify(Event{Type: EventRecordFailed, Zone: "example.com"})
+	n.Close(context.Background())
+	close(received)
+
+	var got []string
+	for event := range received {
+		got = append(got, event)
+	}
+	if len(got) != 1 || got[0] != EventRecordFailed {
+		t.Errorf("delivered %v, want only %s", got, EventRecordFailed)
+	}
+}
+
+func mustJSON(t *testing.T, v any) string {
+	t.Helper()
+	out, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out)
+}
@@ -0,0 +1,274 @@
+// Package rfc2136 is a minimal client for DNS UPDATE (RFC 2136) against an
+// authoritative server such as BIND or Knot, signed with TSIG (RFC 8945).
+// Records are exchanged in the Cloud API's text form, so A and AAAA values
+// are addresses and TXT values are quoted strings.
+package rfc2136
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	rcodeNXDomain = 3
+	// RcodeServFail is the only response code worth retrying.
+	RcodeServFail = 2
+)
+
+var rcodeNames = map[int]string{
+	1:  "FORMERR",
+	2:  "SERVFAIL",
+	3:  "NXDOMAIN",
+	4:  "NOTIMP",
+	5:  "REFUSED",
+	6:  "YXDOMAIN",
+	7:  "YXRRSET",
+	8:  "NXRRSET",
+	9:  "NOTAUTH",
+	10: "NOTZONE",
+	16: "BADSIG",
+	17: "BADKEY",
+	18: "BADTIME",
+}
+
+// Error is a response code other than NOERROR, or a TSIG error the server
+// reported for the request's signature.
+type Error struct {
+	Rcode     int
+	TSIGError int
+}
+
+// Code returns the mnemonic of the error, such as REFUSED or BADSIG.
+func (e *Error) Code() string {
+	code := e.Rcode
+	if e.TSIGError != 0 {
+		code = e.TSIGError
+	}
+	if name, ok := rcodeNames[code]; ok {
+		return name
+	}
+	return fmt.Sprintf("RCODE%d", code)
+}
+
+func (e *Error) Error() string {
+	if e.TSIGError != 0 {
+		return "rfc2136: tsig " + e.Code()
+	}
+	return "rfc2136: server returned " + e.Code()
+}
+
+// RR is one resource record. Name is absolute, with or without the trailing
+// dot.
+type RR struct {
+	Name  string
+	Type  string
+	TTL   int
+	Value string
+}
+
+type Client struct {
+	server string
+	key    *Key
+}
+
+// New returns a client for the server at host:port. Requests are signed when
+// key is not nil.
+func New(server string, key *Key) *Client {
+	return &Client{server: server, key: key}
+}
+
+// HasZone reports whether the server serves zone, by asking for its SOA.
+func (c *Client) HasZone(ctx context.Context, zone string) (bool, error) {
+	resp, err := c.query(ctx, zone, typeSOA)
+	if err != nil || resp == nil {
+		return false, err
+	}
+	for _, rr := range resp.answers {
+		if rr.typ == typeSOA && sameName(rr.name, zone) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Lookup returns the records of one name and type, or nil when there are none.
+func (c *Client) Lookup(ctx context.Context, name, rrType string) ([]RR, error) {
+	code, ok := typeCodes[rrType]
+	if !ok {
+		return nil, fmt.Errorf("unsupported record type %s", rrType)
+	}
+	resp, err := c.query(ctx, name, code)
+	if err != nil || resp == nil {
+		return nil, err
+	}
+	var records []RR
+	for _, rr := range resp.answers {
+		if rr.typ != code || !sameName(rr.name, name) {
+			continue
+		}
+		value, err := unpackValue(rr.typ, rr.rdata)
+		if err != nil {
+			return nil, fmt.Errorf("decode %s record of %s: %w", rrType, name, err)
+		}
+		records = append(records, RR{Name: name, Type: rrType, TTL: int(rr.ttl), Value: value})
+	}
+	return records, nil
+}
+
+// query returns nil without an error when the name does not exist.
+func (c *Client) query(ctx context.Context, name string, code uint16) (*response, error) {
+	m := &message{opcode: opcodeQuery}
+	m.sections[0] = []wireRR{{name: name, typ: code, class: classIN}}
+	resp, err := c.exchange(ctx, m)
+	if err != nil {
+		var rcodeErr *Error
+		if errors.As(err, &rcodeErr) && rcodeErr.Rcode == rcodeNXDomain {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return resp, nil
+}
+
+// Update collects the changes of one UPDATE message, which the server
+// applies all or nothing.
+type Update struct {
+	zone    string
+	changes []change
+}
+
+type change struct {
+	class uint16
+	rr    RR
+	// rrset deletes every record of the name and type.
+	rrset bool
+}
+
+func NewUpdate(zone string) *Update {
+	return &Update{zone: zone}
+}
+
+// Add adds a record; adding one that exists already changes nothing.
+func (u *Update) Add(rr RR) {
+	u.changes = append(u.changes, change{class: classIN, rr: rr})
+}
+
+// Delete removes a single record.
+func (u *Update) Delete(rr RR) {
+	u.changes = append(u.changes, change{class: classNONE, rr: rr})
+}
+
+// DeleteRRSet removes all records of a name and type.
+func (u *Update) DeleteRRSet(name, rrType string) {
+	u.changes = append(u.changes, change{class: classANY, rr: RR{Name: name, Type: rrType}, rrset: true})
+}
+
+// Send applies an update.
+func (c *Client) Send(ctx context.Context, u *Update) error {
+	if len(u.changes) == 0 {
+		return nil
+	}
+	m := &message{opcode: opcodeUpdate}
+	m.sections[0] = []wireRR{{name: u.zone, typ: typeSOA, class: classIN}}
+	for _, ch := range u.changes {
+		code, ok := typeCodes[ch.rr.Type]
+		if !ok {
+			return fmt.Errorf("unsupported record type %s", ch.rr.Type)
+		}
+		rr := wireRR{name: ch.rr.Name, typ: code, class: ch.class}
+		if !ch.rrset {
+			rdata, err := packValue(code, ch.rr.Value)
+			if err != nil {
+				return err
+			}
+			rr.rdata = rdata
+			if ch.class == classIN {
+				rr.ttl = uint32(ch.rr.TTL)
+			}
+		}
+		m.sections[2] = append(m.sections[2], rr)
+	}
+	_, err := c.exchange(ctx, m)
+	return err
+}
+
+// exchange sends a message over TCP and returns the verified response.
+func (c *Client) exchange(ctx context.Context, m *message) (*response, error) {
+	m.id = uint16(rand.UintN(1 << 16))
+	msg, err := m.pack()
+	if err != nil {
+		return nil, err
+	}
+	var requestMAC []byte
+	if c.key != nil {
+		if msg, requestMAC, err = c.key.sign(msg, time.Now()); err != nil {
+			return nil, err
+		}
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", c.server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	stop := context.AfterFunc(ctx, func() { _ = conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	frame := binary.BigEndian.AppendUint16(nil, uint16(len(msg)))
+	if _, err := conn.Write(append(frame, msg...)); err != nil {
+		return nil, contextErr(ctx, err)
+	}
+	var length [2]byte
+	if _, err := io.ReadFull(conn, length[:]); err != nil {
+		return nil, contextErr(ctx, err)
+	}
+	raw := make([]byte, binary.BigEndian.Uint16(length[:]))
+	if _, err := io.ReadFull(conn, raw); err != nil {
+		return nil, contextErr(ctx, err)
+	}
+
+	resp, err := parseResponse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("rfc2136: %w", err)
+	}
+	if resp.id != m.id || resp.flags&0x8000 == 0 {
+		return nil, fmt.Errorf("rfc2136: response does not match the request")
+	}
+	// Servers may answer errors unsigned, for example when they do not know
+	// the key; those are reported by their response code alone.
+	if c.key != nil && (resp.tsig != nil || resp.rcode() == 0) {
+		if err := c.key.verify(raw, resp, requestMAC, time.Now()); err != nil {
+			var tsigErr *Error
+			if errors.As(err, &tsigErr) {
+				return nil, err
+			}
+			return nil, fmt.Errorf("rfc2136: %w", err)
+		}
+	}
+	if resp.rcode() != 0 {
+		return nil, &Error{Rcode: resp.rcode()}
+	}
+	return resp, nil
+}
+
+func contextErr(ctx context.Context, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	return err
+}
+
+func sameName(a, b string) bool {
+	return strings.EqualFold(strings.TrimSuffix(a, "."), strings.TrimSuffix(b, "."))
+}
@@ -0,0 +1,411 @@
+package rfc2136
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var testKey = &Key{Name: "ddns-key", Secret: []byte("0123456789abcdef0123456789abcdef")}
+
+// testServer is an authoritative server for one zone that answers queries and
+// applies updates over TCP. Requests must be signed with testKey unless key is
+// nil; the zero value of the hooks answers like a well-behaved server.
+type testServer struct {
+	t    *testing.T
+	zone string
+	key  *Key
+
+	// tsigError, when set, is returned in an unsigned TSIG record instead of
+	// processing the request.
+	tsigError uint16
+	// rcode, when set, is returned for every request.
+	rcode int
+	// tamper flips a bit of the response MAC.
+	tamper bool
+	// unsigned answers signed requests without a signature.
+	unsigned bool
+	// skew moves the time in signed responses away from the local clock.
+	skew time.Duration
+
+	mu      sync.Mutex
+	records map[string][]wireRR
+	updates int
+}
+
+func newTestServer(t *testing.T, zone string, key *Key) (*testServer, string) {
+	t.Helper()
+	srv := &testServer{t: t, zone: zone, key: key, records: make(map[string][]wireRR)}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go srv.serve(conn)
+		}
+	}()
+	return srv, ln.Addr().String()
+}
+
+func rrKey(name string, typ uint16) string {
+	return strings.ToLower(strings.TrimSuffix(name, ".")) + fmt.Sprint("/", typ)
+}
+
+func (srv *testServer) serve(conn net.Conn) {
+	defer conn.Close()
+	var length [2]byte
+	if _, err := io.ReadFull(conn, length[:]); err != nil {
+		return
+	}
+	req := make([]byte, binary.BigEndian.Uint16(length[:]))
+	if _, err := io.ReadFull(conn, req); err != nil {
+		return
+	}
+	resp := srv.handle(req)
+	conn.Write(append(binary.BigEndian.AppendUint16(nil, uint16(len(resp))), resp...))
+}
+
+func (srv *testServer) handle(req []byte) []byte {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	id := binary.BigEndian.Uint16(req)
+	opcode := int(binary.BigEndian.Uint16(req[2:])>>11) & 0xf
+	question, sections := parseRequest(srv.t, req)
+
+	var requestMAC []byte
+	if srv.key != nil {
+		parsed, err := parseResponse(req)
+		if err != nil || parsed.tsig == nil {
+			srv.t.Errorf("request not signed: %v", err)
+			return srv.reply(id, opcode, question, nil, 9, nil)
+		}
+		if !verifyRequest(srv.key, req, parsed) {
+			srv.t.Errorf("request signature does not verify")
+			return srv.reply(id, opcode, question, nil, 9, nil)
+		}
+		requestMAC = parsed.tsig.mac
+		if srv.tsigError != 0 {
+			return srv.reply(id, opcode, question, nil, 9, &tsigRecord{keyName: srv.key.Name, algorithm: tsigAlgorithm, timeSigned: uint64(time.Now().Unix()), fudge: tsigFudge, originalID: id, errorCode: srv.tsigError})
+		}
+	}
+	if srv.rcode != 0 {
+		return srv.sign(srv.reply(id, opcode, question, nil, srv.rcode, nil), requestMAC)
+	}
+
+	switch opcode {
+	case opcodeQuery:
+		if !sameName(question.name, srv.zone) && !strings.HasSuffix(strings.ToLower(question.name), "."+srv.zone) {
+			return srv.sign(srv.reply(id, opcode, question, nil, 5, nil), requestMAC)
+		}
+		if question.typ == typeSOA && sameName(question.name, srv.zone) {
+			soa := wireRR{name: srv.zone, typ: typeSOA, class: classIN, ttl: 3600, rdata: []byte{0}}
+			return srv.sign(srv.reply(id, opcode, question, []wireRR{soa}, 0, nil), requestMAC)
+		}
+		if !srv.nameExists(question.name) {
+			return srv.sign(srv.reply(id, opcode, question, nil, rcodeNXDomain, nil), requestMAC)
+		}
+		return srv.sign(srv.reply(id, opcode, question, srv.records[rrKey(question.name, question.typ)], 0, nil), requestMAC)
+	case opcodeUpdate:
+		if question.typ != typeSOA || !sameName(question.name, srv.zone) {
+			return srv.sign(srv.reply(id, opcode, question, nil, 10, nil), requestMAC)
+		}
+		srv.updates++
+		for _, rr := range sections[2] {
+			key := rrKey(rr.name, rr.typ)
+			switch rr.class {
+			case classIN:
+				if !slices.ContainsFunc(srv.records[key], func(r wireRR) bool { return string(r.rdata) == string(rr.rdata) }) {
+					srv.records[key] = append(srv.records[key], wireRR{name: rr.name, typ: rr.typ, class: classIN, ttl: rr.ttl, rdata: slices.Clone(rr.rdata)})
+				}
+			case classNONE:
+				srv.records[key] = slices.DeleteFunc(srv.records[key], func(r wireRR) bool { return string(r.rdata) == string(rr.rdata) })
+			case classANY:
+				delete(srv.records, key)
+			}
+		}
+		return srv.sign(srv.reply(id, opcode, question, nil, 0, nil), requestMAC)
+	}
+	return srv.sign(srv.reply(id, opcode, question, nil, 4, nil), requestMAC)
+}
+
+func (srv *testServer) nameExists(name string) bool {
+	for key, records := range srv.records {
+		if len(records) > 0 && strings.HasPrefix(key, strings.ToLower(strings.TrimSuffix(name, "."))+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// reply packs a response; a TSIG record in tsig is appended as is.
+func (srv *testServer) reply(id uint16, opcode int, question wireRR, answers []wireRR, rcode int, tsig *tsigRecord) []byte {
+	m := &message{id: id, opcode: opcode}
+	m.sections[0] = []wireRR{question}
+	m.sections[1] = answers
+	msg, err := m.pack()
+	if err != nil {
+		srv.t.Fatal(err)
+	}
+	binary.BigEndian.PutUint16(msg[2:], 0x8000|uint16(opcode)<<11|uint16(rcode))
+	if tsig != nil {
+		msg = appendTSIG(msg, tsig)
+	}
+	return msg
+}
+
+// sign signs a response to a request with requestMAC, as a server would.
+func (srv *testServer) sign(msg, requestMAC []byte) []byte {
+	if srv.key == nil || srv.unsigned {
+		return msg
+	}
+	t := &tsigRecord{keyName: srv.key.Name, algorithm: tsigAlgorithm, timeSigned: uint64(time.Now().Add(srv.skew).Unix()), fudge: tsigFudge, originalID: binary.BigEndian.Uint16(msg)}
+	vars, _ := t.variables()
+	h := hmac.New(sha256.New, srv.key.Secret)
+	h.Write(binary.BigEndian.AppendUint16(nil, uint16(len(requestMAC))))
+	h.Write(requestMAC)
+	h.Write(msg)
+	h.Write(vars)
+	t.mac = h.Sum(nil)
+	if srv.tamper {
+		t.mac[0] ^= 1
+	}
+	return appendTSIG(msg, t)
+}
+
+func appendTSIG(msg []byte, t *tsigRecord) []byte {
+	rdata, _ := appendName(nil, t.algorithm)
+	rdata = binary.BigEndian.AppendUint16(rdata, uint16(t.timeSigned>>32))
+	rdata = binary.BigEndian.AppendUint32(rdata, uint32(t.timeSigned))
+	rdata = binary.BigEndian.AppendUint16(rdata, t.fudge)
+	rdata = binary.BigEndian.AppendUint16(rdata, uint16(len(t.mac)))
+	rdata = append(rdata, t.mac...)
+	rdata = binary.BigEndian.AppendUint16(rdata, t.originalID)
+	rdata = binary.BigEndian.AppendUint16(rdata, t.errorCode)
+	rdata = binary.BigEndian.AppendUint16(rdata, 0)
+	out, _ := appendName(slices.Clone(msg), t.keyName)
+	out = binary.BigEndian.AppendUint16(out, typeTSIG)
+	out = binary.BigEndian.AppendUint16(out, classANY)
+	out = binary.BigEndian.AppendUint32(out, 0)
+	out = binary.BigEndian.AppendUint16(out, uint16(len(rdata)))
+	out = append(out, rdata...)
+	binary.BigEndian.PutUint16(out[10:], binary.BigEndian.Uint16(out[10:])+1)
+	return out
+}
+
+// verifyRequest checks the MAC of a signed request, which covers the request
+// without its TSIG record and the TSIG variables.
+func verifyRequest(key *Key, req []byte, parsed *response) bool {
+	t := parsed.tsig
+	unsigned := slices.Clone(req[:parsed.tsigStart])
+	binary.BigEndian.PutUint16(unsigned, t.originalID)
+	binary.BigEndian.PutUint16(unsigned[10:], binary.BigEndian.Uint16(unsigned[10:])-1)
+	vars, err := t.variables()
+	if err != nil {
+		return false
+	}
+	h := hmac.New(sha256.New, key.Secret)
+	h.Write(unsigned)
+	h.Write(vars)
+	return hmac.Equal(h.Sum(nil), t.mac) && sameName(t.keyName, key.Name)
+}
+
+// parseRequest returns the question, or zone, and all record sections.
+func parseRequest(t *testing.T, msg []byte) (wireRR, [4][]wireRR) {
+	t.Helper()
+	var sections [4][]wireRR
+	var question wireRR
+	off := headerLen
+	for section := range 4 {
+		count := int(binary.BigEndian.Uint16(msg[4+2*section:]))
+		for range count {
+			if section == 0 {
+				name, next, err := readName(msg, off)
+				if err != nil {
+					t.Fatalf("question: %v", err)
+				}
+				question = wireRR{name: name, typ: binary.BigEndian.Uint16(msg[next:]), class: binary.BigEndian.Uint16(msg[next+2:])}
+				off = next + 4
+				continue
+			}
+			rr, next, err := readRR(msg, off)
+			if err != nil {
+				t.Fatalf("section %d: %v", section, err)
+			}
+			sections[section] = append(sections[section], rr)
+			off = next
+		}
+	}
+	return question, sections
+}
+
+func TestUpdateRoundTrip(t *testing.T) {
+	srv, addr := newTestServer(t, "example.com", testKey)
+	client := New(addr, testKey)
+	ctx := context.Background()
+
+	found, err := client.HasZone(ctx, "example.com")
+	if err != nil || !found {
+		t.Fatalf("HasZone = %v, %v", found, err)
+	}
+	if records, err := client.Lookup(ctx, "www.example.com", "A"); err != nil || records != nil {
+		t.Fatalf("absent name = %v, %v; want nil, nil", records, err)
+	}
+
+	u := NewUpdate("example.com")
+	u.Add(RR{Name: "www.example.com", Type: "A", TTL: 300, Value: "203.0.113.1"})
+	u.Add(RR{Name: "www.example.com", Type: "AAAA", TTL: 300, Value: "2001:db8::1"})
+	u.Add(RR{Name: "_hetzner-ddns.www.example.com", Type: "TXT", TTL: 300, Value: `"heritage=hetzner-ddns"`})
+	if err := client.Send(ctx, u); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	records, err := client.Lookup(ctx, "www.example.com", "A")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []RR{{Name: "www.example.com", Type: "A", TTL: 300, Value: "203.0.113.1"}}; !slices.Equal(records, want) {
+		t.Fatalf("A = %v, want %v", records, want)
+	}
+	txt, err := client.Lookup(ctx, "_hetzner-ddns.www.example.com", "TXT")
+	if err != nil || len(txt) != 1 || txt[0].Value != `"heritage=hetzner-ddns"` {
+		t.Fatalf("TXT = %v, %v", txt, err)
+	}
+
+	// Replace the A RRSet and drop the AAAA value in one message.
+	u = NewUpdate("example.com")
+	u.DeleteRRSet("www.example.com", "A")
+	u.Add(RR{Name: "www.example.com", Type: "A", TTL: 60, Value: "203.0.113.2"})
+	u.Delete(RR{Name: "www.example.com", Type: "AAAA", Value: "2001:db8::1"})
+	if err := client.Send(ctx, u); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	records, _ = client.Lookup(ctx, "www.example.com", "A")
+	if want := []RR{{Name: "www.example.com", Type: "A", TTL: 60, Value: "203.0.113.2"}}; !slices.Equal(records, want) {
+		t.Fatalf("A = %v, want %v", records, want)
+	}
+	if aaaa, err := client.Lookup(ctx, "www.example.com", "AAAA"); err != nil || aaaa != nil {
+		t.Fatalf("AAAA = %v, %v; want none", aaaa, err)
+	}
+	if srv.updates != 2 {
+		t.Fatalf("server applied %d updates, want 2", srv.updates)
+	}
+
+	if err := client.Send(ctx, NewUpdate("example.com")); err != nil || srv.updates != 2 {
+		t.Fatalf("empty update sent: %v", err)
+	}
+}
+
+func TestUnsignedClient(t *testing.T) {
+	_, addr := newTestServer(t, "example.com", nil)
+	client := New(addr, nil)
+	u := NewUpdate("example.com")
+	u.Add(RR{Name: "www.example.com", Type: "A", TTL: 300, Value: "203.0.113.1"})
+	if err := client.Send(context.Background(), u); err != nil {
+		t.Fatal(err)
+	}
+	if records, err := client.Lookup(context.Background(), "www.example.com", "A"); err != nil || len(records) != 1 {
+		t.Fatalf("Lookup = %v, %v", records, err)
+	}
+}
+
+func TestResponseSignature(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(*testServer)
+		want  string
+	}{
+		{"tampered mac", func(srv *testServer) { srv.tamper = true }, "response signature does not match"},
+		{"unsigned response", func(srv *testServer) { srv.unsigned = true }, "response is not signed"},
+		{"clock skew", func(srv *testServer) { srv.skew = -time.Hour }, "away from local time"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, addr := newTestServer(t, "example.com", testKey)
+			tt.setup(srv)
+			_, err := New(addr, testKey).HasZone(context.Background(), "example.com")
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("got %v, want %q", err, tt.want)
+			}
+			var rcodeErr *Error
+			if errors.As(err, &rcodeErr) {
+				t.Fatalf("signature failure reported as server error %s", rcodeErr.Code())
+			}
+		})
+	}
+}
+
+func TestServerErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(*testServer)
+		code  string
+	}{
+		{"bad key", func(srv *testServer) { srv.tsigError = 17 }, "BADKEY"},
+		{"bad time", func(srv *testServer) { srv.tsigError = 18 }, "BADTIME"},
+		{"refused", func(srv *testServer) { srv.rcode = 5 }, "REFUSED"},
+		{"servfail", func(srv *testServer) { srv.rcode = RcodeServFail }, "SERVFAIL"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, addr := newTestServer(t, "example.com", testKey)
+			tt.setup(srv)
+			u := NewUpdate("example.com")
+			u.Add(RR{Name: "www.example.com", Type: "A", TTL: 300, Value: "203.0.113.1"})
+			err := New(addr, testKey).Send(context.Background(), u)
+			var rcodeErr *Error
+			if !errors.As(err, &rcodeErr) || rcodeErr.Code() != tt.code {
+				t.Fatalf("got %v, want %s", err, tt.code)
+			}
+		})
+	}
+}
+
+func TestNXDomain(t *testing.T) {
+	_, addr := newTestServer(t, "example.com", testKey)
+	client := New(addr, testKey)
+	if records, err := client.Lookup(context.Background(), "missing.example.com", "AAAA"); err != nil || records != nil {
+		t.Fatalf("Lookup = %v, %v; want nil, nil", records, err)
+	}
+	found, err := client.HasZone(context.Background(), "sub.example.com")
+	if err != nil || found {
+		t.Fatalf("HasZone(sub.example.com) = %v, %v; want false, nil", found, err)
+	}
+	if _, err := client.HasZone(context.Background(), "example.org"); err == nil {
+		t.Fatal("zone the server refuses reported without error")
+	}
+}
+
+func TestContextDeadline(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err == nil {
+			defer conn.Close()
+			io.Copy(io.Discard, conn)
+		}
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := New(ln.Addr().String(), nil).HasZone(ctx, "example.com"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want deadline exceeded", err)
+	}
+}
@@ -0,0 +1,281 @@
+package rfc2136
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+const (
+	typeA     = 1
+	typeSOA   = 6
+	typeTXT   = 16
+	typeAAAA  = 28
+	typeTSIG  = 250
+	classIN   = 1
+	classNONE = 254
+	classANY  = 255
+
+	opcodeQuery  = 0
+	opcodeUpdate = 5
+
+	headerLen = 12
+)
+
+var typeCodes = map[string]uint16{
+	"A":    typeA,
+	"AAAA": typeAAAA,
+	"TXT":  typeTXT,
+}
+
+// wireRR is a resource record as it goes on the wire. Questions and the zone
+// section of an update use only name, type and class.
+type wireRR struct {
+	name  string
+	typ   uint16
+	class uint16
+	ttl   uint32
+	rdata []byte
+}
+
+type message struct {
+	id       uint16
+	opcode   int
+	sections [4][]wireRR
+}
+
+func (m *message) pack() ([]byte, error) {
+	buf := make([]byte, headerLen, 512)
+	binary.BigEndian.PutUint16(buf[0:], m.id)
+	binary.BigEndian.PutUint16(buf[2:], uint16(m.opcode)<<11)
+	for i, section := range m.sections {
+		binary.BigEndian.PutUint16(buf[4+2*i:], uint16(len(section)))
+	}
+	for i, section := range m.sections {
+		for _, rr := range section {
+			var err error
+			if buf, err = appendName(buf, rr.name); err != nil {
+				return nil, err
+			}
+			buf = binary.BigEndian.AppendUint16(buf, rr.typ)
+			buf = binary.BigEndian.AppendUint16(buf, rr.class)
+			if i == 0 {
+				continue
+			}
+			buf = binary.BigEndian.AppendUint32(buf, rr.ttl)
+			buf = binary.BigEndian.AppendUint16(buf, uint16(len(rr.rdata)))
+			buf = append(buf, rr.rdata...)
+		}
+	}
+	return buf, nil
+}
+
+// appendName writes name uncompressed. Names are absolute; a trailing dot is
+// optional.
+func appendName(buf []byte, name string) ([]byte, error) {
+	name = strings.TrimSuffix(name, ".")
+	if name != "" {
+		for _, label := range strings.Split(name, ".") {
+			if label == "" || len(label) > 63 {
+				return nil, fmt.Errorf("invalid domain name %q", name)
+			}
+			buf = append(buf, byte(len(label)))
+			buf = append(buf, label...)
+		}
+	}
+	if len(name) > 253 {
+		return nil, fmt.Errorf("domain name too long: %q", name)
+	}
+	return append(buf, 0), nil
+}
+
+// response is the part of a reply the client looks at.
+type response struct {
+	id      uint16
+	flags   uint16
+	answers []wireRR
+	// tsig is the TSIG record closing the additional section and tsigStart
+	// its offset in the message.
+	tsig      *tsigRecord
+	tsigStart int
+}
+
+func (r *response) rcode() int {
+	return int(r.flags & 0x000f)
+}
+
+var errTruncated = errors.New("truncated message")
+
+func parseResponse(msg []byte) (*response, error) {
+	if len(msg) < headerLen {
+		return nil, errTruncated
+	}
+	resp := &response{
+		id:    binary.BigEndian.Uint16(msg[0:]),
+		flags: binary.BigEndian.Uint16(msg[2:]),
+	}
+	var counts [4]int
+	for i := range counts {
+		counts[i] = int(binary.BigEndian.Uint16(msg[4+2*i:]))
+	}
+	off := headerLen
+	for range counts[0] {
+		var err error
+		if _, off, err = readName(msg, off); err != nil {
+			return nil, err
+		}
+		if off += 4; off > len(msg) {
+			return nil, errTruncated
+		}
+	}
+	for section := 1; section < 4; section++ {
+		for i := range counts[section] {
+			start := off
+			rr, next, err := readRR(msg, off)
+			if err != nil {
+				return nil, err
+			}
+			off = next
+			switch {
+			case section == 1:
+				resp.answers = append(resp.answers, rr)
+			case section == 3 && i == counts[3]-1 && rr.typ == typeTSIG:
+				tsig, err := parseTSIG(msg, next, rr)
+				if err != nil {
+					return nil, err
+				}
+				resp.tsig, resp.tsigStart = tsig, start
+			}
+		}
+	}
+	return resp, nil
+}
+
+func readRR(msg []byte, off int) (wireRR, int, error) {
+	name, off, err := readName(msg, off)
+	if err != nil {
+		return wireRR{}, 0, err
+	}
+	if off+10 > len(msg) {
+		return wireRR{}, 0, errTruncated
+	}
+	rr := wireRR{
+		name:  name,
+		typ:   binary.BigEndian.Uint16(msg[off:]),
+		class: binary.BigEndian.Uint16(msg[off+2:]),
+		ttl:   binary.BigEndian.Uint32(msg[off+4:]),
+	}
+	rdlen := int(binary.BigEndian.Uint16(msg[off+8:]))
+	off += 10
+	if off+rdlen > len(msg) {
+		return wireRR{}, 0, errTruncated
+	}
+	rr.rdata = msg[off : off+rdlen]
+	return rr, off + rdlen, nil
+}
+
+// readName reads a possibly compressed name and returns it without the
+// trailing dot, along with the offset after it.
+func readName(msg []byte, off int) (string, int, error) {
+	var labels []string
+	next := -1
+	for jumps := 0; ; {
+		if off >= len(msg) {
+			return "", 0, errTruncated
+		}
+		length := int(msg[off])
+		switch {
+		case length == 0:
+			if next < 0 {
+				next = off + 1
+			}
+			return strings.Join(labels, "."), next, nil
+		case length&0xc0 == 0xc0:
+			if off+1 >= len(msg) {
+				return "", 0, errTruncated
+			}
+			if jumps++; jumps > 64 {
+				return "", 0, errors.New("compression loop in message")
+			}
+			if next < 0 {
+				next = off + 2
+			}
+			off = int(binary.BigEndian.Uint16(msg[off:]) & 0x3fff)
+		case length > 63:
+			return "", 0, fmt.Errorf("invalid label length %d", length)
+		default:
+			if off+1+length > len(msg) {
+				return "", 0, errTruncated
+			}
+			labels = append(labels, string(msg[off+1:off+1+length]))
+			off += 1 + length
+		}
+	}
+}
+
+// packValue encodes a value in the Cloud API's text form as rdata.
+func packValue(rrType uint16, value string) ([]byte, error) {
+	switch rrType {
+	case typeA:
+		ip := net.ParseIP(value).To4()
+		if ip == nil {
+			return nil, fmt.Errorf("invalid A value %q", value)
+		}
+		return ip, nil
+	case typeAAAA:
+		ip := net.ParseIP(value)
+		if ip == nil || ip.To4() != nil {
+			return nil, fmt.Errorf("invalid AAAA value %q", value)
+		}
+		return ip.To16(), nil
+	case typeTXT:
+		var rdata []byte
+		for _, part := range txtParts(value) {
+			for {
+				chunk := part[:min(len(part), 255)]
+				rdata = append(rdata, byte(len(chunk)))
+				rdata = append(rdata, chunk...)
+				if part = part[len(chunk):]; part == "" {
+					break
+				}
+			}
+		}
+		return rdata, nil
+	}
+	return nil, fmt.Errorf("unsupported record type %d", rrType)
+}
+
+// unpackValue turns rdata into the Cloud API's text form; TXT strings are
+// quoted and joined by spaces.
+func unpackValue(rrType uint16, rdata []byte) (string, error) {
+	switch rrType {
+	case typeA, typeAAAA:
+		if len(rdata) != net.IPv4len && len(rdata) != net.IPv6len {
+			return "", errTruncated
+		}
+		return net.IP(rdata).String(), nil
+	case typeTXT:
+		var parts []string
+		for len(rdata) > 0 {
+			length := int(rdata[0])
+			if 1+length > len(rdata) {
+				return "", errTruncated
+			}
+			parts = append(parts, `"`+string(rdata[1:1+length])+`"`)
+			rdata = rdata[1+length:]
+		}
+		return strings.Join(parts, " "), nil
+	}
+	return "", fmt.Errorf("unsupported record type %d", rrType)
+}
+
+// txtParts splits `"a" "b"` into its strings; an unquoted value is one string.
+func txtParts(value string) []string {
+	value = strings.TrimSpace(value)
+	if len(value) < 2 || !strings.HasPrefix(value, `"`) || !strings.HasSuffix(value, `"`) {
+		return []string{value}
+	}
+	return strings.Split(value[1:len(value)-1], `" "`)
+}
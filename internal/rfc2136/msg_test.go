@@ -0,0 +1,99 @@
+package rfc2136
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+func TestTXTPacking(t *testing.T) {
+	long := strings.Repeat("x", 300)
+	tests := []struct {
+		value string
+		rdata []byte
+		want  string
+	}{
+		{`"heritage=hetzner-ddns"`, append([]byte{21}, "heritage=hetzner-ddns"...), `"heritage=hetzner-ddns"`},
+		{`unquoted value`, append([]byte{14}, "unquoted value"...), `"unquoted value"`},
+		{`"a" "b c"`, []byte{1, 'a', 3, 'b', ' ', 'c'}, `"a" "b c"`},
+		{`""`, []byte{0}, `""`},
+		// Strings longer than 255 bytes go out as several character-strings.
+		{`"` + long + `"`, append(append([]byte{255}, long[:255]...), append([]byte{45}, long[255:]...)...), `"` + long[:255] + `" "` + long[255:] + `"`},
+	}
+	for _, tt := range tests {
+		rdata, err := packValue(typeTXT, tt.value)
+		if err != nil {
+			t.Fatalf("packValue(%.20q): %v", tt.value, err)
+		}
+		if !bytes.Equal(rdata, tt.rdata) {
+			t.Errorf("packValue(%.20q) = %q, want %q", tt.value, rdata, tt.rdata)
+		}
+		got, err := unpackValue(typeTXT, rdata)
+		if err != nil || got != tt.want {
+			t.Errorf("unpackValue(%.20q) = %.40q, %v; want %.40q", tt.value, got, err, tt.want)
+		}
+	}
+	if _, err := unpackValue(typeTXT, []byte{5, 'a'}); err == nil {
+		t.Error("truncated TXT rdata accepted")
+	}
+}
+
+func TestAddressPacking(t *testing.T) {
+	for _, tt := range []struct {
+		typ   uint16
+		value string
+	}{{typeA, "203.0.113.1"}, {typeAAAA, "2001:db8::1"}} {
+		rdata, err := packValue(tt.typ, tt.value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, err := unpackValue(tt.typ, rdata); err != nil || got != tt.value {
+			t.Errorf("round trip of %s = %q, %v", tt.value, got, err)
+		}
+	}
+	for _, tt := range []struct {
+		typ   uint16
+		value string
+	}{{typeA, "2001:db8::1"}, {typeAAAA, "203.0.113.1"}, {typeA, "example.com"}} {
+		if _, err := packValue(tt.typ, tt.value); err == nil {
+			t.Errorf("packValue(%d, %s) accepted", tt.typ, tt.value)
+		}
+	}
+}
+
+func TestParseResponseCompressedNames(t *testing.T) {
+	m := &message{id: 7, opcode: opcodeQuery}
+	m.sections[0] = []wireRR{{name: "www.example.com", typ: typeA, class: classIN}}
+	msg, err := m.pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// One answer whose owner name points back at the question name.
+	msg = append(msg, 0xc0, headerLen)
+	msg = binary.BigEndian.AppendUint16(msg, typeA)
+	msg = binary.BigEndian.AppendUint16(msg, classIN)
+	msg = binary.BigEndian.AppendUint32(msg, 300)
+	msg = binary.BigEndian.AppendUint16(msg, 4)
+	msg = append(msg, 203, 0, 113, 1)
+	binary.BigEndian.PutUint16(msg[6:], 1)
+
+	resp, err := parseResponse(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.answers) != 1 || !sameName(resp.answers[0].name, "www.example.com") || resp.answers[0].ttl != 300 {
+		t.Fatalf("answers = %+v", resp.answers)
+	}
+
+	// A pointer to itself must not loop.
+	loop := append(msg[:headerLen:headerLen], 0xc0, headerLen, 0, 1, 0, 1)
+	binary.BigEndian.PutUint16(loop[4:], 1)
+	binary.BigEndian.PutUint16(loop[6:], 0)
+	if _, err := parseResponse(loop); err == nil {
+		t.Error("compression loop accepted")
+	}
+	if _, err := parseResponse(msg[:len(msg)-3]); err == nil {
+		t.Error("truncated message accepted")
+	}
+}
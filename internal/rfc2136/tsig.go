@@ -0,0 +1,161 @@
+package rfc2136
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	tsigAlgorithm = "hmac-sha256"
+	tsigFudge     = 300
+)
+
+// Key is a TSIG key. Only HMAC-SHA256 is supported.
+type Key struct {
+	Name   string
+	Secret []byte
+}
+
+type tsigRecord struct {
+	keyName    string
+	algorithm  string
+	timeSigned uint64
+	fudge      uint16
+	mac        []byte
+	originalID uint16
+	errorCode  uint16
+	other      []byte
+}
+
+// parseTSIG decodes the rdata of a TSIG record ending at end.
+func parseTSIG(msg []byte, end int, rr wireRR) (*tsigRecord, error) {
+	algorithm, off, err := readName(msg, end-len(rr.rdata))
+	if err != nil || off > end {
+		return nil, errTruncated
+	}
+	rdata := msg[off:end]
+	if len(rdata) < 10 {
+		return nil, errTruncated
+	}
+	t := &tsigRecord{keyName: rr.name, algorithm: algorithm}
+	t.timeSigned = uint64(binary.BigEndian.Uint16(rdata))<<32 | uint64(binary.BigEndian.Uint32(rdata[2:]))
+	t.fudge = binary.BigEndian.Uint16(rdata[6:])
+	macLen := int(binary.BigEndian.Uint16(rdata[8:]))
+	rdata = rdata[10:]
+	if len(rdata) < macLen+6 {
+		return nil, errTruncated
+	}
+	t.mac = rdata[:macLen]
+	rdata = rdata[macLen:]
+	t.originalID = binary.BigEndian.Uint16(rdata)
+	t.errorCode = binary.BigEndian.Uint16(rdata[2:])
+	otherLen := int(binary.BigEndian.Uint16(rdata[4:]))
+	if len(rdata) < 6+otherLen {
+		return nil, errTruncated
+	}
+	t.other = rdata[6 : 6+otherLen]
+	return t, nil
+}
+
+// variables returns the TSIG fields that are covered by the MAC besides the
+// message itself (RFC 8945, section 4.3.3).
+func (t *tsigRecord) variables() ([]byte, error) {
+	buf, err := appendName(nil, strings.ToLower(t.keyName))
+	if err != nil {
+		return nil, err
+	}
+	buf = binary.BigEndian.AppendUint16(buf, classANY)
+	buf = binary.BigEndian.AppendUint32(buf, 0)
+	if buf, err = appendName(buf, strings.ToLower(t.algorithm)); err != nil {
+		return nil, err
+	}
+	buf = binary.BigEndian.AppendUint16(buf, uint16(t.timeSigned>>32))
+	buf = binary.BigEndian.AppendUint32(buf, uint32(t.timeSigned))
+	buf = binary.BigEndian.AppendUint16(buf, t.fudge)
+	buf = binary.BigEndian.AppendUint16(buf, t.errorCode)
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(t.other)))
+	return append(buf, t.other...), nil
+}
+
+// sign appends a TSIG record to a packed message and returns the signed
+// message and its MAC, which the response's MAC covers.
+func (k *Key) sign(msg []byte, now time.Time) ([]byte, []byte, error) {
+	t := &tsigRecord{
+		keyName:    k.Name,
+		algorithm:  tsigAlgorithm,
+		timeSigned: uint64(now.Unix()),
+		fudge:      tsigFudge,
+		originalID: binary.BigEndian.Uint16(msg),
+	}
+	vars, err := t.variables()
+	if err != nil {
+		return nil, nil, fmt.Errorf("tsig key name: %w", err)
+	}
+	h := hmac.New(sha256.New, k.Secret)
+	h.Write(msg)
+	h.Write(vars)
+	t.mac = h.Sum(nil)
+
+	rdata, _ := appendName(nil, t.algorithm)
+	rdata = binary.BigEndian.AppendUint16(rdata, uint16(t.timeSigned>>32))
+	rdata = binary.BigEndian.AppendUint32(rdata, uint32(t.timeSigned))
+	rdata = binary.BigEndian.AppendUint16(rdata, t.fudge)
+	rdata = binary.BigEndian.AppendUint16(rdata, uint16(len(t.mac)))
+	rdata = append(rdata, t.mac...)
+	rdata = binary.BigEndian.AppendUint16(rdata, t.originalID)
+	rdata = binary.BigEndian.AppendUint16(rdata, 0)
+	rdata = binary.BigEndian.AppendUint16(rdata, 0)
+
+	signed, _ := appendName(msg, strings.ToLower(k.Name))
+	signed = binary.BigEndian.AppendUint16(signed, typeTSIG)
+	signed = binary.BigEndian.AppendUint16(signed, classANY)
+	signed = binary.BigEndian.AppendUint32(signed, 0)
+	signed = binary.BigEndian.AppendUint16(signed, uint16(len(rdata)))
+	signed = append(signed, rdata...)
+	binary.BigEndian.PutUint16(signed[10:], binary.BigEndian.Uint16(signed[10:])+1)
+	return signed, t.mac, nil
+}
+
+// verify checks the TSIG record of a response to a request signed with
+// requestMAC.
+func (k *Key) verify(msg []byte, resp *response, requestMAC []byte, now time.Time) error {
+	t := resp.tsig
+	if t == nil {
+		return fmt.Errorf("response is not signed")
+	}
+	if t.errorCode != 0 {
+		return &Error{TSIGError: int(t.errorCode)}
+	}
+	if !strings.EqualFold(strings.TrimSuffix(t.keyName, "."), strings.TrimSuffix(k.Name, ".")) ||
+		!strings.EqualFold(strings.TrimSuffix(t.algorithm, "."), tsigAlgorithm) {
+		return fmt.Errorf("response is signed with key %s (%s)", t.keyName, t.algorithm)
+	}
+
+	// The MAC covers the message as it was before the TSIG record was added:
+	// without the record, one fewer additional record and the original ID.
+	unsigned := make([]byte, resp.tsigStart)
+	copy(unsigned, msg[:resp.tsigStart])
+	binary.BigEndian.PutUint16(unsigned, t.originalID)
+	binary.BigEndian.PutUint16(unsigned[10:], binary.BigEndian.Uint16(unsigned[10:])-1)
+	vars, err := t.variables()
+	if err != nil {
+		return err
+	}
+	h := hmac.New(sha256.New, k.Secret)
+	h.Write(binary.BigEndian.AppendUint16(nil, uint16(len(requestMAC))))
+	h.Write(requestMAC)
+	h.Write(unsigned)
+	h.Write(vars)
+	if !hmac.Equal(h.Sum(nil), t.mac) {
+		return fmt.Errorf("response signature does not match")
+	}
+	skew := now.Unix() - int64(t.timeSigned)
+	if skew < -int64(t.fudge) || skew > int64(t.fudge) {
+		return fmt.Errorf("response signed %ds away from local time", skew)
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const fileVersion = 1
+
+type Record struct {
+	Value     string    `json:"value"`
+	TTL       *int      `json:"ttl,omitempty"`
+	RRSetID   string    `json:"rrset_id,omitempty"`
+	Owned     []string  `json:"owned,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type Zone struct {
+	ID int64 `json:"id"`
+}
+
+type file struct {
+	Version       int                  `json:"version"`
+	LastReconcile time.Time            `json:"last_reconcile"`
+	Zones         map[string]Zone      `json:"zones"`
+	Records       map[string]Record    `json:"records"`
+	Missing       map[string]time.Time `json:"missing,omitempty"`
+}
+
+type Store struct {
+	path  string
+	mu    sync.Mutex
+	data  file
+	dirty bool
+}
+
+func Open(path string) (*Store, error) {
+	s := &Store{
+		path: path,
+		data: file{
+			Version: fileVersion,
+			Zones:   make(map[string]Zone),
+			Records: make(map[string]Record),
+			Missing: make(map[string]time.Time),
+		},
+	}
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read state file: %w", err)
+	}
+	var loaded file
+	if err := json.Unmarshal(raw, &loaded); err != nil {
+		return nil, fmt.Errorf("parse state file %s: %w", path, err)
+	}
+	if loaded.Version != fileVersion {
+		return nil, fmt.Errorf("state file %s has unsupported version %d", path, loaded.Version)
+	}
+	s.data.LastReconcile = loaded.LastReconcile
+	if loaded.Zones != nil {
+		s.data.Zones = loaded.Zones
+	}
+	if loaded.Records != nil {
+		s.data.Records = loaded.Records
+	}
+	if loaded.Missing != nil {
+		s.data.Missing = loaded.Missing
+	}
+	return s, nil
+}
+
+func RecordKey(zone, name, recordType string) string {
+	return zone + "/" + name + "/" + recordType
+}
+
+func (s *Store) Record(key string) (Record, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, ok := s.data.Records[key]
+	return rec, ok
+}
+
+func (s *Store) SetRecord(key string, rec Record) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Records[key] = rec
+	s.dirty = true
+}
+
+func (s *Store) DeleteRecord(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.data.Records[key]; ok {
+		delete(s.data.Records, key)
+		s.dirty = true
+	}
+}
+
+func (s *Store) Zone(name string) (Zone, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	zone, ok := s.data.Zones[name]
+	return zone, ok
+}
+
+func (s *Store) SetZone(name string, zone Zone) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if current, ok := s.data.Zones[name]; ok && current == zone {
+		return
+	}
+	s.data.Zones[name] = zone
+	s.dirty = true
+}
+
+// MissingSince returns when the source for key first reported no address.
+func (s *Store) MissingSince(key string) (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	since, ok := s.data.Missing[key]
+	return since, ok
+}
+
+func (s *Store) SetMissingSince(key string, since time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Missing[key] = since.UTC()
+	s.dirty = true
+}
+
+func (s *Store) ClearMissing(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.data.Missing[key]; ok {
+		delete(s.data.Missing, key)
+		s.dirty = true
+	}
+}
+
+func (s *Store) LastReconcile() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data.LastReconcile
+}
+
+func (s *Store) SetLastReconcile(at time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.LastReconcile = at.UTC()
+	s.dirty = true
+}
+
+func (s *Store) Save() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.dirty {
+		return nil
+	}
+	raw, err := json.MarshalIndent(s.data, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode state: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("create temp state file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(raw, '\n')); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write state file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("close state file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("replace state file: %w", err)
+	}
+	s.dirty = false
+	return nil
+}